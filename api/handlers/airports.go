@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+type airportsHandler struct {
+	store   models.AirportStore
+	flights models.FlightStore
+}
+
+func airports(store models.AirportStore, flights models.FlightStore) *airportsHandler {
+	return &airportsHandler{store: store, flights: flights}
+}
+
+func airportID(ps httprouter.Params) (uint, error) {
+	id, err := strconv.ParseUint(ps.ByName("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, problem.BadRequest("invalid_id", "airport id must be a positive integer")
+	}
+
+	return uint(id), nil
+}
+
+func (h *airportsHandler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		result []models.Airport
+		err    error
+	)
+
+	q := r.URL.Query()
+
+	filter := models.AirportFilter{
+		Code:    q.Get("code"),
+		City:    q.Get("city"),
+		Country: q.Get("country"),
+	}
+
+	if result, err = h.store.List(filter); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
+
+func (h *airportsHandler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		a   *models.Airport
+		aid uint
+		err error
+	)
+
+	if aid, err = airportID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if a, err = h.store.Find(aid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(a)
+
+	return http.StatusOK, nil
+}
+
+func (h *airportsHandler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		a   models.Airport
+		err error
+	)
+
+	if err = helpers.Decode(r.Body, &a); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if err = a.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = h.store.Create(&a); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(a)
+
+	return http.StatusOK, nil
+}
+
+func (h *airportsHandler) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		a   models.Airport
+		aid uint
+		err error
+	)
+
+	if aid, err = airportID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = helpers.Decode(r.Body, &a); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if err = a.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = h.store.Update(aid, &a); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(a)
+
+	return http.StatusOK, nil
+}
+
+func (h *airportsHandler) remove(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		aid  uint
+		page models.FlightPage
+		err  error
+	)
+
+	if aid, err = airportID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	searches := []models.Search{
+		{OriginAirports: []uint{aid}, Limit: 1, Deleted: models.DeletedInclude},
+		{DestinationAirports: []uint{aid}, Limit: 1, Deleted: models.DeletedInclude},
+	}
+
+	for _, s := range searches {
+		if page, err = h.flights.Find(s); err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if len(page.Flights) != 0 {
+			return http.StatusConflict, problem.Conflict("airport_in_use", "airport is referenced by flights")
+		}
+	}
+
+	if err = h.store.Delete(aid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,241 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/data"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+// testLoadAirports loads bundled airports into store, loading is idempotent
+func testLoadAirports(t *testing.T) {
+	airports, skipped, err := models.ParseAirportsCSV(bytes.NewReader(data.Airports))
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if skipped != 0 || len(airports) == 0 {
+		t.Fatalf("Expected all bundled airports to be valid, obtained: %d loaded, %d skipped\n", len(airports), skipped)
+	}
+
+	if err = stores.Airports.Upsert(airports); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+}
+
+// testAirport finds airport by code
+func testAirport(t *testing.T, code string) *models.Airport {
+	a, err := stores.Airports.FindByCode(code)
+	if err != nil {
+		t.Fatalf("Error finding airport %s - %s\n", code, err)
+	}
+
+	return a
+}
+
+// testProblem decodes problem document and checks its code and fields
+func testProblem(t *testing.T, r *http.Response, status int, code string, fields ...string) {
+	if r.StatusCode != status {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", status, r.StatusCode)
+	}
+
+	obtained := problem.Document{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if obtained.Code != code || len(obtained.Fields) != len(fields) {
+		t.Fatalf("\nExpected code: %s, fields: %v\nObtained: %v\n", code, fields, obtained)
+	}
+
+	for i, f := range obtained.Fields {
+		if f.Field != fields[i] {
+			t.Fatalf("\nExpected fields: %v\nObtained: %v\n", fields, obtained.Fields)
+		}
+	}
+}
+
+func TestAirports(t *testing.T) {
+	testLoadAirports(t)
+	testLoadAirports(t)
+
+	cfg := testAuth(t, "airports", models.RoleAdmin)
+
+	endpoint := fmt.Sprintf("http://%s/airports?code=svo", listenOn)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	obtained := []models.Airport{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(obtained) != 1 || obtained[0].ICAO != "UUEE" || obtained[0].TimeZone != "Europe/Moscow" {
+		t.Fatalf("\nExpected single SVO airport\nObtained: %v\n", obtained)
+	}
+
+	endpoint = "http://" + listenOn + "/airports"
+
+	// Codes are checked for uniqueness
+	payload, err := json.Marshal(obtained[0])
+	if err != nil {
+		t.Fatalf("Error marshalling struct - %s\n", err)
+	}
+
+	r, err = rpc.Request("POST", endpoint, payload, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 409, "airport_exists")
+
+	payload = []byte(`{"iata": "svo1", "name": "Test", "city": "Test", "country": "Test", "latitude": 91, "timezone": "Mars/Olympus"}`)
+
+	r, err = rpc.Request("POST", endpoint, payload, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "iata", "latitude", "timezone")
+
+	payload = []byte(`{"iata": "ZZZ", "icao": "ZZZZ", "name": "Test", "city": "Test", "country": "Test", "timezone": "UTC"}`)
+
+	r, err = rpc.Request("POST", endpoint, payload, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	created := testAirport(t, "ZZZ")
+	endpoint = fmt.Sprintf("http://%s/airports/%d", listenOn, created.ID)
+
+	r, err = rpc.Request("DELETE", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	r, err = rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 404, problem.CodeNotFound)
+}
+
+func TestFlightAirports(t *testing.T) {
+	testLoadAirports(t)
+
+	var (
+		cfg      = testAuth(t, "flight_airports", models.RoleAdmin)
+		svo      = testAirport(t, "SVO")
+		led      = testAirport(t, "LED")
+		endpoint = "http://" + listenOn + "/flights"
+	)
+
+	payload := fmt.Sprintf(`{"name": "test", "number": "SU10", "fare": 100, "departure": "2021-04-01T09:00:00+03:00", "arrival": "2021-04-01T10:20:00+03:00", "origin_airport_id": %d, "destination_airport_id": %d}`, svo.ID, led.ID)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	obtained := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if obtained.Destination != led.City {
+		t.Fatalf("\nExpected destination: %s\nObtained: %s\n", led.City, obtained.Destination)
+	}
+
+	// Times are stored in UTC and returned in airports zones too
+	if obtained.Duration != 80 || obtained.Departure.Format(time.RFC3339) != "2021-04-01T06:00:00Z" ||
+		obtained.OriginTimeZone != "Europe/Moscow" || obtained.DepartureLocal == nil ||
+		obtained.DepartureLocal.Format(time.RFC3339) != "2021-04-01T09:00:00+03:00" {
+		t.Fatalf("Unexpected flight times - %v\n", obtained)
+	}
+
+	payload = `{"name": "test", "number": "SU12", "fare": 100, "destination": "Moscow", "departure": "2021-04-01T09:00:00+03:00", "arrival": "2021-04-01T05:00:00Z", "duration": 10}`
+
+	r, err = rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "arrival")
+
+	// Referenced airports must exist and differ
+	payload = fmt.Sprintf(`{"name": "test", "number": "SU11", "fare": 100, "departure": "2021-04-01T09:00:00+03:00", "arrival": "2021-04-01T10:20:00+03:00", "origin_airport_id": %d, "destination_airport_id": %d}`, svo.ID, svo.ID)
+
+	r, err = rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "destination_airport_id")
+
+	payload = `{"name": "test", "number": "SU11", "fare": 100, "departure": "2021-04-01T09:00:00+03:00", "arrival": "2021-04-01T10:20:00+03:00", "origin_airport_id": 100000}`
+
+	r, err = rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "destination", "origin_airport_id")
+
+	search := fmt.Sprintf("%s?origin_airport_id=%d&destination_airport_id=%d", endpoint, svo.ID, led.ID)
+
+	r, err = rpc.Request("GET", search, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", search, err)
+	}
+
+	page := testFlightsPage{}
+
+	if err := helpers.Decode(r.Body, &page); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(page.Flights) != 1 || page.Flights[0].ID != obtained.ID {
+		t.Fatalf("\nExpected flight: %d\nObtained: %v\n", obtained.ID, page.Flights)
+	}
+
+	// Referenced airport can't be deleted
+	airport := fmt.Sprintf("http://%s/airports/%d", listenOn, led.ID)
+
+	r, err = rpc.Request("DELETE", airport, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", airport, err)
+	}
+
+	testProblem(t, r, 409, "airport_in_use")
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	m "github.com/3d0c/sample-api/api/middleware"
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+)
+
+type auditHandler struct {
+	store models.AuditStore
+}
+
+func audit(store models.AuditStore) *auditHandler {
+	return &auditHandler{store: store}
+}
+
+// record appends change of resource made by the request to audit log of
+// organization, see models.AppendAudit
+func record(s models.AuditStore, r *http.Request, org uint, action string, resource string, id uint, before, after interface{}) error {
+	return models.AppendAudit(s, org, caller(r), m.RequestID(r.Context()), action, resource, id, before, after)
+}
+
+type auditPage struct {
+	Entries    []models.AuditEntry `json:"entries"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// list returns audit entries of the caller organization, newest first
+func (h *auditHandler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		search models.AuditSearch
+		page   auditPage
+		err    error
+	)
+
+	if search, err = models.ParseAuditSearch(r.URL.Query()); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if page.Entries, err = h.store.Tenant(m.OrganizationID(r.Context())).Find(search); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if n := len(page.Entries); n == search.Limit {
+		page.NextCursor = strconv.FormatUint(uint64(page.Entries[n-1].ID), 10)
+
+		next := *r.URL
+		nq := next.Query()
+		nq.Set("cursor", page.NextCursor)
+		next.RawQuery = nq.Encode()
+
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	helpers.NewJsonResponder(w).Write(page)
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+type testAuditPage struct {
+	Entries    []models.AuditEntry `json:"entries"`
+	NextCursor string              `json:"next_cursor"`
+}
+
+// testAuditEntries requests audit log with query
+func testAuditEntries(t *testing.T, cfg *rpc.Config, query string) testAuditPage {
+	r := testRequest(t, "GET", "http://"+listenOn+"/audit?"+query, "", cfg)
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	page := testAuditPage{}
+
+	if err := helpers.Decode(r.Body, &page); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	return page
+}
+
+func TestAudit(t *testing.T) {
+	var (
+		admin    = testAuth(t, "audit-admin", models.RoleAdmin)
+		operator = testAuth(t, "audit-operator", models.RoleOperator)
+		flights  = "http://" + listenOn + "/flights"
+		payload  = `{"name": "audit", "number": "AU100", "fare": 100, "destination": "Audit",
+			"departure": "2021-04-02T09:00:00Z", "arrival": "2021-04-02T10:00:00Z"}`
+	)
+
+	u, err := stores.Users.FindByName("audit-operator")
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	r := testRequest(t, "POST", flights, payload, operator)
+	created := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &created); err != nil || r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d, %v\n", 200, r.StatusCode, err)
+	}
+
+	flight := fmt.Sprintf("%s/%d", flights, created.ID)
+
+	operator.Headers.Set("X-Request-Id", "audit-fare")
+	testRequest(t, "PUT", flight, `{"fare": 200}`, operator)
+	operator.Headers.Del("X-Request-Id")
+
+	testRequest(t, "POST", flight+"/status", `{"status": "boarding"}`, operator)
+	testRequest(t, "DELETE", flight, "", operator)
+
+	// Entries are listed newest first with changed fields only
+	page := testAuditEntries(t, admin, fmt.Sprintf("resource=flight&id=%d", created.ID))
+
+	actions := []string{}
+	for _, e := range page.Entries {
+		actions = append(actions, e.Action)
+
+		if e.ActorID == nil || *e.ActorID != u.ID || e.Resource != models.AuditFlight || e.ResourceID != created.ID {
+			t.Fatalf("\nExpected flight %d change by %d\nObtained: %v\n", created.ID, u.ID, e)
+		}
+	}
+
+	if strings.Join(actions, ",") != "delete,update,update,create" {
+		t.Fatalf("\nExpected actions: delete,update,update,create\nObtained: %v\n", actions)
+	}
+
+	fare := page.Entries[2]
+
+	if c, ok := fare.Changes["fare"]; !ok || string(c.Before) != "100" || string(c.After) != "200" || fare.RequestID != "audit-fare" {
+		t.Fatalf("\nExpected fare change 100 -> 200 by request audit-fare\nObtained: %v, %s\n", fare.Changes, fare.RequestID)
+	}
+
+	if _, ok := fare.Changes["name"]; ok {
+		t.Fatalf("\nExpected unchanged name to be omitted\nObtained: %v\n", fare.Changes)
+	}
+
+	if c := page.Entries[1].Changes["status"]; string(c.After) != `"boarding"` {
+		t.Fatalf("\nExpected status change to boarding\nObtained: %v\n", page.Entries[1].Changes)
+	}
+
+	if c := page.Entries[3].Changes["number"]; c.Before != nil || string(c.After) != `"AU100"` {
+		t.Fatalf("\nExpected created number\nObtained: %v\n", page.Entries[3].Changes)
+	}
+
+	// Filters and pages
+	page = testAuditEntries(t, admin, fmt.Sprintf("resource=flight&id=%d&action=update&limit=1", created.ID))
+
+	if len(page.Entries) != 1 || page.NextCursor == "" || page.Entries[0].Changes["status"].After == nil {
+		t.Fatalf("\nExpected status update and next page\nObtained: %v\n", page)
+	}
+
+	page = testAuditEntries(t, admin, fmt.Sprintf("resource=flight&id=%d&action=update&limit=1&cursor=%s", created.ID, page.NextCursor))
+
+	if len(page.Entries) != 1 || page.Entries[0].RequestID != "audit-fare" {
+		t.Fatalf("\nExpected fare update\nObtained: %v\n", page)
+	}
+
+	page = testAuditEntries(t, admin, fmt.Sprintf("actor=%d&from=2000-01-01&to=2000-01-02", u.ID))
+
+	if len(page.Entries) != 0 {
+		t.Fatalf("\nExpected no entries\nObtained: %v\n", page.Entries)
+	}
+
+	// Registration is recorded without password and actor
+	r = testRequest(t, "POST", "http://"+listenOn+"/users", `{"name": "audit-viewer", "password": "audit-secret"}`, nil)
+	registered := models.User{}
+
+	if err := helpers.Decode(r.Body, &registered); err != nil || r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d, %v\n", 200, r.StatusCode, err)
+	}
+
+	page = testAuditEntries(t, admin, fmt.Sprintf("resource=user&id=%d", registered.ID))
+
+	if len(page.Entries) != 1 || page.Entries[0].ActorID != nil || page.Entries[0].Action != models.AuditCreate {
+		t.Fatalf("\nExpected anonymous user creation\nObtained: %v\n", page.Entries)
+	}
+
+	if _, ok := page.Entries[0].Changes["password"]; ok || page.Entries[0].Changes["name"].After == nil {
+		t.Fatalf("\nExpected name without password\nObtained: %v\n", page.Entries[0].Changes)
+	}
+
+	for _, tc := range []struct {
+		query  string
+		fields []string
+	}{
+		{"resource=booking", []string{"resource"}},
+		{"id=1", []string{"id"}},
+		{"action=read&actor=x&limit=0&cursor=x", []string{"action", "actor", "limit", "cursor"}},
+		{"from=2021-04-02&to=2021-04-01", []string{"to"}},
+	} {
+		r = testRequest(t, "GET", "http://"+listenOn+"/audit?"+tc.query, "", admin)
+		testProblem(t, r, 400, problem.CodeValidation, tc.fields...)
+	}
+
+	r = testRequest(t, "GET", "http://"+listenOn+"/audit", "", operator)
+	testProblem(t, r, 403, "insufficient_role")
+
+	// Other organizations don't see entries
+	partner := models.Organization{Name: "Audit Partner"}
+
+	if err := stores.Organizations.Create(&partner); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	partnerAdmin := &models.User{Name: "audit-partner", Password: "audit-partner", Role: models.RoleAdmin}
+
+	if err := partnerAdmin.HashPassword(); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if err := stores.Users.Tenant(partner.ID).Create(partnerAdmin); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	cfg := &rpc.Config{Headers: make(http.Header)}
+	cfg.Headers.Set("Authorization", "Bearer "+testLogin(t, "audit-partner", "audit-partner").Token)
+
+	if page = testAuditEntries(t, cfg, fmt.Sprintf("resource=flight&id=%d", created.ID)); len(page.Entries) != 0 {
+		t.Fatalf("\nExpected no entries of other organization\nObtained: %v\n", page.Entries)
+	}
+
+	// Chain of all entries is intact
+	if n, err := stores.Audit.Verify(); err != nil || n < 5 {
+		t.Fatalf("\nExpected intact audit log\nObtained: %d entries, %v\n", n, err)
+	}
+}
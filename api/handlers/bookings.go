@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	m "github.com/3d0c/sample-api/api/middleware"
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// CodeNotBookingOwner is returned when user cancels booking of another user
+const CodeNotBookingOwner = "not_booking_owner"
+
+type bookingsHandler struct {
+	store   models.BookingStore
+	flights models.FlightStore
+}
+
+func bookings(store models.BookingStore, flights models.FlightStore) *bookingsHandler {
+	return &bookingsHandler{store: store, flights: flights}
+}
+
+func bookingID(ps httprouter.Params) (uint, error) {
+	id, err := strconv.ParseUint(ps.ByName("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, problem.BadRequest("invalid_id", "booking id must be a positive integer")
+	}
+
+	return uint(id), nil
+}
+
+type seatsView struct {
+	Cabin     models.Cabin `json:"cabin"`
+	Capacity  int          `json:"capacity"`
+	Booked    int          `json:"booked"`
+	Available int          `json:"available"`
+}
+
+// flight returns flight from path, flights of other organizations are
+// not found
+func (h *bookingsHandler) flight(r *http.Request, ps httprouter.Params) (*models.Flight, error) {
+	fid, err := flightID(ps)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.flights.Tenant(m.OrganizationID(r.Context())).Get(fid)
+}
+
+func (h *bookingsHandler) writeSeats(w http.ResponseWriter, fid uint) (int, error) {
+	seats, err := h.store.Seats(fid)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	result := make([]seatsView, len(seats))
+	for i, s := range seats {
+		result[i] = seatsView{Cabin: s.Cabin, Capacity: s.Capacity, Booked: s.Booked, Available: s.Available()}
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
+
+func (h *bookingsHandler) seats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	f, err := h.flight(r, ps)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	return h.writeSeats(w, f.ID)
+}
+
+func (h *bookingsHandler) setSeats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		capacity map[models.Cabin]int
+		f        *models.Flight
+		err      error
+	)
+
+	if f, err = h.flight(r, ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = authorizeFlight(r, f); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	if err = helpers.Decode(r.Body, &capacity); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if err = models.ValidateCapacity(capacity); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = h.store.SetCapacity(f.ID, capacity); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return h.writeSeats(w, f.ID)
+}
+
+func (h *bookingsHandler) book(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		b   models.Booking
+		f   *models.Flight
+		err error
+	)
+
+	if err = helpers.Decode(r.Body, &b); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if err = b.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if f, err = h.flight(r, ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	b.FlightID = f.ID
+
+	b.UserID, _ = m.UserID(r.Context())
+
+	if err = h.store.Book(&b); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(b)
+
+	return http.StatusOK, nil
+}
+
+// cancel cancels own booking, operators can cancel any booking of their
+// organization flights
+func (h *bookingsHandler) cancel(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		b   *models.Booking
+		bid uint
+		err error
+	)
+
+	if bid, err = bookingID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if b, err = h.store.Find(bid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Bookings of other organization flights are not found
+	if _, err = h.flights.Tenant(m.OrganizationID(r.Context())).Get(int(b.FlightID)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	uid, _ := m.UserID(r.Context())
+
+	if b.UserID != uid && !m.Role(r.Context()).Includes(models.RoleOperator) {
+		return http.StatusForbidden, problem.Forbidden(CodeNotBookingOwner, "booking belongs to another user")
+	}
+
+	if b, err = h.store.Cancel(bid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(b)
+
+	return http.StatusOK, nil
+}
+
+// mine lists bookings of authenticated user, optionally filtered by status
+func (h *bookingsHandler) mine(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		filter models.BookingFilter
+		result []models.Booking
+		err    error
+	)
+
+	filter.UserID, _ = m.UserID(r.Context())
+
+	switch status := models.BookingStatus(r.URL.Query().Get("status")); status {
+	case "", models.BookingConfirmed, models.BookingCancelled:
+		filter.Status = status
+	default:
+		var v problem.Validation
+		v.Add("status", "invalid", "status must be confirmed or cancelled")
+		return http.StatusBadRequest, v.Err()
+	}
+
+	if result, err = h.store.List(filter); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
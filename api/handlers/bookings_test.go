@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+// testBookableFlight creates flight with given capacity directly in stores
+func testBookableFlight(t *testing.T, number string, capacity map[models.Cabin]int) uint {
+	f := models.Flight{Name: "booking", Number: number, Destination: "Booking", Fare: 100, Duration: 60}
+
+	if err := stores.Flights.Create(&f); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if err := stores.Bookings.SetCapacity(f.ID, capacity); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	return f.ID
+}
+
+func testBook(t *testing.T, cfg *rpc.Config, flightID uint, payload string) (int, models.Booking) {
+	endpoint := fmt.Sprintf("http://%s/flights/%d/bookings", listenOn, flightID)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	b := models.Booking{}
+
+	if r.StatusCode == 200 {
+		if err := helpers.Decode(r.Body, &b); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+	}
+
+	return r.StatusCode, b
+}
+
+func TestBookings(t *testing.T) {
+	var (
+		operator = testAuth(t, "booking_operator", models.RoleOperator)
+		owner    = testAuth(t, "booking_owner", models.RoleViewer)
+		other    = testAuth(t, "booking_other", models.RoleViewer)
+	)
+
+	f := models.Flight{Name: "booking", Number: "BK1", Destination: "Booking", Fare: 100, Duration: 60}
+
+	if err := stores.Flights.Create(&f); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	seats := fmt.Sprintf("http://%s/flights/%d/seats", listenOn, f.ID)
+
+	r, err := rpc.Request("PUT", seats, []byte(`{"economy": 3, "business": 1}`), owner)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", seats, err)
+	}
+
+	if r.StatusCode != 403 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 403, r.StatusCode)
+	}
+
+	r, err = rpc.Request("PUT", seats, []byte(`{"economy": 3, "business": 1, "cargo": 1}`), operator)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", seats, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "cargo")
+
+	r, err = rpc.Request("PUT", seats, []byte(`{"economy": 3, "business": 1}`), operator)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", seats, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	status, booking := testBook(t, owner, f.ID, `{"cabin": "economy", "seats": 2}`)
+	if status != 200 || booking.Status != models.BookingConfirmed || booking.Seats != 2 {
+		t.Fatalf("\nExpected confirmed booking\nObtained: %d, %v\n", status, booking)
+	}
+
+	if status, _ = testBook(t, other, f.ID, `{"cabin": "economy", "seats": 2}`); status != 409 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 409, status)
+	}
+
+	if status, _ = testBook(t, other, f.ID, `{"cabin": "first", "seats": 1}`); status != 409 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 409, status)
+	}
+
+	// Capacity can't be less than booked seats
+	r, err = rpc.Request("PUT", seats, []byte(`{"economy": 1}`), operator)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", seats, err)
+	}
+
+	testProblem(t, r, 409, "capacity_below_booked")
+
+	// Flight with confirmed bookings can't be removed
+	endpoint := fmt.Sprintf("http://%s/flights/%d", listenOn, f.ID)
+
+	r, err = rpc.Request("DELETE", endpoint, nil, operator)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 409, "flight_has_bookings")
+
+	// Refused deletion is rolled back
+	if cur, err := stores.Flights.Get(int(f.ID)); err != nil || cur.Version != f.Version {
+		t.Fatalf("\nExpected live flight of version %d\nObtained: %v, %v\n", f.Version, cur, err)
+	}
+
+	// Only owner or operator can cancel
+	endpoint = fmt.Sprintf("http://%s/bookings/%d", listenOn, booking.ID)
+
+	r, err = rpc.Request("DELETE", endpoint, nil, other)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 403, CodeNotBookingOwner)
+
+	r, err = rpc.Request("DELETE", endpoint, nil, owner)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	r, err = rpc.Request("DELETE", endpoint, nil, owner)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 409, "booking_cancelled")
+
+	// Cancellation releases seats
+	if status, _ = testBook(t, other, f.ID, `{"cabin": "economy", "seats": 3}`); status != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, status)
+	}
+
+	endpoint = fmt.Sprintf("http://%s/users/me/bookings", listenOn)
+
+	r, err = rpc.Request("GET", endpoint, nil, owner)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	mine := []models.Booking{}
+
+	if err := helpers.Decode(r.Body, &mine); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(mine) != 1 || mine[0].ID != booking.ID || mine[0].Status != models.BookingCancelled || mine[0].CancelledAt == nil {
+		t.Fatalf("\nExpected cancelled booking %d\nObtained: %v\n", booking.ID, mine)
+	}
+}
+
+func TestConcurrentBookings(t *testing.T) {
+	const (
+		capacity = 5
+		requests = 20
+	)
+
+	var (
+		cfg    = testAuth(t, "booking_rush", models.RoleViewer)
+		fid    = testBookableFlight(t, "BK2", map[models.Cabin]int{models.CabinEconomy: capacity})
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		status = make(map[int]int)
+	)
+
+	endpoint := fmt.Sprintf("http://%s/flights/%d/bookings", listenOn, fid)
+
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			code := 0
+
+			r, err := rpc.Request("POST", endpoint, []byte(`{"cabin": "economy", "seats": 1}`), cfg)
+			if err == nil {
+				code = r.StatusCode
+			}
+
+			mu.Lock()
+			status[code]++
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if status[200] != capacity || status[409] != requests-capacity {
+		t.Fatalf("\nExpected %d booked and %d sold out\nObtained: %v\n", capacity, requests-capacity, status)
+	}
+
+	seats, err := stores.Bookings.Seats(fid)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(seats) != 1 || seats[0].Booked != capacity {
+		t.Fatalf("\nExpected booked: %d\nObtained: %v\n", capacity, seats)
+	}
+}
+
+func TestBookClosedFlight(t *testing.T) {
+	var (
+		cfg      = testAuth(t, "booking_closed", models.RoleViewer)
+		capacity = map[models.Cabin]int{models.CabinEconomy: 5}
+		closed   = testBookableFlight(t, "BK3", capacity)
+		deleted  = testBookableFlight(t, "BK4", capacity)
+	)
+
+	if _, err := stores.Flights.SetStatus(int(closed), &models.StatusChange{To: models.StatusCancelled}); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	status, _ := testBook(t, cfg, closed, `{"cabin": "economy", "seats": 1}`)
+	if status != 409 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 409, status)
+	}
+
+	if err := stores.Flights.Delete(int(deleted), 0, 0); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	// Store checks flight itself, it may be changed since handler read it
+	for fid, expected := range map[uint]error{closed: models.ErrFlightClosed, deleted: models.ErrNotFound} {
+		b := models.Booking{FlightID: fid, Cabin: models.CabinEconomy, Seats: 1}
+
+		if err := stores.Bookings.Book(&b); err != expected {
+			t.Fatalf("\nExpected: %v\nObtained: %v\n", expected, err)
+		}
+	}
+
+	for _, fid := range []uint{closed, deleted} {
+		seats, err := stores.Bookings.Seats(fid)
+		if err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		if len(seats) != 1 || seats[0].Booked != 0 {
+			t.Fatalf("\nExpected booked: %d\nObtained: %v\n", 0, seats)
+		}
+	}
+}
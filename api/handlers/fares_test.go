@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+// testFlightByNumber searches for a single flight by number
+func testFlightByNumber(t *testing.T, cfg *rpc.Config, number string, query string) models.Flight {
+	endpoint := fmt.Sprintf("http://%s/flights?number=%s&%s", listenOn, number, query)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	page := testFlightsPage{}
+
+	if err := helpers.Decode(r.Body, &page); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(page.Flights) != 1 {
+		t.Fatalf("\nExpected flight %s\nObtained: %v\n", number, page.Flights)
+	}
+
+	return page.Flights[0]
+}
+
+func TestFareClasses(t *testing.T) {
+	var (
+		cfg      = testAuth(t, "fares", models.RoleOperator)
+		endpoint = "http://" + listenOn + "/flights"
+		times    = `"departure": "2021-04-01T09:00:00Z", "arrival": "2021-04-01T10:00:00Z", "destination": "Fares"`
+	)
+
+	payload := `{"name": "fares", "number": "FC100", "currency": "xxx", ` + times + `,
+		"fare_classes": [{"code": "Y", "fare": 12000}, {"code": "y", "fare": 0, "cabin": "cargo"}]}`
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "currency", "fare_classes[1].code", "fare_classes[1].cabin", "fare_classes[1].fare")
+
+	payload = `{"name": "fares", "number": "FC100", "currency": "eur", ` + times + `,
+		"fare_classes": [
+			{"code": "j", "cabin": "business", "fare": 45000, "refundable": true, "baggage_kg": 32},
+			{"code": "y", "fare": 12000}
+		]}`
+
+	if r, err = rpc.Request("POST", endpoint, []byte(payload), cfg); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	created := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &created); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	// Flight fare is the lowest one, classes are ordered by fare
+	expected := []models.FareClass{
+		{Code: "Y", Cabin: models.CabinEconomy, Fare: 12000},
+		{Code: "J", Cabin: models.CabinBusiness, Fare: 45000, Refundable: true, BaggageKg: 32},
+	}
+
+	obtained := testFlightByNumber(t, cfg, "FC100", "")
+
+	if obtained.Fare != 12000 || obtained.Currency != "EUR" || !reflect.DeepEqual(obtained.FareClasses, expected) {
+		t.Fatalf("\nExpected: 12000 EUR %v\nObtained: %d %s %v\n", expected, obtained.Fare, obtained.Currency, obtained.FareClasses)
+	}
+
+	// 1 USD is 0.9 EUR or 150 JPY
+	for _, tc := range []struct {
+		currency string
+		fares    []int64
+	}{
+		{"usd", []int64{13333, 13333, 50000}},
+		{"JPY", []int64{20000, 20000, 75000}},
+	} {
+		obtained = testFlightByNumber(t, cfg, "FC100", "currency="+tc.currency)
+		fares := []int64{obtained.Fare, obtained.FareClasses[0].Fare, obtained.FareClasses[1].Fare}
+
+		if !reflect.DeepEqual(fares, tc.fares) {
+			t.Fatalf("\nExpected %s fares: %v\nObtained: %v %s\n", tc.currency, tc.fares, fares, obtained.Currency)
+		}
+	}
+
+	r, err = rpc.Request("GET", endpoint+"?currency=GBP", nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "currency")
+
+	// Fare of flight with classes can't be changed alone
+	update := fmt.Sprintf("%s/%d", endpoint, created.ID)
+
+	for _, tc := range []struct {
+		payload string
+		status  int
+		fare    int64
+		classes int
+	}{
+		{`{"fare": 9000}`, 400, 12000, 2},
+		{`{"fare_classes": [{"code": "Y", "fare": 11000}]}`, 200, 11000, 1},
+		{`{"fare_classes": []}`, 400, 11000, 1},
+		{`{"fare_classes": [], "fare": 9000}`, 200, 9000, 0},
+	} {
+		if r, err = rpc.Request("PUT", update, []byte(tc.payload), cfg); err != nil {
+			t.Fatalf("Error requesting %s - %s\n", update, err)
+		}
+
+		if r.StatusCode != tc.status {
+			t.Fatalf("\nExpected %s status code: %d\nObtained: %d\n", tc.payload, tc.status, r.StatusCode)
+		}
+
+		obtained = testFlightByNumber(t, cfg, "FC100", "")
+
+		if obtained.Fare != tc.fare || len(obtained.FareClasses) != tc.classes || obtained.Currency != "EUR" {
+			t.Fatalf("\nExpected after %s: %d EUR, %d classes\nObtained: %d %s, %v\n",
+				tc.payload, tc.fare, tc.classes, obtained.Fare, obtained.Currency, obtained.FareClasses)
+		}
+	}
+}
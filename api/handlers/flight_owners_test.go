@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+func TestFlightOwners(t *testing.T) {
+	var (
+		owner    = testAuth(t, "owners-owner", models.RoleOperator)
+		other    = testAuth(t, "owners-other", models.RoleOperator)
+		admin    = testAuth(t, "owners-admin", models.RoleAdmin)
+		endpoint = "http://" + listenOn + "/flights"
+		payload  = `{"name": "owners", "number": "OW100", "fare": 100, "destination": "Owners",
+			"departure": "2021-04-01T09:00:00Z", "arrival": "2021-04-01T10:00:00Z", "created_by": 1000}`
+	)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), owner)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	created := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &created); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	u, err := stores.Users.FindByName("owners-owner")
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	// Owner is the caller, not the one from payload
+	if created.CreatedBy == nil || *created.CreatedBy != u.ID {
+		t.Fatalf("\nExpected owner: %d\nObtained: %v\n", u.ID, created.CreatedBy)
+	}
+
+	flight := fmt.Sprintf("%s/%d", endpoint, created.ID)
+
+	// Other operators can't change the flight
+	for _, tc := range []struct {
+		method   string
+		endpoint string
+		payload  string
+	}{
+		{"PUT", flight, `{"fare": 200}`},
+		{"PATCH", flight, `{"fare": 200}`},
+		{"POST", flight + "/status", `{"status": "boarding"}`},
+		{"PUT", flight + "/seats", `{"economy": 10}`},
+		{"DELETE", flight, ""},
+	} {
+		var body []byte
+		if tc.payload != "" {
+			body = []byte(tc.payload)
+		}
+
+		if r, err = rpc.Request(tc.method, tc.endpoint, body, other); err != nil {
+			t.Fatalf("Error requesting %s - %s\n", tc.endpoint, err)
+		}
+
+		testProblem(t, r, 403, "not_flight_owner")
+	}
+
+	// Owner and admins can
+	for _, cfg := range []*rpc.Config{owner, admin} {
+		if r, err = rpc.Request("PATCH", flight, []byte(`{"fare": 300}`), cfg); err != nil {
+			t.Fatalf("Error requesting %s - %s\n", flight, err)
+		}
+
+		if r.StatusCode != 200 {
+			t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+		}
+	}
+
+	if r, err = rpc.Request("PUT", flight, []byte(`{"fare": 400, "created_by": 1000}`), admin); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", flight, err)
+	}
+
+	updated := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &updated); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if updated.CreatedBy == nil || *updated.CreatedBy != u.ID || updated.UpdatedBy == nil || *updated.UpdatedBy == u.ID {
+		t.Fatalf("\nExpected owner: %d, updated by admin\nObtained: %v, %v\n", u.ID, updated.CreatedBy, updated.UpdatedBy)
+	}
+
+	for _, tc := range []struct {
+		cfg     *rpc.Config
+		query   string
+		status  int
+		flights int
+	}{
+		{owner, "&mine=true", 200, 1},
+		{owner, "&mine=false", 200, 1},
+		{other, "&mine=true", 200, 0},
+		{other, "", 200, 1},
+		{other, "&mine=maybe", 400, 0},
+	} {
+		search := endpoint + "?number=OW100" + tc.query
+
+		if r, err = rpc.Request("GET", search, nil, tc.cfg); err != nil {
+			t.Fatalf("Error requesting %s - %s\n", search, err)
+		}
+
+		if tc.status != 200 {
+			testProblem(t, r, tc.status, problem.CodeValidation, "mine")
+			continue
+		}
+
+		page := testFlightsPage{}
+
+		if err := helpers.Decode(r.Body, &page); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		if len(page.Flights) != tc.flights {
+			t.Fatalf("\nExpected %s flights: %d\nObtained: %v\n", search, tc.flights, page.Flights)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+func TestFlightStatus(t *testing.T) {
+	var (
+		cfg    = testAuth(t, "status_operator", models.RoleOperator)
+		viewer = testAuth(t, "status_viewer", models.RoleViewer)
+		fid    = testBookableFlight(t, "ST1", map[models.Cabin]int{models.CabinEconomy: 10})
+	)
+
+	endpoint := fmt.Sprintf("http://%s/flights/%d/status", listenOn, fid)
+
+	r, err := rpc.Request("POST", endpoint, []byte(`{"status": "boarding"}`), viewer)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 403 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 403, r.StatusCode)
+	}
+
+	// Delay requires reason and estimated departure
+	r, err = rpc.Request("POST", endpoint, []byte(`{"status": "delayed"}`), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "reason", "time")
+
+	steps := []struct {
+		payload string
+		status  models.FlightStatus
+	}{
+		{`{"status": "delayed", "reason": "weather", "time": "2021-04-01T11:00:00+03:00"}`, models.StatusDelayed},
+		{`{"status": "boarding"}`, models.StatusBoarding},
+		{`{"status": "departed", "time": "2021-04-01T08:10:00Z"}`, models.StatusDeparted},
+		{`{"status": "landed", "time": "2021-04-01T09:20:00Z"}`, models.StatusLanded},
+	}
+
+	for _, step := range steps {
+		r, err = rpc.Request("POST", endpoint, []byte(step.payload), cfg)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+		}
+
+		if r.StatusCode != 200 {
+			t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+		}
+
+		obtained := models.Flight{}
+
+		if err := helpers.Decode(r.Body, &obtained); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		if obtained.Status != step.status {
+			t.Fatalf("\nExpected status: %s\nObtained: %s\n", step.status, obtained.Status)
+		}
+	}
+
+	f, err := stores.Flights.Get(int(fid))
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if f.EstimatedDeparture == nil || f.EstimatedDeparture.Format("15:04") != "08:00" ||
+		f.ActualDeparture == nil || f.ActualArrival == nil || f.ActualArrival.Sub(*f.ActualDeparture).Minutes() != 70 {
+		t.Fatalf("Unexpected flight times - %v, %v, %v\n", f.EstimatedDeparture, f.ActualDeparture, f.ActualArrival)
+	}
+
+	// Landed flight is final
+	r, err = rpc.Request("POST", endpoint, []byte(`{"status": "boarding"}`), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 409, models.CodeIllegalTransition)
+
+	// and can't be booked
+	if status, _ := testBook(t, viewer, fid, `{"cabin": "economy", "seats": 1}`); status != 409 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 409, status)
+	}
+
+	endpoint = fmt.Sprintf("http://%s/flights/%d/status/history", listenOn, fid)
+
+	r, err = rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	history := []models.StatusChange{}
+
+	if err := helpers.Decode(r.Body, &history); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(history) != len(steps) {
+		t.Fatalf("\nExpected history records: %d\nObtained: %v\n", len(steps), history)
+	}
+
+	if history[0].From != models.StatusScheduled || history[0].Reason != "weather" || history[0].UserID == 0 {
+		t.Fatalf("Unexpected history record - %v\n", history[0])
+	}
+
+	for i := 1; i < len(history); i++ {
+		if history[i].From != history[i-1].To {
+			t.Fatalf("\nExpected from: %s\nObtained: %s\n", history[i-1].To, history[i].From)
+		}
+	}
+
+	endpoint = fmt.Sprintf("http://%s/flights?status=landed&number=ST1", listenOn)
+
+	r, err = rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	page := testFlightsPage{}
+
+	if err := helpers.Decode(r.Body, &page); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(page.Flights) != 1 || page.Flights[0].ID != fid {
+		t.Fatalf("\nExpected landed flight: %d\nObtained: %v\n", fid, page.Flights)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	m "github.com/3d0c/sample-api/api/middleware"
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+func TestFlightTrash(t *testing.T) {
+	var (
+		operator = testAuth(t, "trash-operator", models.RoleOperator)
+		admin    = testAuth(t, "trash-admin", models.RoleAdmin)
+		endpoint = "http://" + listenOn + "/flights"
+		payload  = `{"name": "trash", "number": "TR100", "fare": 100, "destination": "Trash",
+			"departure": "2021-04-01T09:00:00Z", "arrival": "2021-04-01T10:00:00Z"}`
+	)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), operator)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	created := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &created); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	flight := fmt.Sprintf("%s/%d", endpoint, created.ID)
+
+	if r, err = rpc.Request("DELETE", flight, nil, operator); err != nil || r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %v, %v\n", 200, r, err)
+	}
+
+	// Deleted flight is neither found nor listed
+	if r, err = rpc.Request("GET", flight, nil, operator); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", flight, err)
+	}
+
+	testProblem(t, r, 404, problem.CodeNotFound)
+
+	for _, tc := range []struct {
+		cfg     *rpc.Config
+		query   string
+		status  int
+		flights int
+	}{
+		{operator, "", 200, 0},
+		{operator, "&deleted=only", 403, 0},
+		{admin, "", 200, 0},
+		{admin, "&deleted=only", 200, 1},
+		{admin, "&deleted=include", 200, 1},
+		{admin, "&deleted=yes", 400, 0},
+	} {
+		search := endpoint + "?number=TR100" + tc.query
+
+		if r, err = rpc.Request("GET", search, nil, tc.cfg); err != nil {
+			t.Fatalf("Error requesting %s - %s\n", search, err)
+		}
+
+		if r.StatusCode != tc.status {
+			t.Fatalf("\nExpected %s status code: %d\nObtained: %d\n", search, tc.status, r.StatusCode)
+		}
+
+		if r.StatusCode != 200 {
+			continue
+		}
+
+		page := testFlightsPage{}
+
+		if err := helpers.Decode(r.Body, &page); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		if len(page.Flights) != tc.flights {
+			t.Fatalf("\nExpected %s flights: %d\nObtained: %v\n", search, tc.flights, page.Flights)
+		}
+
+		if tc.flights != 0 && (page.Flights[0].DeletedAt == nil || page.Flights[0].DeletedBy == nil) {
+			t.Fatalf("\nExpected deletion time and user\nObtained: %v, %v\n", page.Flights[0].DeletedAt, page.Flights[0].DeletedBy)
+		}
+	}
+
+	// Flights are restored by admins only
+	restore := flight + "/restore"
+
+	if r, err = rpc.Request("POST", restore, nil, operator); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", restore, err)
+	}
+
+	testProblem(t, r, 403, m.CodeInsufficientRole)
+
+	if r, err = rpc.Request("POST", restore, nil, admin); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", restore, err)
+	}
+
+	restored := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &restored); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if r.StatusCode != 200 || restored.DeletedAt != nil || restored.Version != created.Version+2 {
+		t.Fatalf("\nExpected status code: %d, version: %d\nObtained: %d, %v\n", 200, created.Version+2, r.StatusCode, restored)
+	}
+
+	if r, err = rpc.Request("POST", restore, nil, admin); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", restore, err)
+	}
+
+	testProblem(t, r, 409, "flight_not_deleted")
+
+	// Retention job purges flights deleted before cutoff only
+	if r, err = rpc.Request("DELETE", flight, nil, operator); err != nil || r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %v, %v\n", 200, r, err)
+	}
+
+	if purged, err := stores.Flights.PurgeDeleted(time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	} else if f := testFlightByNumber(t, admin, "TR100", "deleted=only"); len(purged) != 0 || f.ID != created.ID {
+		t.Fatalf("\nExpected flight %d to be kept\nObtained: %d purged\n", created.ID, len(purged))
+	}
+
+	purged, err := stores.Flights.PurgeDeleted(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	found := false
+	for _, f := range purged {
+		found = found || (f.ID == created.ID && f.DeletedAt != nil)
+	}
+
+	if !found {
+		t.Fatalf("\nExpected purged flight %d\nObtained: %v\n", created.ID, purged)
+	}
+
+	if r, err = rpc.Request("POST", restore, nil, admin); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", restore, err)
+	}
+
+	testProblem(t, r, 404, problem.CodeNotFound)
+}
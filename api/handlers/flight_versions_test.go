@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+// testConditional sends request with conditional header
+func testConditional(t *testing.T, cfg *rpc.Config, method, endpoint, payload, header, tag string) *http.Response {
+	c := *cfg
+	c.Headers = cfg.Headers.Clone()
+	c.Headers.Set(header, tag)
+
+	var body []byte
+	if payload != "" {
+		body = []byte(payload)
+	}
+
+	r, err := rpc.Request(method, endpoint, body, &c)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	return r
+}
+
+func TestFlightVersions(t *testing.T) {
+	var (
+		cfg      = testAuth(t, "versions", models.RoleOperator)
+		endpoint = "http://" + listenOn + "/flights"
+		payload  = `{"name": "versions", "number": "VR100", "fare": 100, "destination": "Versions",
+			"departure": "2021-04-01T09:00:00Z", "arrival": "2021-04-01T10:00:00Z"}`
+	)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 || r.Header.Get("ETag") != `"1"` {
+		t.Fatalf("\nExpected status code: %d, ETag: %s\nObtained: %d, %s\n", 200, `"1"`, r.StatusCode, r.Header.Get("ETag"))
+	}
+
+	f := testFlightByNumber(t, cfg, "VR100", "")
+	flight := fmt.Sprintf("%s/%d", endpoint, f.ID)
+
+	// Search results are not modified until flight is updated
+	search := endpoint + "?number=VR100"
+
+	r = testConditional(t, cfg, "GET", search, "", "If-None-Match", "")
+	etag := r.Header.Get("ETag")
+
+	if r.StatusCode != 200 || etag == "" {
+		t.Fatalf("\nExpected status code: %d with ETag\nObtained: %d, %s\n", 200, r.StatusCode, etag)
+	}
+
+	r = testConditional(t, cfg, "GET", search, "", "If-None-Match", etag)
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if r.StatusCode != 304 || len(body) != 0 {
+		t.Fatalf("\nExpected status code: %d without body\nObtained: %d, %s\n", 304, r.StatusCode, body)
+	}
+
+	for _, tc := range []struct {
+		method  string
+		payload string
+		tag     string
+		status  int
+		etag    string
+	}{
+		{"PUT", `{"fare": 200}`, `"1"`, 200, `"2"`},
+		// Stale, weak and malformed tags never match
+		{"PUT", `{"fare": 300}`, `"1"`, 412, ""},
+		{"PUT", `{"fare": 300}`, `W/"2"`, 412, ""},
+		{"PUT", `{"fare": 300}`, `2`, 412, ""},
+		{"DELETE", "", `"1"`, 412, ""},
+		// Unconditional update
+		{"PUT", `{"fare": 300}`, "", 200, `"3"`},
+		{"PUT", `{"fare": 400}`, "*", 200, `"4"`},
+	} {
+		r = testConditional(t, cfg, tc.method, flight, tc.payload, "If-Match", tc.tag)
+
+		if r.StatusCode != tc.status || r.Header.Get("ETag") != tc.etag {
+			t.Fatalf("\nExpected %s %s status code: %d, ETag: %s\nObtained: %d, %s\n",
+				tc.method, tc.tag, tc.status, tc.etag, r.StatusCode, r.Header.Get("ETag"))
+		}
+	}
+
+	if f = testFlightByNumber(t, cfg, "VR100", ""); f.Fare != 400 || f.Version != 4 {
+		t.Fatalf("\nExpected fare: %d, version: %d\nObtained: %d, %d\n", 400, 4, f.Fare, f.Version)
+	}
+
+	if r = testConditional(t, cfg, "GET", search, "", "If-None-Match", etag); r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	if r = testConditional(t, cfg, "DELETE", flight, "", "If-Match", `"4"`); r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+}
@@ -1,116 +1,634 @@
 package handlers
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 
+	m "github.com/3d0c/sample-api/api/middleware"
 	"github.com/3d0c/sample-api/api/models"
 	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
 )
 
 type flightsHandler struct {
-	*models.Flight
+	store    models.FlightStore
+	airports models.AirportStore
+	audit    models.AuditStore
+	rates    *models.Rates
 }
 
-func flights() *flightsHandler {
-	return &flightsHandler{Flight: &models.Flight{}}
+func flights(s *models.Stores, rates *models.Rates) *flightsHandler {
+	return &flightsHandler{store: s.Flights, airports: s.Airports, audit: s.Audit, rates: rates}
 }
 
-func (f *flightsHandler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+// tenant returns flights of the caller organization
+func (h *flightsHandler) tenant(r *http.Request) models.FlightStore {
+	return h.store.Tenant(m.OrganizationID(r.Context()))
+}
+
+// mergePatchType is a media type of JSON Merge Patch documents
+const mergePatchType = "application/merge-patch+json"
+
+func flightID(ps httprouter.Params) (int, error) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil || id <= 0 {
+		return 0, problem.BadRequest("invalid_id", "flight id must be a positive integer")
+	}
+
+	return id, nil
+}
+
+// flightETag is a strong entity tag of flight version, fares converted
+// to currency are another representation, e.g. "3-EUR"
+func flightETag(f *models.Flight, currency string) string {
+	if currency != "" {
+		return strconv.Quote(strconv.Itoa(f.Version) + "-" + currency)
+	}
+
+	return strconv.Quote(strconv.Itoa(f.Version))
+}
+
+// ifMatch returns flight version required by If-Match header, 0 if header
+// is not set or is "*". Tags of any currency match the same version.
+// Weak and malformed tags never match.
+func ifMatch(r *http.Request) (int, error) {
+	tag := strings.TrimSpace(r.Header.Get("If-Match"))
+	if tag == "" || tag == "*" {
+		return 0, nil
+	}
+
+	unquoted, err := strconv.Unquote(tag)
+	if err != nil || !strings.HasPrefix(tag, `"`) {
+		return 0, models.ErrVersionMismatch
+	}
+
+	if i := strings.IndexByte(unquoted, '-'); i != -1 {
+		unquoted = unquoted[:i]
+	}
+
+	version, err := strconv.Atoi(unquoted)
+	if err != nil || version <= 0 {
+		return 0, models.ErrVersionMismatch
+	}
+
+	return version, nil
+}
+
+// caller returns id of authenticated user, nil if it is unknown
+func caller(r *http.Request) *uint {
+	uid, ok := m.UserID(r.Context())
+	if !ok || uid == 0 {
+		return nil
+	}
+
+	return &uid
+}
+
+// authorizeFlight checks that authenticated user may change flight
+func authorizeFlight(r *http.Request, f *models.Flight) error {
+	uid, _ := m.UserID(r.Context())
+
+	if !f.CanModify(uid, m.Role(r.Context())) {
+		return models.ErrNotFlightOwner
+	}
+
+	return nil
+}
+
+func (h *flightsHandler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
 	var (
+		f   models.Flight
 		err error
 	)
 
 	if err = helpers.Decode(r.Body, &f); err != nil {
-		return http.StatusInternalServerError, err
+		return http.StatusBadRequest, problem.Malformed(err)
 	}
 
 	f.ID = 0
+	// Schedule instances are created by generator only
+	f.ScheduleID, f.ScheduleDate, f.Detached = nil, "", false
+	f.CreatedBy, f.UpdatedBy = caller(r), caller(r)
 
-	if err = f.Validate(); err != nil {
+	if err = f.Validate(h.airports); err != nil {
 		return http.StatusBadRequest, err
 	}
 
-	if err = f.Create(); err != nil {
+	if err = h.defaultDestination(&f); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.tenant(r).Create(&f); err != nil {
 		return http.StatusBadRequest, err
 	}
 
+	if err = record(h.audit, r, f.OrganizationID, models.AuditCreate, models.AuditFlight, f.ID, nil, &f); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return h.write(w, &f, "")
+}
+
+// defaultDestination sets destination to destination airport city if
+// it is empty
+func (h *flightsHandler) defaultDestination(f *models.Flight) error {
+	if f.Destination != "" || f.DestinationAirportID == nil {
+		return nil
+	}
+
+	a, err := h.airports.Find(*f.DestinationAirportID)
+	if err != nil {
+		return err
+	}
+
+	f.Destination = a.City
+
+	return nil
+}
+
+// write responds with flight and its ETag, fares are converted to
+// currency unless it is empty
+func (h *flightsHandler) write(w http.ResponseWriter, f *models.Flight, currency string) (int, error) {
+	if err := f.Localize(h.airports); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if currency != "" {
+		flights := []models.Flight{*f}
+
+		if err := h.rates.ConvertFlights(flights, currency); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		*f = flights[0]
+	}
+
+	w.Header().Set("ETag", flightETag(f, currency))
 	helpers.NewJsonResponder(w).Write(f)
 
 	return http.StatusOK, nil
 }
 
-func (f *flightsHandler) remove(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+func (h *flightsHandler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
 	var (
-		err error
-		fid int
+		f        *models.Flight
+		fid      int
+		err      error
+		currency = strings.ToUpper(r.URL.Query().Get("currency"))
 	)
 
-	if fid, err = strconv.Atoi(ps.ByName("id")); err != nil {
+	if fid, err = flightID(ps); err != nil {
 		return http.StatusBadRequest, err
 	}
 
-	if err = f.Delete(fid); err != nil {
+	if currency != "" && !h.rates.Supports(currency) {
+		var v problem.Validation
+		v.Add("currency", "unavailable", fmt.Sprintf("There is no exchange rate for '%s'", currency))
+		return http.StatusBadRequest, v.Err()
+	}
+
+	if f, err = h.tenant(r).Get(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return h.write(w, f, currency)
+}
+
+func (h *flightsHandler) remove(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		cur     *models.Flight
+		err     error
+		fid     int
+		version int
+	)
+
+	if fid, err = flightID(ps); err != nil {
 		return http.StatusBadRequest, err
 	}
 
+	if version, err = ifMatch(r); err != nil {
+		return http.StatusPreconditionFailed, err
+	}
+
+	if cur, err = h.tenant(r).Get(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = authorizeFlight(r, cur); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	uid, _ := m.UserID(r.Context())
+
+	if err = h.tenant(r).Delete(fid, version, uid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = record(h.audit, r, cur.OrganizationID, models.AuditDelete, models.AuditFlight, cur.ID, cur, nil); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
 	return http.StatusOK, nil
 }
 
-func (f *flightsHandler) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+// restore brings back deleted flight
+func (h *flightsHandler) restore(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
 	var (
-		err error
+		f   *models.Flight
 		fid int
+		err error
+	)
+
+	if fid, err = flightID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if f, err = h.tenant(r).Restore(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = record(h.audit, r, f.OrganizationID, models.AuditRestore, models.AuditFlight, f.ID, nil, f); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return h.write(w, f, "")
+}
+
+func (h *flightsHandler) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		f       models.Flight
+		cur     *models.Flight
+		err     error
+		fid     int
+		version int
 	)
 
-	if fid, err = strconv.Atoi(ps.ByName("id")); err != nil {
+	if fid, err = flightID(ps); err != nil {
 		return http.StatusBadRequest, err
 	}
 
+	if version, err = ifMatch(r); err != nil {
+		return http.StatusPreconditionFailed, err
+	}
+
 	if err = helpers.Decode(r.Body, &f); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if cur, err = h.tenant(r).Get(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = authorizeFlight(r, cur); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	if version != 0 && version != cur.Version {
+		return http.StatusPreconditionFailed, models.ErrVersionMismatch
+	}
+
+	var v problem.Validation
+
+	if err = v.Merge(f.ValidateTimesUpdate(cur)); err != nil {
 		return http.StatusInternalServerError, err
 	}
 
-	if err = f.Update(fid); err != nil {
+	if err = v.Merge(f.ValidatePricingUpdate(cur)); err != nil {
 		return http.StatusInternalServerError, err
 	}
 
-	return http.StatusOK, nil
+	if err = v.Merge(f.ValidateAirports(h.airports)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = v.Err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// Edited schedule instance is not regenerated anymore
+	f.ScheduleID, f.ScheduleDate, f.Detached = nil, "", true
+	f.Version = version
+	f.CreatedBy, f.UpdatedBy = nil, caller(r)
+
+	if err = h.tenant(r).Update(fid, &f); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	updated, err := h.tenant(r).Get(fid)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = record(h.audit, r, cur.OrganizationID, models.AuditUpdate, models.AuditFlight, cur.ID, cur, updated); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return h.write(w, updated, "")
 }
 
-func (f *flightsHandler) search(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+// patch applies JSON Merge Patch (RFC 7396) to flight. Unlike update it
+// can reset fields to zero values with null. Status and schedule fields
+// can't be patched.
+func (h *flightsHandler) patch(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
 	var (
-		name        string
-		scheduled   string
-		departure   string
-		destination string
-		search      map[string]interface{} = make(map[string]interface{})
+		f       models.Flight
+		cur     *models.Flight
+		body    []byte
+		fields  map[string]json.RawMessage
+		doc     []byte
+		v       problem.Validation
+		err     error
+		fid     int
+		version int
 	)
 
-	if name = r.URL.Query().Get("flight_name"); name != "" {
-		search["name"] = name
+	if fid, err = flightID(ps); err != nil {
+		return http.StatusBadRequest, err
 	}
 
-	if scheduled = r.URL.Query().Get("scheduled_date"); scheduled != "" {
-		search["scheduled"] = scheduled
+	if version, err = ifMatch(r); err != nil {
+		return http.StatusPreconditionFailed, err
 	}
 
-	if departure = r.URL.Query().Get("departure"); departure != "" {
-		search["departure"] = departure
+	if ct := r.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, "application/json") && !strings.HasPrefix(ct, mergePatchType) {
+		return http.StatusUnsupportedMediaType, problem.New(http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"patch must be "+mergePatchType+" or application/json document")
 	}
 
-	if destination = r.URL.Query().Get("destination"); destination != "" {
-		search["destination"] = destination
+	if body, err = ioutil.ReadAll(r.Body); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
 	}
 
-	flights, err := f.Find(search)
+	// Flight patch is always an object
+	if err = json.Unmarshal(body, &fields); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if cur, err = h.tenant(r).Get(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = authorizeFlight(r, cur); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	if version != 0 && version != cur.Version {
+		return http.StatusPreconditionFailed, models.ErrVersionMismatch
+	}
+
+	if doc, err = helpers.MergePatch(cur, body); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = json.Unmarshal(doc, &f); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	f.ID, f.Version = cur.ID, cur.Version
+	f.Status, f.EstimatedDeparture, f.ActualDeparture, f.ActualArrival =
+		cur.Status, cur.EstimatedDeparture, cur.ActualDeparture, cur.ActualArrival
+	// Edited schedule instance is not regenerated anymore
+	f.ScheduleID, f.ScheduleDate, f.Detached = cur.ScheduleID, cur.ScheduleDate, cur.ScheduleID != nil
+	f.CreatedBy, f.UpdatedBy = cur.CreatedBy, caller(r)
+
+	_, duration := fields["duration"]
+	_, departure := fields["departure"]
+	_, arrival := fields["arrival"]
+
+	// Duration is derived again if times are changed without it
+	if !duration && (departure || arrival) {
+		f.Duration = 0
+	}
+
+	_, fare := fields["fare"]
+	_, classes := fields["fare_classes"]
+
+	v.Check(!fare || classes || len(cur.FareClasses) == 0, "fare", "fare_classes",
+		"Fare of flight with fare classes is the lowest class fare, please update fare classes")
+
+	if err = v.Merge(f.Validate(h.airports)); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = v.Err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = h.defaultDestination(&f); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.tenant(r).Save(&f); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	updated, err := h.tenant(r).Get(fid)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = record(h.audit, r, cur.OrganizationID, models.AuditUpdate, models.AuditFlight, cur.ID, cur, updated); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return h.write(w, updated, "")
+}
+
+// setStatus changes flight status if transition is allowed
+func (h *flightsHandler) setStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		c   models.StatusChange
+		f   *models.Flight
+		fid int
+		err error
+	)
+
+	if fid, err = flightID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = helpers.Decode(r.Body, &c); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if err = c.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if f, err = h.tenant(r).Get(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = authorizeFlight(r, f); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	c.UserID, _ = m.UserID(r.Context())
+
+	updated, err := h.tenant(r).SetStatus(fid, &c)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
 
-	helpers.NewJsonResponder(w).Write(flights)
+	if err = record(h.audit, r, f.OrganizationID, models.AuditUpdate, models.AuditFlight, f.ID, f, updated); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return h.write(w, updated, "")
+}
+
+func (h *flightsHandler) history(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		history []models.StatusChange
+		fid     int
+		err     error
+	)
+
+	if fid, err = flightID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if _, err = h.tenant(r).Get(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if history, err = h.tenant(r).History(fid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(history)
 
 	return http.StatusOK, nil
 }
+
+type flightsPage struct {
+	Flights    interface{} `json:"flights"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+	Total      *int        `json:"total,omitempty"`
+}
+
+func (h *flightsHandler) search(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		search   models.Search
+		fields   []string
+		page     models.FlightPage
+		v        problem.Validation
+		err      error
+		currency = strings.ToUpper(r.URL.Query().Get("currency"))
+	)
+
+	search, err = models.ParseSearch(r.URL.Query())
+	if err = v.Merge(err); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if fields, err = flightFields(r.URL.Query().Get("fields")); err != nil {
+		v.Add("fields", "invalid", err.Error())
+	}
+
+	if currency != "" && !h.rates.Supports(currency) {
+		v.Add("currency", "unavailable", fmt.Sprintf("There is no exchange rate for '%s'", currency))
+	}
+
+	// Flights created by the caller only
+	if mine := r.URL.Query().Get("mine"); mine != "" {
+		if own, err := strconv.ParseBool(mine); err != nil {
+			v.Add("mine", "invalid", "mine must be true or false")
+		} else if uid, _ := m.UserID(r.Context()); own {
+			search.Owners = []uint{uid}
+		}
+	}
+
+	if err = v.Err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// Deleted flights are listed to admins only
+	if role := m.Role(r.Context()); search.Deleted != "" && !role.Includes(models.RoleAdmin) {
+		return http.StatusForbidden, problem.Forbidden(m.CodeInsufficientRole, "deleted flights are listed to admins only").
+			With("role", role).
+			With("required", models.RoleAdmin)
+	}
+
+	if page, err = h.tenant(r).Find(search); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = models.LocalizeFlights(page.Flights, h.airports); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	// Fares are shown in requested currency, sorting and fare filters
+	// still use fare_currency ones
+	if currency != "" {
+		if err = h.rates.ConvertFlights(page.Flights, currency); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	result := flightsPage{
+		Flights:    page.Flights,
+		NextCursor: page.NextCursor,
+		Total:      page.Total,
+	}
+
+	if fields != nil {
+		if result.Flights, err = helpers.Project(page.Flights, fields); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+
+	if page.NextCursor != "" {
+		next := *r.URL
+		nq := next.Query()
+		nq.Set("cursor", page.NextCursor)
+		next.RawQuery = nq.Encode()
+
+		w.Header().Add("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
+
+// flightFields parses comma separated list of flight fields to return.
+// Flight id is always returned. Nil means all fields.
+func flightFields(s string) ([]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	known, err := helpers.Keys(models.Flight{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{"id"}
+
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		found := false
+
+		for _, k := range known {
+			if strings.EqualFold(f, k) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown field '%s'", f)
+		}
+
+		result = append(result, f)
+	}
+
+	return result, nil
+}
@@ -3,13 +3,18 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/3d0c/sample-api/pkg/rpc"
 
+	"github.com/3d0c/sample-api/api/middleware"
 	"github.com/3d0c/sample-api/api/models"
 	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
 )
 
 func TestFlightFlow(t *testing.T) {
@@ -25,11 +30,11 @@ func testCreateFlight(t *testing.T) uint {
 	endpoint := "http://" + listenOn + "/flights"
 
 	expected := models.Flight{
-		Name:   "test",
-		Number: "AB123",
-		// Scheduled: time.Now(),
-		// Arrival:     time.Now().Add(time.Minute),
-		// Departure:   time.Now().Add(time.Minute),
+		Name:        "test",
+		Number:      "AB123",
+		Scheduled:   time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC),
+		Departure:   time.Date(2021, 4, 1, 9, 0, 0, 0, time.UTC),
+		Arrival:     time.Date(2021, 4, 1, 10, 0, 0, 0, time.UTC),
 		Destination: "Moscow",
 		Fare:        100,
 		Duration:    60,
@@ -61,6 +66,19 @@ func testCreateFlight(t *testing.T) uint {
 		expected.ID = obtained.ID
 	}
 
+	// Flight is owned by the user, who created it
+	if obtained.CreatedBy == nil || obtained.UpdatedBy == nil || *obtained.CreatedBy != *obtained.UpdatedBy {
+		t.Fatalf("\nExpected flight owner\nObtained: %v, %v\n", obtained.CreatedBy, obtained.UpdatedBy)
+	}
+
+	// New flights are always scheduled with the first version, fares are
+	// in default currency
+	expected.CreatedBy, expected.UpdatedBy = obtained.CreatedBy, obtained.UpdatedBy
+	expected.OrganizationID = models.DefaultOrganizationID
+	expected.Status = models.StatusScheduled
+	expected.Version = 1
+	expected.Currency = models.DefaultCurrency
+
 	if !reflect.DeepEqual(expected, obtained) {
 		t.Fatalf("\nExpected: %v\nObtained: %v\n", expected, obtained)
 	}
@@ -70,9 +88,19 @@ func testCreateFlight(t *testing.T) uint {
 
 func testUpdateFlight(t *testing.T, flightID uint) {
 	endpoint := fmt.Sprintf("http://%s/flights/%d", listenOn, flightID)
-	payload := `{"duration": 70}`
 
-	r, err := rpc.Request("PUT", endpoint, []byte(payload), rpcCfg)
+	// Duration must agree with departure and arrival
+	r, err := rpc.Request("PUT", endpoint, []byte(`{"duration": 70}`), rpcCfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 400 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 400, r.StatusCode)
+	}
+
+	// and is derived if arrival is changed without it
+	r, err = rpc.Request("PUT", endpoint, []byte(`{"arrival": "2021-04-01T13:10:00+03:00"}`), rpcCfg)
 	if err != nil {
 		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
 	}
@@ -80,6 +108,17 @@ func testUpdateFlight(t *testing.T, flightID uint) {
 	if r.StatusCode != 200 {
 		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
 	}
+
+	// Updated flight is returned
+	f := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &f); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if f.ID != flightID || f.Duration != 70 || f.Arrival.Location() != time.UTC || f.Name != "test" {
+		t.Fatalf("\nExpected duration: %d in UTC\nObtained: %v\n", 70, f)
+	}
 }
 
 func testSearchFlight(t *testing.T) {
@@ -90,9 +129,9 @@ func testSearchFlight(t *testing.T) {
 		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
 	}
 
-	obtained := []models.Flight{}
+	page := testFlightsPage{}
 
-	if err := helpers.Decode(r.Body, &obtained); err != nil {
+	if err := helpers.Decode(r.Body, &page); err != nil {
 		t.Fatalf("Unexpected error - %s\n", err)
 	}
 
@@ -100,6 +139,8 @@ func testSearchFlight(t *testing.T) {
 		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
 	}
 
+	obtained := page.Flights
+
 	if len(obtained) == 0 {
 		t.Fatalf("Expected non 0 records\n")
 	}
@@ -121,3 +162,462 @@ func testRemoveFlight(t *testing.T, flightID uint) {
 		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
 	}
 }
+
+func TestViewerCannotManageFlights(t *testing.T) {
+	cfg := testAuth(t, "viewer", models.RoleViewer)
+
+	endpoint := "http://" + listenOn + "/flights"
+	payload := `{"name": "test", "number": "AB124", "destination": "Moscow", "fare": 100, "duration": 60}`
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 403 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 403, r.StatusCode)
+	}
+
+	obtained := problem.Document{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if obtained.Code != middleware.CodeInsufficientRole {
+		t.Fatalf("\nExpected code: %s\nObtained: %s\n", middleware.CodeInsufficientRole, obtained.Code)
+	}
+
+	r, err = rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+}
+
+func TestFlightValidation(t *testing.T) {
+	cfg := testAuth(t, "validation", models.RoleOperator)
+	cfg.Headers.Set(middleware.RequestIDHeader, "validation-request")
+
+	endpoint := "http://" + listenOn + "/flights"
+	payload := `{"name": "test", "fare": -1}`
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 400 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 400, r.StatusCode)
+	}
+
+	if ct := r.Header.Get("Content-Type"); ct != problem.ContentType {
+		t.Fatalf("\nExpected content type: %s\nObtained: %s\n", problem.ContentType, ct)
+	}
+
+	obtained := problem.Document{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if obtained.Code != problem.CodeValidation || obtained.RequestID != "validation-request" {
+		t.Fatalf("Unexpected problem - %v\n", obtained)
+	}
+
+	expected := []string{"number", "departure", "arrival", "destination", "fare"}
+
+	if len(obtained.Fields) != len(expected) {
+		t.Fatalf("\nExpected fields: %v\nObtained: %v\n", expected, obtained.Fields)
+	}
+
+	for i, f := range obtained.Fields {
+		if f.Field != expected[i] {
+			t.Fatalf("\nExpected fields: %v\nObtained: %v\n", expected, obtained.Fields)
+		}
+	}
+}
+
+type testFlightsPage struct {
+	Flights    []models.Flight `json:"flights"`
+	NextCursor string          `json:"next_cursor"`
+	Total      *int            `json:"total"`
+}
+
+func TestSearchPagination(t *testing.T) {
+	cfg := testAuth(t, "pagination", models.RoleOperator)
+
+	for i, fare := range []int64{300, 100, 500, 200, 400} {
+		f := models.Flight{
+			Name:        "paged",
+			Number:      fmt.Sprintf("PG%d", i),
+			Destination: "Paging",
+			Fare:        fare,
+			Duration:    60,
+		}
+
+		if err := stores.Flights.Create(&f); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+	}
+
+	var (
+		fares    []int64
+		pages    int
+		endpoint = fmt.Sprintf("http://%s/flights?destination=Paging&sort=-fare&limit=2", listenOn)
+	)
+
+	for endpoint != "" {
+		r, err := rpc.Request("GET", endpoint, nil, cfg)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+		}
+
+		if r.StatusCode != 200 {
+			t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+		}
+
+		page := testFlightsPage{}
+
+		if err := helpers.Decode(r.Body, &page); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		if pages == 0 && (page.Total == nil || *page.Total != 5) {
+			t.Fatalf("Expected total 5 on the first page, obtained: %v\n", page.Total)
+		}
+
+		for _, f := range page.Flights {
+			fares = append(fares, f.Fare)
+		}
+
+		endpoint = ""
+
+		if page.NextCursor != "" {
+			link := r.Header.Get("Link")
+			if !strings.Contains(link, "cursor="+page.NextCursor) || !strings.HasSuffix(link, `rel="next"`) {
+				t.Fatalf("Unexpected Link header - %s\n", link)
+			}
+
+			endpoint = "http://" + listenOn + link[1:strings.Index(link, ">")]
+		}
+
+		pages++
+	}
+
+	expected := []int64{500, 400, 300, 200, 100}
+
+	if pages != 3 || !reflect.DeepEqual(fares, expected) {
+		t.Fatalf("\nExpected fares: %v in 3 pages\nObtained: %v in %d pages\n", expected, fares, pages)
+	}
+}
+
+func TestSearchProjection(t *testing.T) {
+	cfg := testAuth(t, "projection", models.RoleViewer)
+
+	endpoint := fmt.Sprintf("http://%s/flights?destination=Paging&fields=number,fare&limit=1", listenOn)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	page := struct {
+		Flights []map[string]interface{} `json:"flights"`
+	}{}
+
+	if err := helpers.Decode(r.Body, &page); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	for _, f := range page.Flights {
+		if len(f) != 3 || f["ID"] == nil || f["number"] == nil || f["fare"] == nil {
+			t.Fatalf("Expected ID, number and fare only, obtained: %v\n", f)
+		}
+	}
+
+	// Fields omitted when empty are known too
+	u, err := stores.Users.FindByName("projection")
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	f := models.Flight{Name: "projection", Number: "PR1", Destination: "Projection", Fare: 100, Duration: 60, CreatedBy: &u.ID}
+
+	if err := stores.Flights.Create(&f); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	endpoint = fmt.Sprintf("http://%s/flights?destination=Projection&fields=created_by,origin_airport_id,departure_local", listenOn)
+
+	if r, err = rpc.Request("GET", endpoint, nil, cfg); err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	owned := struct {
+		Flights []map[string]interface{} `json:"flights"`
+	}{}
+
+	if err := helpers.Decode(r.Body, &owned); err != nil || r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d, %v\n", 200, r.StatusCode, err)
+	}
+
+	if len(owned.Flights) != 1 || len(owned.Flights[0]) != 2 || owned.Flights[0]["created_by"] != float64(u.ID) {
+		t.Fatalf("Expected ID and created_by only, obtained: %v\n", owned.Flights)
+	}
+
+	for _, q := range []string{"fields=nope", "sort=name", "limit=0", "cursor=garbage"} {
+		endpoint = fmt.Sprintf("http://%s/flights?%s", listenOn, q)
+
+		r, err = rpc.Request("GET", endpoint, nil, cfg)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+		}
+
+		if r.StatusCode != 400 {
+			t.Fatalf("\n%s\nExpected status code: %d\nObtained: %d\n", q, 400, r.StatusCode)
+		}
+	}
+}
+
+func TestSearchFilters(t *testing.T) {
+	cfg := testAuth(t, "filters", models.RoleViewer)
+
+	base := time.Date(2021, 5, 1, 9, 0, 0, 0, time.UTC)
+
+	for i, f := range []models.Flight{
+		{Number: "FL100", Destination: "Paris", Fare: 100, Duration: 60, Departure: base},
+		{Number: "FL200", Destination: "paris", Fare: 200, Duration: 90, Departure: base.Add(24 * time.Hour)},
+		{Number: "FX300", Destination: "Rome", Fare: 300, Duration: 120, Departure: base.Add(48 * time.Hour)},
+		{Number: "F_400", Destination: "Oslo", Fare: 400, Duration: 150, Departure: base.Add(72 * time.Hour)},
+		{Number: "FE250", Destination: "Berlin", Fare: 250, Currency: "EUR", Duration: 30, Departure: base.Add(96 * time.Hour)},
+		// There is no exchange rate for GBP
+		{Number: "FG500", Destination: "London", Fare: 500, Currency: "GBP", Duration: 30, Departure: base.Add(120 * time.Hour)},
+	} {
+		f.Name = "filtered"
+		f.Scheduled = f.Departure
+
+		if err := stores.Flights.Create(&f); err != nil {
+			t.Fatalf("Unexpected error - %d - %s\n", i, err)
+		}
+	}
+
+	cases := []struct {
+		query    string
+		expected []string
+	}{
+		{"destination=PARIS", []string{"FL100", "FL200"}},
+		{"destination=rome,oslo", []string{"FX300", "F_400"}},
+		{"destination=Rome&destination=Paris", []string{"FL100", "FL200", "FX300"}},
+		{"number_prefix=fl", []string{"FL100", "FL200"}},
+		{"number_prefix=F_", []string{"F_400"}},
+		{"fare_min=150&fare_max=300", []string{"FL200", "FX300"}},
+		{"duration_min=120", []string{"FX300", "F_400"}},
+		{"departure_from=2021-05-02&departure_to=2021-05-03", []string{"FL200", "FX300"}},
+		{"departure_to=2021-05-02T09:00:00%2B03:00", []string{"FL100"}},
+		{"departure=2021-05-04T09:00:00Z", []string{"F_400"}},
+		{"scheduled_date=2021-05-01", []string{"FL100"}},
+		{"number=FL100,FX300&fare_max=200", []string{"FL100"}},
+		// Fares are compared within a single currency
+		{"fare_min=150&fare_currency=eur", []string{"FE250"}},
+		{"sort=-fare&fare_currency=GBP", []string{"FG500"}},
+		{"sort=fare&currency=EUR", []string{"FL100", "FL200", "FX300", "F_400"}},
+		{"destination=London&currency=EUR", []string{"FG500"}},
+	}
+
+	for _, c := range cases {
+		endpoint := fmt.Sprintf("http://%s/flights?flight_name=filtered&%s", listenOn, c.query)
+
+		r, err := rpc.Request("GET", endpoint, nil, cfg)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+		}
+
+		if r.StatusCode != 200 {
+			t.Fatalf("\n%s\nExpected status code: %d\nObtained: %d\n", c.query, 200, r.StatusCode)
+		}
+
+		page := testFlightsPage{}
+
+		if err := helpers.Decode(r.Body, &page); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		obtained := []string{}
+		for _, f := range page.Flights {
+			obtained = append(obtained, f.Number)
+		}
+
+		if !reflect.DeepEqual(obtained, c.expected) {
+			t.Fatalf("\n%s\nExpected: %v\nObtained: %v\n", c.query, c.expected, obtained)
+		}
+
+		// Fares without exchange rate are kept as is
+		for _, f := range page.Flights {
+			if f.Number == "FG500" && (f.Currency != "GBP" || f.Fare != 500) {
+				t.Fatalf("\n%s\nExpected: 500 GBP\nObtained: %d %s\n", c.query, f.Fare, f.Currency)
+			}
+		}
+	}
+
+	london := testFlightByNumber(t, cfg, "FG500", "")
+
+	r := testRequest(t, "GET", fmt.Sprintf("http://%s/flights/%d?currency=EUR", listenOn, london.ID), "", cfg)
+	f := models.Flight{}
+
+	if err := helpers.Decode(r.Body, &f); err != nil || r.StatusCode != 200 || f.Currency != "GBP" || f.Fare != 500 {
+		t.Fatalf("\nExpected: 500 GBP\nObtained: %d, %v, %v\n", r.StatusCode, f, err)
+	}
+}
+
+func TestSearchMalformedFilters(t *testing.T) {
+	cfg := testAuth(t, "malformed", models.RoleViewer)
+
+	endpoint := fmt.Sprintf("http://%s/flights?fare_min=cheap&duration_min=10&duration_max=5&departure_from=tomorrow&fields=nope", listenOn)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 400 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 400, r.StatusCode)
+	}
+
+	obtained := problem.Document{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	fields := []string{}
+	for _, f := range obtained.Fields {
+		fields = append(fields, f.Field)
+	}
+
+	expected := []string{"departure_from", "fare_min", "duration_max", "fields"}
+
+	if !reflect.DeepEqual(fields, expected) {
+		t.Fatalf("\nExpected fields: %v\nObtained: %v\n", expected, fields)
+	}
+}
+
+func TestFlightNotFound(t *testing.T) {
+	endpoint := fmt.Sprintf("http://%s/flights/%d", listenOn, 1000000)
+
+	for _, method := range []string{"GET", "PUT", "PATCH", "DELETE"} {
+		r, err := rpc.Request(method, endpoint, []byte(`{"name": "missing"}`), rpcCfg)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+		}
+
+		testProblem(t, r, 404, problem.CodeNotFound)
+	}
+}
+
+func TestFlightPatch(t *testing.T) {
+	testLoadAirports(t)
+
+	var (
+		cfg      = testAuth(t, "patch", models.RoleOperator)
+		endpoint = "http://" + listenOn + "/flights"
+		payload  = fmt.Sprintf(`{"name": "patch", "number": "PT100", "fare": 100, "origin_airport_id": %d, "destination_airport_id": %d,
+			"departure": "2021-04-01T09:00:00Z", "arrival": "2021-04-01T10:00:00Z"}`, testAirport(t, "SVO").ID, testAirport(t, "LED").ID)
+		created models.Flight
+	)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if err := helpers.Decode(r.Body, &created); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	flight := fmt.Sprintf("%s/%d", endpoint, created.ID)
+
+	patch := func(payload string) (*http.Response, models.Flight) {
+		r, err := rpc.Request("PATCH", flight, []byte(payload), cfg)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", flight, err)
+		}
+
+		f := models.Flight{}
+
+		if r.StatusCode == 200 {
+			if err := helpers.Decode(r.Body, &f); err != nil {
+				t.Fatalf("Unexpected error - %s\n", err)
+			}
+		}
+
+		return r, f
+	}
+
+	// Null resets field, omitted ones are kept
+	r, f := patch(`{"origin_airport_id": null, "name": "patched"}`)
+
+	if r.StatusCode != 200 || f.OriginAirportID != nil || f.DestinationAirportID == nil || f.Name != "patched" ||
+		f.Destination != "St. Petersburg" || f.Version != 2 || r.Header.Get("ETag") != `"2"` {
+		t.Fatalf("Unexpected patched flight - %d %v\n", r.StatusCode, f)
+	}
+
+	// Duration is derived from changed times, status can't be patched
+	r, f = patch(`{"arrival": "2021-04-01T11:30:00Z", "status": "landed", "ID": 1}`)
+
+	if r.StatusCode != 200 || f.Duration != 150 || f.Status != models.StatusScheduled || f.ID != created.ID {
+		t.Fatalf("Unexpected patched flight - %d %v\n", r.StatusCode, f)
+	}
+
+	r, _ = patch(`{"number": null, "duration": 10}`)
+	testProblem(t, r, 400, problem.CodeValidation, "number", "duration")
+
+	r, _ = patch(`[{"op": "remove", "path": "/number"}]`)
+	testProblem(t, r, 400, problem.CodeMalformed)
+
+	cfg.Headers.Set("Content-Type", "text/plain")
+	r, _ = patch(`{"name": "plain"}`)
+	testProblem(t, r, 415, "unsupported_media_type")
+	cfg.Headers.Set("Content-Type", "application/merge-patch+json")
+
+	// Patched flight is returned by id until it's changed again
+	r = testConditional(t, cfg, "GET", flight, "", "If-None-Match", "")
+
+	if err := helpers.Decode(r.Body, &f); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if r.StatusCode != 200 || f.Name != "patched" || f.Duration != 150 || r.Header.Get("ETag") != `"3"` {
+		t.Fatalf("Unexpected flight - %d %s %v\n", r.StatusCode, r.Header.Get("ETag"), f)
+	}
+
+	if r = testConditional(t, cfg, "GET", flight, "", "If-None-Match", `"3"`); r.StatusCode != 304 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 304, r.StatusCode)
+	}
+
+	// Fares converted to another currency have own tag of the same version
+	for _, tc := range []struct {
+		tag    string
+		status int
+	}{
+		{`"3"`, 200},
+		{`"3-EUR"`, 304},
+	} {
+		r = testConditional(t, cfg, "GET", flight+"?currency=eur", "", "If-None-Match", tc.tag)
+
+		if r.StatusCode != tc.status || r.Header.Get("ETag") != `"3-EUR"` {
+			t.Fatalf("\nExpected status code: %d, ETag: %s\nObtained: %d, %s\n", tc.status, `"3-EUR"`, r.StatusCode, r.Header.Get("ETag"))
+		}
+	}
+
+	if r = testConditional(t, cfg, "PATCH", flight, `{"fare": 200}`, "If-Match", `"2"`); r.StatusCode != 412 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 412, r.StatusCode)
+	}
+
+	if r = testConditional(t, cfg, "PATCH", flight, `{"fare": 200}`, "If-Match", `"3-EUR"`); r.StatusCode != 200 || r.Header.Get("ETag") != `"4"` {
+		t.Fatalf("\nExpected status code: %d, ETag: %s\nObtained: %d, %s\n", 200, `"4"`, r.StatusCode, r.Header.Get("ETag"))
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	m "github.com/3d0c/sample-api/api/middleware"
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+)
+
+type itinerariesHandler struct {
+	flights  models.FlightStore
+	airports models.AirportStore
+	rates    *models.Rates
+}
+
+func itineraries(flights models.FlightStore, airports models.AirportStore, rates *models.Rates) *itinerariesHandler {
+	return &itinerariesHandler{flights: flights, airports: airports, rates: rates}
+}
+
+type itinerariesResult struct {
+	Itineraries []models.Itinerary `json:"itineraries"`
+}
+
+func (h *itinerariesHandler) search(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		search models.ItinerarySearch
+		result itinerariesResult
+		err    error
+	)
+
+	if search, err = models.ParseItinerarySearch(r.URL.Query(), h.airports, h.rates); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	flights := h.flights.Tenant(m.OrganizationID(r.Context()))
+
+	if result.Itineraries, err = models.FindItineraries(search, flights, h.airports, h.rates); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	for _, it := range result.Itineraries {
+		if err = models.LocalizeFlights(it.Flights, h.airports); err != nil {
+			return http.StatusInternalServerError, err
+		}
+
+		if search.Currency != "" {
+			if err = h.rates.ConvertFlights(it.Flights, search.Currency); err != nil {
+				return http.StatusInternalServerError, err
+			}
+		}
+	}
+
+	if result.Itineraries == nil {
+		result.Itineraries = []models.Itinerary{}
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
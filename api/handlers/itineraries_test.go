@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+type testItineraries struct {
+	Itineraries []models.Itinerary `json:"itineraries"`
+}
+
+func testFindItineraries(t *testing.T, cfg *rpc.Config, query string) [][]string {
+	endpoint := fmt.Sprintf("http://%s/itineraries?%s", listenOn, query)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	result := testItineraries{}
+
+	if err := helpers.Decode(r.Body, &result); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	numbers := [][]string{}
+
+	for _, it := range result.Itineraries {
+		var path []string
+		for _, f := range it.Flights {
+			path = append(path, f.Number)
+		}
+		numbers = append(numbers, path)
+	}
+
+	return numbers
+}
+
+// testLeg is a flight of itineraries graph, departing at local time of
+// day in UTC
+type testLeg struct {
+	number   string
+	from, to string
+	dep      string
+	duration int
+	fare     int64
+	currency string
+}
+
+func testCreateLegs(t *testing.T, day time.Time, legs []testLeg) {
+	for _, leg := range legs {
+		dep, err := time.Parse("15:04", leg.dep)
+		if err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		departure := day.Add(time.Duration(dep.Hour())*time.Hour + time.Duration(dep.Minute())*time.Minute)
+
+		if leg.currency == "" {
+			leg.currency = models.DefaultCurrency
+		}
+
+		f := models.Flight{
+			Name:                 "itinerary",
+			Number:               leg.number,
+			Scheduled:            departure,
+			Departure:            departure,
+			Arrival:              departure.Add(time.Duration(leg.duration) * time.Minute),
+			Destination:          leg.to,
+			Fare:                 leg.fare,
+			Currency:             leg.currency,
+			Duration:             leg.duration,
+			OriginAirportID:      &testAirport(t, leg.from).ID,
+			DestinationAirportID: &testAirport(t, leg.to).ID,
+		}
+
+		if err := stores.Flights.Create(&f); err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+	}
+}
+
+func TestItineraries(t *testing.T) {
+	testLoadAirports(t)
+
+	cfg := testAuth(t, "itineraries", models.RoleViewer)
+
+	testCreateLegs(t, time.Date(2031, 3, 10, 0, 0, 0, 0, time.UTC), []testLeg{
+		{"IT1", "TBS", "IST", "06:00", 120, 100, ""},
+		{"IT2", "IST", "VIE", "09:00", 150, 120, ""},
+		{"IT3", "TBS", "VIE", "10:00", 240, 400, ""},
+		// Connection time at IST is too short
+		{"IT4", "IST", "VIE", "08:20", 150, 50, ""},
+		{"IT5", "TBS", "EVN", "05:00", 60, 30, ""},
+		{"IT6", "EVN", "VIE", "07:00", 240, 150, ""},
+		// Departs next day in Tbilisi
+		{"IT7", "TBS", "VIE", "20:30", 240, 10, ""},
+	})
+
+	for _, tc := range []struct {
+		query    string
+		expected [][]string
+	}{
+		{"from=TBS&to=VIE&date=2031-03-10", [][]string{{"IT3"}, {"IT1", "IT2"}, {"IT5", "IT6"}}},
+		{"from=tbs&to=LOWW&date=2031-03-10&sort=fare", [][]string{{"IT5", "IT6"}, {"IT1", "IT2"}, {"IT3"}}},
+		{"from=TBS&to=VIE&date=2031-03-10&max_stops=0", [][]string{{"IT3"}}},
+		{"from=TBS&to=VIE&date=2031-03-10&max_layover=30", [][]string{{"IT3"}}},
+		{"from=TBS&to=VIE&date=2031-03-10&limit=1&sort=fare", [][]string{{"IT5", "IT6"}}},
+		{"from=TBS&to=VIE&date=2031-03-11", [][]string{{"IT7"}}},
+	} {
+		obtained := testFindItineraries(t, cfg, tc.query)
+
+		if fmt.Sprint(obtained) != fmt.Sprint(tc.expected) {
+			t.Fatalf("\nExpected %s: %v\nObtained: %v\n", tc.query, tc.expected, obtained)
+		}
+	}
+
+	// Airport minimum connection time is respected
+	ist := testAirport(t, "IST")
+	ist.MinConnectionTime = 90
+
+	if err := stores.Airports.Update(ist.ID, ist); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	obtained := testFindItineraries(t, cfg, "from=TBS&to=VIE&date=2031-03-10")
+	expected := [][]string{{"IT3"}, {"IT5", "IT6"}}
+
+	if fmt.Sprint(obtained) != fmt.Sprint(expected) {
+		t.Fatalf("\nExpected: %v\nObtained: %v\n", expected, obtained)
+	}
+
+	// Itinerary with fare which can't be converted has no total fare and
+	// is ranked the most expensive, GBP isn't in rates table
+	testCreateLegs(t, time.Date(2031, 3, 12, 0, 0, 0, 0, time.UTC), []testLeg{
+		{"IT8", "TBS", "VIE", "06:00", 240, 40000, "USD"},
+		{"IT9", "TBS", "IST", "05:00", 120, 100, "USD"},
+		{"IT10", "IST", "VIE", "09:00", 150, 50, "GBP"},
+	})
+
+	for _, query := range []string{"date=2031-03-12&sort=fare", "date=2031-03-12&currency=EUR"} {
+		endpoint := fmt.Sprintf("http://%s/itineraries?from=TBS&to=VIE&%s", listenOn, query)
+
+		r, err := rpc.Request("GET", endpoint, nil, cfg)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+		}
+
+		result := testItineraries{}
+
+		if err := helpers.Decode(r.Body, &result); err != nil || r.StatusCode != 200 {
+			t.Fatalf("\nExpected status code: %d\nObtained: %d, %v\n", 200, r.StatusCode, err)
+		}
+
+		if its := result.Itineraries; len(its) != 2 || its[0].Fare == nil || its[1].Fare != nil ||
+			len(its[1].Flights) != 2 || its[1].Flights[1].Currency != "GBP" || its[1].Flights[1].Fare != 50 {
+			t.Fatalf("\nExpected direct flight and connection without fare for %s\nObtained: %v\n", query, its)
+		}
+	}
+
+	// Leg of several itineraries is converted once in every one of them
+	testCreateLegs(t, time.Date(2031, 3, 14, 0, 0, 0, 0, time.UTC), []testLeg{
+		{"IT11", "TBS", "IST", "05:00", 120, 10000, "USD"},
+		{"IT12", "IST", "VIE", "09:00", 150, 100, "USD"},
+		{"IT13", "IST", "VIE", "10:00", 150, 100, "USD"},
+	})
+
+	shared, err := stores.Flights.Find(models.Search{Numbers: []string{"IT11"}, Limit: 1})
+	if err != nil || len(shared.Flights) != 1 {
+		t.Fatalf("Unexpected error - %v, %v\n", err, shared.Flights)
+	}
+
+	classes := []models.FareClass{{Code: "Y", Cabin: models.CabinEconomy, Fare: 10000}}
+
+	if err = stores.Flights.Update(int(shared.Flights[0].ID), &models.Flight{FareClasses: classes}); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	endpoint := fmt.Sprintf("http://%s/itineraries?from=TBS&to=VIE&date=2031-03-14&currency=EUR", listenOn)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	result := testItineraries{}
+
+	if err := helpers.Decode(r.Body, &result); err != nil || r.StatusCode != 200 || len(result.Itineraries) != 2 {
+		t.Fatalf("\nExpected two itineraries\nObtained: %d, %v, %v\n", r.StatusCode, result.Itineraries, err)
+	}
+
+	for _, it := range result.Itineraries {
+		if f := it.Flights[0]; f.Fare != 9000 || len(f.FareClasses) != 1 || f.FareClasses[0].Fare != 9000 {
+			t.Fatalf("\nExpected fare and fare class of 9000 EUR\nObtained: %v\n", f)
+		}
+	}
+
+	endpoint = fmt.Sprintf("http://%s/itineraries?from=TBS&to=XXX&max_stops=3&currency=GBP", listenOn)
+
+	r, err = rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 400, problem.CodeValidation, "to", "date", "max_stops", "currency")
+}
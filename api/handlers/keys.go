@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/jwks"
+)
+
+type keysHandler struct {
+	keys *jwks.KeySet
+}
+
+func keys(k *jwks.KeySet) *keysHandler {
+	return &keysHandler{keys: k}
+}
+
+func (h *keysHandler) jwks(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	helpers.NewJsonResponder(w).Write(h.keys.JWKS())
+
+	return http.StatusOK, nil
+}
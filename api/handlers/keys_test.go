@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/jwks"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+func TestJWKS(t *testing.T) {
+	endpoint := "http://" + listenOn + "/.well-known/jwks.json"
+
+	r, err := rpc.Request("GET", endpoint, nil, nil)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	obtained := jwks.JWKS{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(obtained.Keys) != 1 || obtained.Keys[0].Kid == "" || obtained.Keys[0].Alg != "ES256" {
+		t.Fatalf("Unexpected key set - %v\n", obtained)
+	}
+}
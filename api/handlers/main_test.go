@@ -1,33 +1,99 @@
 package handlers
 
 import (
+	"bytes"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"testing"
 
+	"github.com/3d0c/sample-api/api/migrations"
 	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/data"
+	"github.com/3d0c/sample-api/pkg/jwks"
 	"github.com/3d0c/sample-api/pkg/rpc"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 const listenOn = "127.0.0.1:6677"
 
 var (
+	// testRates is an exchange rates table, 1 USD is 0.9 EUR or 150 JPY
+	testRates = &models.Rates{Base: "USD", Rates: map[string]float64{"USD": 1, "EUR": 0.9, "JPY": 150}}
+
 	rpcCfg *rpc.Config
+	stores *models.Stores
+	keySet *jwks.KeySet
 )
 
 func TestMain(m *testing.M) {
-	router := SetupRouter()
+	// Handlers are tested against in-memory stores unless database driver
+	// is set explicitly, e.g. DB_DRIVER=sqlite3 DBPATH=:memory:
+	if driver := os.Getenv("DB_DRIVER"); driver != "" {
+		conn, err := models.ConnectDatabase(driver)
+		if err != nil {
+			log.Fatalf("Error connecting to database - %s\n", err)
+		}
+		if _, err = migrations.Up(conn); err != nil {
+			log.Fatalf("Error migrating database - %s\n", err)
+		}
+		stores = models.NewDBStores(conn)
+	} else {
+		stores = models.NewMemoryStores()
+	}
+
+	var err error
+
+	// Minimal cost keeps tests fast, bundled deny-list is checked
+	models.Hasher.Cost = bcrypt.MinCost
+
+	if models.Policy.DenyList, err = models.LoadDenyList(bytes.NewReader(data.CommonPasswords)); err != nil {
+		log.Fatalf("Error loading passwords deny-list - %s\n", err)
+	}
+
+	if keySet, err = jwks.Generate(); err != nil {
+		log.Fatalf("Error generating keys - %s\n", err)
+	}
+
+	router := SetupRouter(stores, keySet, testRates)
 
-	if err := models.ConnectDatabase(); err != nil {
-		log.Fatalf("Error connecting to database - %s\n", err)
+	ln, err := net.Listen("tcp", listenOn)
+	if err != nil {
+		log.Fatalf("Error listening on %s - %s\n", listenOn, err)
 	}
 
 	go func() {
 		log.Fatalln(
-			http.ListenAndServe(listenOn, router),
+			http.Serve(ln, router),
 		)
 	}()
 
 	os.Exit(m.Run())
 }
+
+// testAuth creates user with given role directly in store and returns
+// rpc config with its bearer token
+func testAuth(t *testing.T, name string, role models.Role) *rpc.Config {
+	u := &models.User{Name: name, Password: name, Role: role}
+
+	if err := u.HashPassword(); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if err := stores.Users.Create(u); err != nil {
+		t.Fatalf("Error creating user %s - %s\n", name, err)
+	}
+
+	token, err := u.GenerateJWT(stores.Tokens, keySet)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	cfg := &rpc.Config{Headers: make(http.Header)}
+	cfg.Headers.Set("Content-Type", "application/json")
+	cfg.Headers.Set("Authorization", "Bearer "+token.Token)
+
+	return cfg
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	m "github.com/3d0c/sample-api/api/middleware"
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// CodeNotPlatformAdmin is a problem code for organizations management
+// requested by admin of another organization than the default one
+const CodeNotPlatformAdmin = "not_platform_admin"
+
+type organizationsHandler struct {
+	store models.OrganizationStore
+}
+
+func organizations(store models.OrganizationStore) *organizationsHandler {
+	return &organizationsHandler{store: store}
+}
+
+func organizationID(ps httprouter.Params) (uint, error) {
+	id, err := strconv.ParseUint(ps.ByName("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, problem.BadRequest("invalid_id", "organization id must be a positive integer")
+	}
+
+	return uint(id), nil
+}
+
+// platformAdmin checks that caller is admin of the default organization,
+// who manages all of them
+func platformAdmin(r *http.Request) error {
+	if m.OrganizationID(r.Context()) != models.DefaultOrganizationID || !m.Role(r.Context()).Includes(models.RoleAdmin) {
+		return problem.Forbidden(CodeNotPlatformAdmin, "organizations are managed by admins of the default organization")
+	}
+
+	return nil
+}
+
+func (h *organizationsHandler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		o   models.Organization
+		err error
+	)
+
+	if err = platformAdmin(r); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	if err = helpers.Decode(r.Body, &o); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if err = o.Validate(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = h.store.Create(&o); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(o)
+
+	return http.StatusOK, nil
+}
+
+func (h *organizationsHandler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	if err := platformAdmin(r); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	result, err := h.store.List()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
+
+type invitationRequest struct {
+	Role models.Role `json:"role"`
+}
+
+// invite creates invitation to organization. Admins invite users to
+// their own organization, admins of the default one to any.
+func (h *organizationsHandler) invite(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		req invitationRequest
+		inv *models.Invitation
+		oid uint
+		v   problem.Validation
+		err error
+	)
+
+	if oid, err = organizationID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	// Other organizations are not disclosed
+	if oid != m.OrganizationID(r.Context()) && platformAdmin(r) != nil {
+		return http.StatusNotFound, models.ErrNotFound
+	}
+
+	if _, err = h.store.Find(oid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = helpers.Decode(r.Body, &req); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if req.Role == "" {
+		req.Role = models.RoleViewer
+	}
+
+	if _, err = models.ParseRole(string(req.Role)); err != nil {
+		v.Add("role", "invalid", err.Error())
+		return http.StatusBadRequest, v.Err()
+	}
+
+	uid, _ := m.UserID(r.Context())
+
+	if inv, err = models.NewInvitation(oid, req.Role, uid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.store.Invite(inv); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(inv)
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+// testRequest sends request and returns response, payload may be empty
+func testRequest(t *testing.T, method, endpoint, payload string, cfg *rpc.Config) *http.Response {
+	var body []byte
+	if payload != "" {
+		body = []byte(payload)
+	}
+
+	r, err := rpc.Request(method, endpoint, body, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	return r
+}
+
+// testInvite registers user invited to organization with the role and
+// returns rpc config with its bearer token
+func testInvite(t *testing.T, cfg *rpc.Config, org uint, name string, role models.Role) *rpc.Config {
+	endpoint := fmt.Sprintf("http://%s/organizations/%d/invitations", listenOn, org)
+
+	r := testRequest(t, "POST", endpoint, fmt.Sprintf(`{"role": "%s"}`, role), cfg)
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	inv := models.Invitation{}
+
+	if err := helpers.Decode(r.Body, &inv); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	payload := fmt.Sprintf(`{"name": "%s", "password": "%s-password", "invitation": "%s"}`, name, name, inv.Token)
+
+	r = testRequest(t, "POST", "http://"+listenOn+"/users", payload, nil)
+	u := models.User{}
+
+	if err := helpers.Decode(r.Body, &u); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if r.StatusCode != 200 || u.OrganizationID != org || u.Role != role {
+		t.Fatalf("\nExpected status code: %d, organization: %d, role: %s\nObtained: %d, %v\n", 200, org, role, r.StatusCode, u)
+	}
+
+	// Invitation is accepted once
+	r = testRequest(t, "POST", "http://"+listenOn+"/users", `{"name": "again-`+name+`", "password": "again-password", "invitation": "`+inv.Token+`"}`, nil)
+	testProblem(t, r, 400, "invitation_invalid")
+
+	token := testLogin(t, name, name+"-password")
+
+	c := &rpc.Config{Headers: make(http.Header)}
+	c.Headers.Set("Content-Type", "application/json")
+	c.Headers.Set("Authorization", "Bearer "+token.Token)
+
+	return c
+}
+
+func TestOrganizations(t *testing.T) {
+	var (
+		admin    = testAuth(t, "orgs-admin", models.RoleAdmin)
+		operator = testAuth(t, "orgs-operator", models.RoleOperator)
+		endpoint = "http://" + listenOn + "/organizations"
+		partner  = models.Organization{}
+	)
+
+	r := testRequest(t, "POST", endpoint, `{"name": " "}`, admin)
+	testProblem(t, r, 400, problem.CodeValidation, "name")
+
+	r = testRequest(t, "POST", endpoint, `{"name": "Partner"}`, admin)
+	if err := helpers.Decode(r.Body, &partner); err != nil || r.StatusCode != 200 || partner.ID == 0 {
+		t.Fatalf("\nExpected status code: %d with organization\nObtained: %d, %v, %v\n", 200, r.StatusCode, partner, err)
+	}
+
+	r = testRequest(t, "POST", endpoint, `{"name": "Partner"}`, admin)
+	testProblem(t, r, 409, "organization_exists")
+
+	r = testRequest(t, "POST", fmt.Sprintf("%s/%d/invitations", endpoint, partner.ID), `{"role": "pilot"}`, admin)
+	testProblem(t, r, 400, problem.CodeValidation, "role")
+
+	partnerAdmin := testInvite(t, admin, partner.ID, "orgs-partner-admin", models.RoleAdmin)
+	partnerOperator := testInvite(t, partnerAdmin, partner.ID, "orgs-partner-operator", models.RoleOperator)
+
+	// Organizations are managed by admins of the default one only,
+	// other organizations are not disclosed
+	r = testRequest(t, "POST", endpoint, `{"name": "Rival"}`, partnerAdmin)
+	testProblem(t, r, 403, CodeNotPlatformAdmin)
+
+	r = testRequest(t, "GET", endpoint, "", partnerAdmin)
+	testProblem(t, r, 403, CodeNotPlatformAdmin)
+
+	r = testRequest(t, "POST", fmt.Sprintf("%s/%d/invitations", endpoint, models.DefaultOrganizationID), `{"role": "admin"}`, partnerAdmin)
+	testProblem(t, r, 404, problem.CodeNotFound)
+
+	// Users of other organizations are not found by scoped stores
+	if _, err := stores.Users.Tenant(partner.ID).FindByName("orgs-admin"); err != models.ErrNotFound {
+		t.Fatalf("\nExpected: %v\nObtained: %v\n", models.ErrNotFound, err)
+	}
+
+	// Flight numbers are unique per organization and date
+	flights := "http://" + listenOn + "/flights"
+	payload := `{"name": "tenant", "number": "MT100", "fare": 100, "destination": "Tenant",
+		"departure": "2021-04-01T09:00:00Z", "arrival": "2021-04-01T10:00:00Z"}`
+
+	created := make(map[*rpc.Config]models.Flight)
+
+	for _, cfg := range []*rpc.Config{operator, partnerOperator} {
+		r = testRequest(t, "POST", flights, payload, cfg)
+		f := models.Flight{}
+
+		if err := helpers.Decode(r.Body, &f); err != nil || r.StatusCode != 200 {
+			t.Fatalf("\nExpected status code: %d\nObtained: %d, %v\n", 200, r.StatusCode, err)
+		}
+
+		created[cfg] = f
+	}
+
+	if created[operator].OrganizationID != models.DefaultOrganizationID || created[partnerOperator].OrganizationID != partner.ID {
+		t.Fatalf("\nExpected organizations: %d, %d\nObtained: %d, %d\n", models.DefaultOrganizationID, partner.ID,
+			created[operator].OrganizationID, created[partnerOperator].OrganizationID)
+	}
+
+	r = testRequest(t, "POST", flights, payload, partnerOperator)
+	testProblem(t, r, 409, "flight_exists")
+
+	// Flights of other organization can be neither read nor changed
+	for cfg, other := range map[*rpc.Config]models.Flight{operator: created[partnerOperator], partnerOperator: created[operator]} {
+		flight := fmt.Sprintf("%s/%d", flights, other.ID)
+
+		for _, tc := range []struct {
+			method   string
+			endpoint string
+			payload  string
+		}{
+			{"GET", flight, ""},
+			{"PUT", flight, `{"fare": 200}`},
+			{"PATCH", flight, `{"fare": 200}`},
+			{"POST", flight + "/status", `{"status": "boarding"}`},
+			{"GET", flight + "/status/history", ""},
+			{"GET", flight + "/seats", ""},
+			{"PUT", flight + "/seats", `{"economy": 10}`},
+			{"POST", flight + "/bookings", `{"cabin": "economy", "seats": 1}`},
+			{"DELETE", flight, ""},
+		} {
+			r = testRequest(t, tc.method, tc.endpoint, tc.payload, cfg)
+			testProblem(t, r, 404, problem.CodeNotFound)
+		}
+
+		f := testFlightByNumber(t, cfg, "MT100", "")
+
+		if f.ID == other.ID {
+			t.Fatalf("\nExpected own flight\nObtained: flight %d of organization %d\n", f.ID, f.OrganizationID)
+		}
+	}
+
+	// Bookings of other organization flights are not found
+	partnerFlight := created[partnerOperator].ID
+
+	if err := stores.Bookings.SetCapacity(partnerFlight, map[models.Cabin]int{models.CabinEconomy: 10}); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	status, booking := testBook(t, partnerOperator, partnerFlight, `{"cabin": "economy", "seats": 1}`)
+	if status != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, status)
+	}
+
+	for _, cfg := range []*rpc.Config{operator, testAuth(t, "orgs-viewer", models.RoleViewer)} {
+		r = testRequest(t, "DELETE", fmt.Sprintf("http://%s/bookings/%d", listenOn, booking.ID), "", cfg)
+		testProblem(t, r, 404, problem.CodeNotFound)
+	}
+
+	// Flight of each organization is changed independently
+	if f, err := stores.Flights.Get(int(created[operator].ID)); err != nil || f.Fare != 100 || f.Version != 1 {
+		t.Fatalf("\nExpected unchanged flight\nObtained: %v, %v\n", f, err)
+	}
+}
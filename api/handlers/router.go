@@ -1,34 +1,179 @@
 package handlers
 
 import (
+	"net/http"
+
 	m "github.com/3d0c/sample-api/api/middleware"
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/jwks"
 
 	"github.com/julienschmidt/httprouter"
 )
 
-// SetupRouter sets up endpoints
-func SetupRouter() *httprouter.Router {
+// SetupRouter sets up endpoints, handlers use provided stores, sign or
+// verify tokens with provided keys and convert fares by rates, which
+// may be nil
+func SetupRouter(s *models.Stores, k *jwks.KeySet, rates *models.Rates) *httprouter.Router {
 	r := httprouter.New()
 
-	// Create new uesr
-	// {'name': 'example', 'password': 'password'}
-	r.POST("/users", m.Chain(users().create))
+	// Public keys for tokens verification
+	r.GET("/.well-known/jwks.json", m.Chain().Then(keys(k).jwks))
+
+	// Create new uesr, invitation makes user a member of organization
+	// {'name': 'example', 'password': 'password', 'invitation': 'token'}
+	r.POST("/users", m.Chain().Then(users(s, k).create))
 
 	// Login user
 	// {'name': 'example', 'password': 'password'}
-	r.POST("/users/login", m.Chain(users().login))
+	r.POST("/users/login", m.Chain().Then(users(s, k).login))
+
+	// Exchange refresh token for a new token pair
+	// {'refresh_token': 'token'}
+	r.POST("/users/token/refresh", m.Chain().Then(users(s, k).refresh))
+
+	// Logout, revokes all tokens issued since login (Protected method)
+	r.POST("/users/logout", m.Chain(m.Auth(s.Tokens, k)).Then(users(s, k).logout))
+
+	// Get own profile (Protected method), or user of organization (Protected method, admin)
+	r.GET("/users/:id", me(m.Chain(m.Auth(s.Tokens, k)).Then(users(s, k).me),
+		m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(users(s, k).get)))
+
+	// Change own name (Protected method)
+	// {'name': 'example'}
+	r.PATCH("/users/me", m.Chain(m.Auth(s.Tokens, k)).Then(users(s, k).updateMe))
+
+	// Change own password (Protected method)
+	// {'current_password': 'password', 'new_password': 'password'}
+	r.POST("/users/me/password", m.Chain(m.Auth(s.Tokens, k)).Then(users(s, k).changePassword))
+
+	// Delete own account and logout (Protected method), or user of organization (Protected method, admin)
+	r.DELETE("/users/:id", me(m.Chain(m.Auth(s.Tokens, k)).Then(users(s, k).removeMe),
+		m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(users(s, k).remove)))
+
+	// List users of organization (Protected method, admin)
+	r.GET("/users", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(users(s, k).list))
+
+	// Add flight (Protected method, operator)
+	// {'name': 'Test', 'number': 'SU10', 'currency': 'EUR', 'fare_classes': [{'code': 'Y', 'fare': 12000}], ...}
+	r.POST("/flights", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(flights(s, rates).create))
+
+	// Delete flight, it is kept until retention period expires. If-Match header makes it conditional on flight version (Protected method, operator)
+	r.DELETE("/flights/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(flights(s, rates).remove))
+
+	// Restore deleted flight (Protected method, admin)
+	r.POST("/flights/:id/restore", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(flights(s, rates).restore))
+
+	// Update flight, If-Match header makes it conditional on flight version (Protected method, operator)
+	r.PUT("/flights/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(flights(s, rates).update))
+
+	// Get flight, fares are converted to ?currency=. Supports If-None-Match (Protected method, viewer)
+	r.GET("/flights/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer), m.Conditional()).Then(flights(s, rates).get))
+
+	// Patch flight with JSON Merge Patch, null resets field (Protected method, operator)
+	// {'destination_airport_id': null, 'destination': 'Moscow'}
+	r.PATCH("/flights/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(flights(s, rates).patch))
+
+	// Search for flights, fares are converted to ?currency=. Supports If-None-Match (Protected method, viewer)
+	// Deleted flights are listed with ?deleted=include or ?deleted=only (admin)
+	r.GET("/flights", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer), m.Conditional()).Then(flights(s, rates).search))
+
+	// Search direct and connecting flights (Protected method, viewer)
+	// ?from=SVO&to=JFK&date=2021-04-01
+	r.GET("/itineraries", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(itineraries(s.Flights, s.Airports, rates).search))
+
+	// Change flight status, records actual times and delay reasons (Protected method, operator)
+	// {'status': 'delayed', 'time': '2021-04-01T11:00:00Z', 'reason': 'weather'}
+	r.POST("/flights/:id/status", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(flights(s, rates).setStatus))
+
+	// Flight status history (Protected method, operator)
+	r.GET("/flights/:id/status/history", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(flights(s, rates).history))
 
-	// Add flight (Protected method)
-	r.POST("/flights", m.Chain(m.Auth, flights().create))
+	// Seat inventory by cabin (Protected method, viewer)
+	r.GET("/flights/:id/seats", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(bookings(s.Bookings, s.Flights).seats))
 
-	// Delete flight (Protected method)
-	r.DELETE("/flights/:id", m.Chain(m.Auth, flights().remove))
+	// Set cabins capacity (Protected method, operator)
+	// {'economy': 150, 'business': 12}
+	r.PUT("/flights/:id/seats", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(bookings(s.Bookings, s.Flights).setSeats))
 
-	// Update flight (Protected method)
-	r.PUT("/flights/:id", m.Chain(m.Auth, flights().update))
+	// Book seats (Protected method, viewer)
+	// {'cabin': 'economy', 'seats': 2}
+	r.POST("/flights/:id/bookings", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(bookings(s.Bookings, s.Flights).book))
 
-	// Search for flights
-	r.GET("/flights", m.Chain(m.Auth, flights().search))
+	// Cancel booking, releases its seats (Protected method, owner or operator)
+	r.DELETE("/bookings/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(bookings(s.Bookings, s.Flights).cancel))
+
+	// List own bookings (Protected method, viewer)
+	r.GET("/users/:id/bookings", me(m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(bookings(s.Bookings, s.Flights).mine), nil))
+
+	// List schedules (Protected method, viewer)
+	r.GET("/schedules", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(schedules(s).list))
+
+	// Get schedule (Protected method, viewer)
+	r.GET("/schedules/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(schedules(s).get))
+
+	// Add schedule, materializes its flights (Protected method, operator)
+	// {'name': 'Test', 'number': 'SU10', 'origin_airport_id': 1, 'destination_airport_id': 4, 'days': 21, 'departure_time': '09:30', ...}
+	r.POST("/schedules", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(schedules(s).create))
+
+	// Replace schedule, regenerates its flights (Protected method, operator)
+	r.PUT("/schedules/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(schedules(s).update))
+
+	// Delete schedule with its future flights (Protected method, operator)
+	r.DELETE("/schedules/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(schedules(s).remove))
+
+	// Materialize schedule flights (Protected method, operator)
+	r.POST("/schedules/:id/generate", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleOperator)).Then(schedules(s).generate))
+
+	// List airports, filtered by code, city or country (Protected method, viewer)
+	r.GET("/airports", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(airports(s.Airports, s.Flights).list))
+
+	// Get airport (Protected method, viewer)
+	r.GET("/airports/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleViewer)).Then(airports(s.Airports, s.Flights).get))
+
+	// Add airport (Protected method, admin)
+	// {'iata': 'SVO', 'icao': 'UUEE', 'name': 'Sheremetyevo', 'city': 'Moscow', 'country': 'Russia', ...}
+	r.POST("/airports", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(airports(s.Airports, s.Flights).create))
+
+	// Replace airport (Protected method, admin)
+	r.PUT("/airports/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(airports(s.Airports, s.Flights).update))
+
+	// Delete airport, which is not referenced by flights (Protected method, admin)
+	r.DELETE("/airports/:id", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(airports(s.Airports, s.Flights).remove))
+
+	// Add organization (Protected method, admin of the default organization)
+	// {'name': 'Partner Airline'}
+	r.POST("/organizations", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(organizations(s.Organizations).create))
+
+	// List organizations (Protected method, admin of the default organization)
+	r.GET("/organizations", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(organizations(s.Organizations).list))
+
+	// Invite user to organization, returns invitation token (Protected method, admin)
+	// {'role': 'operator'}
+	r.POST("/organizations/:id/invitations", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(organizations(s.Organizations).invite))
+
+	// Audit log of flights and users changes, filtered by resource, id, actor, action, from and to (Protected method, admin)
+	// ?resource=flight&id=1
+	r.GET("/audit", m.Chain(m.Auth(s.Tokens, k), m.RequireRole(models.RoleAdmin)).Then(audit(s.Audit).list))
 
 	return r
 }
+
+// me routes /users/me to self handle and other ids to handle, nil handle
+// responds with 404 Not Found. httprouter doesn't allow static and named
+// segments at the same position.
+func me(self, handle httprouter.Handle) httprouter.Handle {
+	if handle == nil {
+		handle = m.Chain().Then(func(http.ResponseWriter, *http.Request, httprouter.Params) (int, error) {
+			return http.StatusNotFound, models.ErrNotFound
+		})
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if ps.ByName("id") == "me" {
+			self(w, r, ps)
+			return
+		}
+
+		handle(w, r, ps)
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	m "github.com/3d0c/sample-api/api/middleware"
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+type schedulesHandler struct {
+	stores *models.Stores
+}
+
+func schedules(s *models.Stores) *schedulesHandler {
+	return &schedulesHandler{stores: s}
+}
+
+// tenant returns stores of the caller organization
+func (h *schedulesHandler) tenant(r *http.Request) *models.Stores {
+	return h.stores.Tenant(m.OrganizationID(r.Context()))
+}
+
+func scheduleID(ps httprouter.Params) (uint, error) {
+	id, err := strconv.ParseUint(ps.ByName("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, problem.BadRequest("invalid_id", "schedule id must be a positive integer")
+	}
+
+	return uint(id), nil
+}
+
+// authorizeSchedule checks that authenticated user may change schedule
+func authorizeSchedule(r *http.Request, sc *models.Schedule) error {
+	uid, _ := m.UserID(r.Context())
+
+	if !sc.CanModify(uid, m.Role(r.Context())) {
+		return models.ErrNotScheduleOwner
+	}
+
+	return nil
+}
+
+func (h *schedulesHandler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	result, err := h.tenant(r).Schedules.List()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
+
+func (h *schedulesHandler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		sc  *models.Schedule
+		sid uint
+		err error
+	)
+
+	if sid, err = scheduleID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if sc, err = h.tenant(r).Schedules.Find(sid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(sc)
+
+	return http.StatusOK, nil
+}
+
+// create creates schedule and materializes its flights
+func (h *schedulesHandler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		sc  models.Schedule
+		err error
+	)
+
+	if err = helpers.Decode(r.Body, &sc); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	sc.CreatedBy = caller(r)
+
+	if err = sc.Validate(h.tenant(r).Airports); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = h.tenant(r).Schedules.Create(&sc); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if _, err = models.GenerateFlights(&sc, h.tenant(r), time.Now().UTC(), models.DefaultScheduleHorizon); err != nil {
+		h.revert(r, &sc, nil)
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(sc)
+
+	return http.StatusOK, nil
+}
+
+// update replaces schedule and regenerates its flights
+func (h *schedulesHandler) update(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		sc  models.Schedule
+		cur *models.Schedule
+		sid uint
+		err error
+	)
+
+	if sid, err = scheduleID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = helpers.Decode(r.Body, &sc); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	if cur, err = h.tenant(r).Schedules.Find(sid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = authorizeSchedule(r, cur); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	if err = sc.Validate(h.tenant(r).Airports); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = h.tenant(r).Schedules.Update(sid, &sc); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if _, err = models.GenerateFlights(&sc, h.tenant(r), time.Now().UTC(), models.DefaultScheduleHorizon); err != nil {
+		h.revert(r, &sc, cur)
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(sc)
+
+	return http.StatusOK, nil
+}
+
+// revert undoes change of schedule sc, which flights failed to generate.
+// New schedule, prev is nil, is deleted with flights generated so far,
+// updated schedule and its flights are restored to prev. Otherwise
+// schedule would stay saved and fail every following generation.
+func (h *schedulesHandler) revert(r *http.Request, sc, prev *models.Schedule) {
+	var (
+		s   = h.tenant(r)
+		now = time.Now().UTC()
+		err error
+	)
+
+	if prev == nil {
+		sc.Days = 0
+		if _, err = models.GenerateFlights(sc, s, now, models.DefaultScheduleHorizon); err == nil {
+			err = s.Schedules.Delete(sc.ID)
+		}
+	} else if err = s.Schedules.Update(prev.ID, prev); err == nil {
+		_, err = models.GenerateFlights(prev, s, now, models.DefaultScheduleHorizon)
+	}
+
+	if err != nil {
+		log.Printf("Error reverting schedule %d - %s\n", sc.ID, err)
+	}
+}
+
+// remove deletes schedule with its future flights, which are not edited
+// or booked. Other flights are kept without schedule.
+func (h *schedulesHandler) remove(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		sc  *models.Schedule
+		sid uint
+		err error
+	)
+
+	if sid, err = scheduleID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if sc, err = h.tenant(r).Schedules.Find(sid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = authorizeSchedule(r, sc); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	// Schedule without days has no flights to keep
+	sc.Days = 0
+
+	if _, err = models.GenerateFlights(sc, h.tenant(r), time.Now().UTC(), models.DefaultScheduleHorizon); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.tenant(r).Schedules.Delete(sid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// generate materializes schedule flights and returns what was changed
+func (h *schedulesHandler) generate(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	var (
+		sc     *models.Schedule
+		sid    uint
+		result models.GenerateResult
+		err    error
+	)
+
+	if sid, err = scheduleID(ps); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if sc, err = h.tenant(r).Schedules.Find(sid); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = authorizeSchedule(r, sc); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	if result, err = models.GenerateFlights(sc, h.tenant(r), time.Now().UTC(), models.DefaultScheduleHorizon); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
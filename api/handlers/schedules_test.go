@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/rpc"
+)
+
+func testScheduleFlights(t *testing.T, cfg *rpc.Config, scheduleID uint) []models.Flight {
+	endpoint := fmt.Sprintf("http://%s/flights?schedule_id=%d&sort=scheduled&limit=500", listenOn, scheduleID)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	page := testFlightsPage{}
+
+	if err := helpers.Decode(r.Body, &page); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	return page.Flights
+}
+
+func testSaveSchedule(t *testing.T, cfg *rpc.Config, method string, endpoint string, sc models.Schedule) models.Schedule {
+	payload, err := json.Marshal(sc)
+	if err != nil {
+		t.Fatalf("Error marshalling struct - %s\n", err)
+	}
+
+	r, err := rpc.Request(method, endpoint, payload, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	obtained := models.Schedule{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	return obtained
+}
+
+func TestSchedules(t *testing.T) {
+	testLoadAirports(t)
+
+	var (
+		cfg  = testAuth(t, "schedules", models.RoleOperator)
+		svo  = testAirport(t, "SVO")
+		led  = testAirport(t, "LED")
+		loc  = svo.Location()
+		now  = time.Now().In(loc)
+		days = []string{}
+	)
+
+	// Two weeks of Monday, Wednesday and Friday flights starting tomorrow
+	for i := 1; i <= 14; i++ {
+		d := now.AddDate(0, 0, i)
+		if wd := d.Weekday(); wd == time.Monday || wd == time.Wednesday || wd == time.Friday {
+			days = append(days, d.Format("2006-01-02"))
+		}
+	}
+
+	sc := models.Schedule{
+		Name:                 "scheduled",
+		Number:               "SC100",
+		OriginAirportID:      svo.ID,
+		DestinationAirportID: led.ID,
+		Days:                 models.Monday | models.Wednesday | models.Friday,
+		DepartureTime:        "09:30",
+		Duration:             80,
+		Fare:                 100,
+		ValidFrom:            now.AddDate(0, 0, 1).Format("2006-01-02"),
+		ValidTo:              now.AddDate(0, 0, 14).Format("2006-01-02"),
+		Exceptions:           models.DateList{days[0]},
+	}
+
+	sc = testSaveSchedule(t, cfg, "POST", "http://"+listenOn+"/schedules", sc)
+
+	flights := testScheduleFlights(t, cfg, sc.ID)
+
+	if len(flights) != len(days)-1 {
+		t.Fatalf("\nExpected flights: %d\nObtained: %d\n", len(days)-1, len(flights))
+	}
+
+	for i, f := range flights {
+		local := f.Departure.In(loc)
+
+		if f.ScheduleDate != days[i+1] || local.Format("2006-01-02 15:04") != days[i+1]+" 09:30" {
+			t.Fatalf("\nExpected departure: %s 09:30\nObtained: %s, %s\n", days[i+1], f.ScheduleDate, local)
+		}
+
+		if f.Destination != led.City || f.Arrival.Sub(f.Departure) != 80*time.Minute {
+			t.Fatalf("Unexpected flight - %v\n", f)
+		}
+	}
+
+	// Schedule and its flights are owned by the creator
+	owner, err := stores.Users.FindByName("schedules")
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if sc.CreatedBy == nil || *sc.CreatedBy != owner.ID || flights[0].CreatedBy == nil || *flights[0].CreatedBy != owner.ID {
+		t.Fatalf("\nExpected schedule and flights owned by %d\nObtained: %v, %v\n", owner.ID, sc.CreatedBy, flights[0].CreatedBy)
+	}
+
+	other := testAuth(t, "schedules-other", models.RoleOperator)
+	payload, _ := json.Marshal(sc)
+
+	for _, tc := range []struct {
+		method   string
+		endpoint string
+		payload  []byte
+		code     string
+	}{
+		{"PUT", fmt.Sprintf("http://%s/schedules/%d", listenOn, sc.ID), payload, "not_schedule_owner"},
+		{"POST", fmt.Sprintf("http://%s/schedules/%d/generate", listenOn, sc.ID), nil, "not_schedule_owner"},
+		{"DELETE", fmt.Sprintf("http://%s/schedules/%d", listenOn, sc.ID), nil, "not_schedule_owner"},
+		{"PUT", fmt.Sprintf("http://%s/flights/%d", listenOn, flights[0].ID), []byte(`{"fare": 1}`), "not_flight_owner"},
+	} {
+		r, err := rpc.Request(tc.method, tc.endpoint, tc.payload, other)
+		if err != nil {
+			t.Fatalf("Error requesting %s - %s\n", tc.endpoint, err)
+		}
+
+		testProblem(t, r, 403, tc.code)
+	}
+
+	// Generator is idempotent
+	endpoint := fmt.Sprintf("http://%s/schedules/%d/generate", listenOn, sc.ID)
+
+	r, err := rpc.Request("POST", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	result := models.GenerateResult{}
+
+	if err := helpers.Decode(r.Body, &result); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if result != (models.GenerateResult{}) {
+		t.Fatalf("\nExpected nothing to change\nObtained: %v\n", result)
+	}
+
+	// Edit an instance of a day, which will be removed from schedule
+	var edited models.Flight
+
+	for _, f := range flights {
+		if f.Departure.In(loc).Weekday() != time.Monday {
+			edited = f
+			break
+		}
+	}
+
+	endpoint = fmt.Sprintf("http://%s/flights/%d", listenOn, edited.ID)
+
+	r, err = rpc.Request("PUT", endpoint, []byte(`{"fare": 500}`), cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	sc.Days = models.Monday
+	sc.Fare = 200
+	sc.Exceptions = nil
+
+	testSaveSchedule(t, cfg, "PUT", fmt.Sprintf("http://%s/schedules/%d", listenOn, sc.ID), sc)
+
+	mondays := 0
+
+	for _, f := range testScheduleFlights(t, cfg, sc.ID) {
+		switch {
+		case f.ID == edited.ID:
+			if !f.Detached || f.Fare != 500 {
+				t.Fatalf("Expected edited flight to be kept, obtained: %v\n", f)
+			}
+		case f.Departure.In(loc).Weekday() == time.Monday && f.Fare == 200:
+			mondays++
+		default:
+			t.Fatalf("Unexpected flight - %v\n", f)
+		}
+	}
+
+	if mondays != 2 {
+		t.Fatalf("\nExpected Monday flights: %d\nObtained: %d\n", 2, mondays)
+	}
+
+	// Deleted schedule takes its flights except the edited one
+	endpoint = fmt.Sprintf("http://%s/schedules/%d", listenOn, sc.ID)
+
+	r, err = rpc.Request("DELETE", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	kept, err := stores.Flights.Get(int(edited.ID))
+	if err != nil {
+		t.Fatalf("Expected edited flight to be kept, obtained: %s\n", err)
+	}
+
+	if kept.ScheduleID != nil {
+		t.Fatalf("\nExpected flight without schedule\nObtained: %d\n", *kept.ScheduleID)
+	}
+
+	// Generator changes are recorded without actor
+	var (
+		admin   = testAuth(t, "schedules-admin", models.RoleAdmin)
+		ids     []string
+		updated int
+	)
+
+	for _, f := range flights {
+		ids = append(ids, fmt.Sprint(f.ID))
+
+		if f.Departure.In(loc).Weekday() == time.Monday {
+			updated++
+		}
+	}
+
+	for _, tc := range []struct {
+		action string
+		count  int
+	}{
+		{models.AuditCreate, len(flights)},
+		{models.AuditUpdate, updated},
+		{models.AuditDelete, len(flights) - 1},
+	} {
+		page := testAuditEntries(t, admin, fmt.Sprintf("resource=flight&id=%s&action=%s", strings.Join(ids, ","), tc.action))
+
+		generated := 0
+		for _, e := range page.Entries {
+			if e.ActorID == nil && e.OrganizationID == models.DefaultOrganizationID {
+				generated++
+			}
+		}
+
+		// Edited flight is updated by its owner
+		if generated != tc.count {
+			t.Fatalf("\nExpected %s entries without actor: %d\nObtained: %v\n", tc.action, tc.count, page.Entries)
+		}
+	}
+
+	r, err = rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 404 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 404, r.StatusCode)
+	}
+}
+
+func TestScheduleConflict(t *testing.T) {
+	testLoadAirports(t)
+
+	var (
+		cfg = testAuth(t, "schedules-conflict", models.RoleOperator)
+		svo = testAirport(t, "SVO")
+		led = testAirport(t, "LED")
+		now = time.Now().In(svo.Location())
+	)
+
+	// Flight with the same number is already scheduled on the third day
+	day := now.AddDate(0, 0, 3)
+	dep := time.Date(day.Year(), day.Month(), day.Day(), 9, 30, 0, 0, svo.Location())
+
+	f := models.Flight{Name: "conflict", Number: "SC200", Destination: led.City, Scheduled: dep, Departure: dep, Fare: 100, Duration: 80}
+	if err := stores.Flights.Create(&f); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	sc := models.Schedule{
+		Name:                 "conflict",
+		Number:               "SC200",
+		OriginAirportID:      svo.ID,
+		DestinationAirportID: led.ID,
+		Days:                 models.EveryDay,
+		DepartureTime:        "09:30",
+		Duration:             80,
+		Fare:                 100,
+		ValidFrom:            now.AddDate(0, 0, 1).Format("2006-01-02"),
+		ValidTo:              now.AddDate(0, 0, 3).Format("2006-01-02"),
+	}
+
+	payload, _ := json.Marshal(sc)
+
+	// Schedule, which flights can't be generated, is not saved
+	endpoint := "http://" + listenOn + "/schedules"
+
+	r, err := rpc.Request("POST", endpoint, payload, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 409, "flight_exists")
+
+	schedules, err := stores.Schedules.List()
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	for _, tmp := range schedules {
+		if tmp.Number == "SC200" {
+			t.Fatalf("Expected schedule not to be saved, obtained: %v\n", tmp)
+		}
+	}
+
+	result, err := stores.Flights.Find(models.Search{Numbers: []string{"SC200"}, Limit: models.DefaultSearchLimit})
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(result.Flights) != 1 || result.Flights[0].ID != f.ID {
+		t.Fatalf("\nExpected flights: [%d]\nObtained: %v\n", f.ID, result.Flights)
+	}
+
+	// Schedule update, which flights can't be generated, is reverted
+	sc.Number = "SC300"
+	sc = testSaveSchedule(t, cfg, "POST", endpoint, sc)
+
+	sc.Number = "SC200"
+	payload, _ = json.Marshal(sc)
+	endpoint = fmt.Sprintf("http://%s/schedules/%d", listenOn, sc.ID)
+
+	r, err = rpc.Request("PUT", endpoint, payload, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	testProblem(t, r, 409, "flight_exists")
+
+	cur, err := stores.Schedules.Find(sc.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if cur.Number != "SC300" {
+		t.Fatalf("\nExpected schedule number: %s\nObtained: %s\n", "SC300", cur.Number)
+	}
+
+	flights := testScheduleFlights(t, cfg, sc.ID)
+
+	if len(flights) != 3 {
+		t.Fatalf("\nExpected flights: %d\nObtained: %d\n", 3, len(flights))
+	}
+
+	for _, tmp := range flights {
+		if tmp.Number != "SC300" {
+			t.Fatalf("Unexpected flight - %v\n", tmp)
+		}
+	}
+}
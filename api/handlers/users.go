@@ -2,64 +2,118 @@ package handlers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/julienschmidt/httprouter"
 
+	m "github.com/3d0c/sample-api/api/middleware"
 	"github.com/3d0c/sample-api/api/models"
 	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
 )
 
 type usersHandler struct {
-	*models.User
+	store         models.UserStore
+	tokens        models.TokenStore
+	organizations models.OrganizationStore
+	audit         models.AuditStore
+	keys          models.Signer
 }
 
-func users() *usersHandler {
-	return &usersHandler{User: &models.User{}}
+func users(s *models.Stores, keys models.Signer) *usersHandler {
+	return &usersHandler{store: s.Users, tokens: s.Tokens, organizations: s.Organizations, audit: s.Audit, keys: keys}
 }
 
-func (u *usersHandler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+// registration is a new user, who may be invited to organization
+type registration struct {
+	models.User
+	Invitation string `json:"invitation"`
+}
+
+func (h *usersHandler) create(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
 	var (
+		reg registration
+		inv *models.Invitation
 		err error
 	)
 
-	if err = helpers.Decode(r.Body, &u); err != nil {
+	if err = helpers.Decode(r.Body, &reg); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	u := reg.User
+	u.ID = 0
+	// Self registered users can only read in the default organization,
+	// roles are granted by admin
+	u.OrganizationID, u.Role = models.DefaultOrganizationID, models.RoleViewer
+
+	var v problem.Validation
+
+	if err = v.Merge(u.Validate()); err != nil {
 		return http.StatusInternalServerError, err
 	}
 
-	if err = u.Validate(); err != nil {
+	models.Policy.Check(&v, "password", u.Name, u.Password)
+
+	if err = v.Err(); err != nil {
 		return http.StatusBadRequest, err
 	}
 
-	if err = u.Create(); err != nil {
+	if _, err = h.store.FindByName(u.Name); err == nil {
+		return http.StatusConflict, models.ErrUserExists
+	} else if err != models.ErrNotFound {
+		return http.StatusInternalServerError, err
+	}
+
+	// Invited users join organization with the role of invitation
+	if reg.Invitation != "" {
+		if inv, err = models.AcceptInvitation(h.organizations, reg.Invitation); err != nil {
+			return http.StatusBadRequest, err
+		}
+
+		u.OrganizationID, u.Role = inv.OrganizationID, inv.Role
+	}
+
+	if err = u.HashPassword(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.store.Create(&u); err != nil {
 		return http.StatusBadRequest, err
 	}
 
 	// Hide password from output
 	u.Password = ""
 
+	if err = record(h.audit, r, u.OrganizationID, models.AuditCreate, models.AuditUser, u.ID, nil, &u); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
 	helpers.NewJsonResponder(w).Write(u)
 
 	return http.StatusOK, nil
 }
 
-func (u *usersHandler) login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+func (h *usersHandler) login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
 	var (
-		err error
+		u    models.User
+		user *models.User
+		err  error
 	)
 
 	if err = helpers.Decode(r.Body, &u); err != nil {
-		return http.StatusInternalServerError, err
+		return http.StatusBadRequest, problem.Malformed(err)
 	}
 
 	if err = u.Validate(); err != nil {
 		return http.StatusBadRequest, err
 	}
 
-	if u.User, err = u.Find(); err != nil {
-		return http.StatusNotFound, err
+	if user, err = u.Authenticate(h.store); err != nil {
+		return http.StatusUnauthorized, err
 	}
 
-	token, err := u.GenerateJWT()
+	token, err := user.GenerateJWT(h.tokens, h.keys)
 	if err != nil {
 		return http.StatusInternalServerError, err
 	}
@@ -68,3 +122,287 @@ func (u *usersHandler) login(w http.ResponseWriter, r *http.Request, _ httproute
 
 	return http.StatusOK, nil
 }
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *usersHandler) refresh(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		req   refreshRequest
+		token models.JWTToken
+		err   error
+	)
+
+	if err = helpers.Decode(r.Body, &req); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	var v problem.Validation
+
+	v.Check(req.RefreshToken != "", "refresh_token", "required", "Please provide refresh_token")
+
+	if err = v.Err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if token, err = models.RefreshJWT(h.tokens, h.store, h.keys, req.RefreshToken); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	helpers.NewJsonResponder(w).Write(token)
+
+	return http.StatusOK, nil
+}
+
+func (h *usersHandler) logout(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	if err := h.revoke(r); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// revoke revokes token family of the caller and its access token
+func (h *usersHandler) revoke(r *http.Request) error {
+	id, _ := m.CurrentIdentity(r.Context())
+
+	if id.Family != "" {
+		if err := models.RevokeTokenFamily(h.tokens, id.Family); err != nil {
+			return err
+		}
+	}
+
+	if id.TokenID != "" {
+		if err := h.tokens.Deny(id.TokenID, id.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tenant returns users of the caller organization
+func (h *usersHandler) tenant(r *http.Request) models.UserStore {
+	return h.store.Tenant(m.OrganizationID(r.Context()))
+}
+
+func userID(ps httprouter.Params) (uint, error) {
+	id, err := strconv.ParseUint(ps.ByName("id"), 10, 32)
+	if err != nil || id == 0 {
+		return 0, problem.BadRequest("invalid_id", "user id must be a positive integer")
+	}
+
+	return uint(id), nil
+}
+
+// current returns the caller, it may be deleted since token was issued
+func (h *usersHandler) current(r *http.Request) (*models.User, error) {
+	uid, _ := m.UserID(r.Context())
+
+	return h.tenant(r).Find(uid)
+}
+
+// writeUser responds with user, password hash is never returned
+func writeUser(w http.ResponseWriter, u *models.User) (int, error) {
+	u.Password = ""
+
+	helpers.NewJsonResponder(w).Write(u)
+
+	return http.StatusOK, nil
+}
+
+// me returns the caller profile
+func (h *usersHandler) me(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	u, err := h.current(r)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return writeUser(w, u)
+}
+
+// profile is a change of the caller profile, omitted fields are kept
+type profile struct {
+	Name     *string      `json:"name"`
+	Password *string      `json:"password"`
+	Role     *models.Role `json:"role"`
+}
+
+// updateMe changes the caller name. Password and role have their own
+// endpoints.
+func (h *usersHandler) updateMe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		p   profile
+		v   problem.Validation
+		cur *models.User
+		err error
+	)
+
+	if err = helpers.Decode(r.Body, &p); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	v.Check(p.Name == nil || *p.Name != "", "name", "required", "Please provide username")
+	v.Check(p.Password == nil, "password", "read_only", "Password is changed by POST /users/me/password")
+	v.Check(p.Role == nil, "role", "read_only", "Role is granted by admin")
+
+	if err = v.Err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if cur, err = h.current(r); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	u := *cur
+
+	if p.Name != nil {
+		u.Name = *p.Name
+	}
+
+	if err = h.tenant(r).Update(&u); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = record(h.audit, r, u.OrganizationID, models.AuditUpdate, models.AuditUser, u.ID, cur, &u); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return writeUser(w, &u)
+}
+
+type passwordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// changePassword sets new password of the caller, current one is required
+func (h *usersHandler) changePassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	var (
+		req passwordChange
+		v   problem.Validation
+		cur *models.User
+		err error
+	)
+
+	if err = helpers.Decode(r.Body, &req); err != nil {
+		return http.StatusBadRequest, problem.Malformed(err)
+	}
+
+	v.Check(req.CurrentPassword != "", "current_password", "required", "Please provide current_password")
+	v.Check(req.NewPassword != "", "new_password", "required", "Please provide new_password")
+
+	if cur, err = h.current(r); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	models.Policy.Check(&v, "new_password", cur.Name, req.NewPassword)
+
+	if err = v.Err(); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	if err = cur.CheckPassword(req.CurrentPassword); err != nil {
+		return http.StatusForbidden, err
+	}
+
+	u := *cur
+	u.Password = req.NewPassword
+
+	if err = u.HashPassword(); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.tenant(r).Update(&u); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = record(h.audit, r, u.OrganizationID, models.AuditUpdate, models.AuditUser, u.ID, cur, &u); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// removeMe deletes the caller and revokes its tokens
+func (h *usersHandler) removeMe(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	u, err := h.current(r)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.delete(r, u); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.revoke(r); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// list returns users of the caller organization
+func (h *usersHandler) list(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+	result, err := h.tenant(r).List()
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	for i := range result {
+		result[i].Password = ""
+	}
+
+	helpers.NewJsonResponder(w).Write(result)
+
+	return http.StatusOK, nil
+}
+
+func (h *usersHandler) get(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	id, err := userID(ps)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	u, err := h.tenant(r).Find(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return writeUser(w, u)
+}
+
+// remove deletes user of the caller organization, its tokens are rejected
+// right away
+func (h *usersHandler) remove(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (int, error) {
+	id, err := userID(ps)
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	u, err := h.tenant(r).Find(id)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	if err = h.delete(r, u); err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return http.StatusOK, nil
+}
+
+// delete deletes the user with its confirmed bookings, so their seats
+// are released, and revokes its tokens
+func (h *usersHandler) delete(r *http.Request, u *models.User) error {
+	if err := h.tenant(r).Delete(u.ID); err != nil {
+		return err
+	}
+
+	if err := models.RevokeUserTokens(h.tokens, u.ID); err != nil {
+		return err
+	}
+
+	return record(h.audit, r, u.OrganizationID, models.AuditDelete, models.AuditUser, u.ID, u, nil)
+}
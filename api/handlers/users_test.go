@@ -1,17 +1,20 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/3d0c/sample-api/api/models"
 	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
 	"github.com/3d0c/sample-api/pkg/rpc"
 )
 
 func TestCreateUser(t *testing.T) {
 	endpoint := "http://" + listenOn + "/users"
-	payload := `{"name": "test", "password": "test"}`
+	payload := `{"name": "test", "password": "test-password"}`
 
 	r, err := rpc.Request("POST", endpoint, []byte(payload), nil)
 	if err != nil {
@@ -36,12 +39,21 @@ func TestCreateUser(t *testing.T) {
 		t.Fatalf("\nExpected user name: %s\nObtained: %s\n", "test", result.Name)
 	}
 
+	if result.Role != models.RoleViewer {
+		t.Fatalf("\nExpected user role: %s\nObtained: %s\n", models.RoleViewer, result.Role)
+	}
+
+	// Flight management requires operator
+	if err := stores.Users.SetRole("test", models.RoleOperator); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
 	testLoginUser(t, result.ID)
 }
 
 func testLoginUser(t *testing.T, userID uint) {
 	endpoint := "http://" + listenOn + "/users/login"
-	payload := `{"name": "test", "password": "test"}`
+	payload := `{"name": "test", "password": "test-password"}`
 
 	r, err := rpc.Request("POST", endpoint, []byte(payload), nil)
 	if err != nil {
@@ -62,12 +74,412 @@ func testLoginUser(t *testing.T, userID uint) {
 		t.Fatalf("Expected non 0 length token\n")
 	}
 
-	u := &models.User{ID: userID}
-
-	if err := u.Delete(); err != nil {
+	if err := stores.Users.Delete(userID); err != nil {
 		t.Fatalf("Error remove temoporary user - %s\n", err)
 	}
 
 	rpcCfg = &rpc.Config{Headers: make(http.Header)}
 	rpcCfg.Headers.Set("Authorization", "Bearer "+result.Token)
 }
+
+func TestTokenRefresh(t *testing.T) {
+	testAuth(t, "refresh", models.RoleViewer)
+
+	first := testLogin(t, "refresh", "refresh")
+
+	second := models.JWTToken{}
+	r := testRefresh(t, first.RefreshToken)
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	if err := helpers.Decode(r.Body, &second); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("Expected rotated refresh token\n")
+	}
+
+	if status := testBearerStatus(t, second.Token); status != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, status)
+	}
+
+	// Reusing rotated token revokes the whole family
+	if r = testRefresh(t, first.RefreshToken); r.StatusCode != 401 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 401, r.StatusCode)
+	}
+
+	if r = testRefresh(t, second.RefreshToken); r.StatusCode != 401 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 401, r.StatusCode)
+	}
+
+	if status := testBearerStatus(t, second.Token); status != 401 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 401, status)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	testAuth(t, "logout", models.RoleViewer)
+
+	token := testLogin(t, "logout", "logout")
+
+	endpoint := "http://" + listenOn + "/users/logout"
+	cfg := &rpc.Config{Headers: make(http.Header)}
+	cfg.Headers.Set("Authorization", "Bearer "+token.Token)
+
+	r, err := rpc.Request("POST", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	if status := testBearerStatus(t, token.Token); status != 401 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 401, status)
+	}
+
+	if r = testRefresh(t, token.RefreshToken); r.StatusCode != 401 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 401, r.StatusCode)
+	}
+}
+
+func testLogin(t *testing.T, name, password string) models.JWTToken {
+	endpoint := "http://" + listenOn + "/users/login"
+	payload := fmt.Sprintf(`{"name": "%s", "password": "%s"}`, name, password)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), nil)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	result := models.JWTToken{}
+
+	if err := helpers.Decode(r.Body, &result); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if result.Token == "" || result.RefreshToken == "" {
+		t.Fatalf("Expected access and refresh tokens\n")
+	}
+
+	return result
+}
+
+func testRefresh(t *testing.T, refresh string) *http.Response {
+	endpoint := "http://" + listenOn + "/users/token/refresh"
+	payload := fmt.Sprintf(`{"refresh_token": "%s"}`, refresh)
+
+	r, err := rpc.Request("POST", endpoint, []byte(payload), nil)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	return r
+}
+
+// testBearerStatus returns status code of flights search made with the token
+func testBearerStatus(t *testing.T, token string) int {
+	endpoint := "http://" + listenOn + "/flights"
+	cfg := &rpc.Config{Headers: make(http.Header)}
+	cfg.Headers.Set("Authorization", "Bearer "+token)
+
+	r, err := rpc.Request("GET", endpoint, nil, cfg)
+	if err != nil {
+		t.Fatalf("Error requesting %s - %s\n", endpoint, err)
+	}
+
+	return r.StatusCode
+}
+
+// testUserConfig returns rpc config with bearer token
+func testUserConfig(token string) *rpc.Config {
+	cfg := &rpc.Config{Headers: make(http.Header)}
+	cfg.Headers.Set("Content-Type", "application/json")
+	cfg.Headers.Set("Authorization", "Bearer "+token)
+
+	return cfg
+}
+
+// testBookedSeats returns number of booked economy seats of flight
+func testBookedSeats(t *testing.T, cfg *rpc.Config, fid uint) int {
+	r := testRequest(t, "GET", fmt.Sprintf("http://%s/flights/%d/seats", listenOn, fid), "", cfg)
+	seats := []seatsView{}
+
+	if err := helpers.Decode(r.Body, &seats); err != nil || r.StatusCode != 200 || len(seats) != 1 {
+		t.Fatalf("\nExpected seats of economy cabin\nObtained: %d, %v, %v\n", r.StatusCode, seats, err)
+	}
+
+	return seats[0].Booked
+}
+
+func TestUserAccounts(t *testing.T) {
+	var (
+		admin    = testAuth(t, "accounts-admin", models.RoleAdmin)
+		endpoint = "http://" + listenOn + "/users"
+		u        = models.User{}
+	)
+
+	testAuth(t, "accounts-viewer", models.RoleViewer)
+
+	token := testLogin(t, "accounts-viewer", "accounts-viewer")
+	viewer := testUserConfig(token.Token)
+
+	r := testRequest(t, "GET", endpoint+"/me", "", viewer)
+	if err := helpers.Decode(r.Body, &u); err != nil || r.StatusCode != 200 || u.Name != "accounts-viewer" || u.Password != "" {
+		t.Fatalf("\nExpected own profile without password\nObtained: %d, %v, %v\n", r.StatusCode, u, err)
+	}
+
+	// Name is changed alone, it stays unique
+	r = testRequest(t, "PATCH", endpoint+"/me", `{"name": "", "password": "x", "role": "admin"}`, viewer)
+	testProblem(t, r, 400, problem.CodeValidation, "name", "password", "role")
+
+	r = testRequest(t, "PATCH", endpoint+"/me", `{"name": "accounts-admin"}`, viewer)
+	testProblem(t, r, 409, "user_exists")
+
+	r = testRequest(t, "PATCH", endpoint+"/me", `{"name": "accounts-renamed"}`, viewer)
+	if err := helpers.Decode(r.Body, &u); err != nil || r.StatusCode != 200 || u.Name != "accounts-renamed" || u.Role != models.RoleViewer {
+		t.Fatalf("\nExpected renamed viewer\nObtained: %d, %v, %v\n", r.StatusCode, u, err)
+	}
+
+	// Password is changed with the current one
+	r = testRequest(t, "POST", endpoint+"/me/password", `{}`, viewer)
+	testProblem(t, r, 400, problem.CodeValidation, "current_password", "new_password")
+
+	r = testRequest(t, "POST", endpoint+"/me/password", `{"current_password": "accounts-viewer", "new_password": "qwerty123"}`, viewer)
+	testProblem(t, r, 400, problem.CodeValidation, "new_password")
+
+	r = testRequest(t, "POST", endpoint+"/me/password", `{"current_password": "wrong", "new_password": "changed-password"}`, viewer)
+	testProblem(t, r, 403, "wrong_password")
+
+	r = testRequest(t, "POST", endpoint+"/me/password", `{"current_password": "accounts-viewer", "new_password": "changed-password"}`, viewer)
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	r = testRequest(t, "POST", endpoint+"/login", `{"name": "accounts-renamed", "password": "accounts-viewer"}`, nil)
+	testProblem(t, r, 401, "wrong_credentials")
+
+	testLogin(t, "accounts-renamed", "changed-password")
+
+	page := testAuditEntries(t, admin, fmt.Sprintf("resource=user&id=%d&action=update", u.ID))
+
+	if len(page.Entries) != 2 || page.Entries[1].Changes["name"].After == nil {
+		t.Fatalf("\nExpected name and password updates\nObtained: %v\n", page.Entries)
+	}
+
+	if c, ok := page.Entries[0].Changes["password"]; !ok || c.Before != nil || c.After != nil {
+		t.Fatalf("\nExpected password change without values\nObtained: %v\n", page.Entries[0].Changes)
+	}
+
+	// Users are managed by admins
+	for _, tc := range []struct {
+		method   string
+		endpoint string
+	}{
+		{"GET", endpoint},
+		{"GET", fmt.Sprintf("%s/%d", endpoint, u.ID)},
+		{"DELETE", fmt.Sprintf("%s/%d", endpoint, u.ID)},
+	} {
+		r = testRequest(t, tc.method, tc.endpoint, "", viewer)
+		testProblem(t, r, 403, "insufficient_role")
+	}
+
+	r = testRequest(t, "GET", endpoint, "", admin)
+	users := []models.User{}
+
+	if err := helpers.Decode(r.Body, &users); err != nil || r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d, %v\n", 200, r.StatusCode, err)
+	}
+
+	found := false
+	for _, tmp := range users {
+		if tmp.Password != "" || tmp.OrganizationID != models.DefaultOrganizationID {
+			t.Fatalf("\nExpected users of the default organization without passwords\nObtained: %v\n", tmp)
+		}
+		found = found || tmp.ID == u.ID
+	}
+
+	if !found {
+		t.Fatalf("\nExpected user %d in %v\n", u.ID, users)
+	}
+
+	r = testRequest(t, "GET", fmt.Sprintf("%s/%d", endpoint, u.ID), "", admin)
+	obtained := models.User{}
+
+	if err := helpers.Decode(r.Body, &obtained); err != nil || obtained.Name != "accounts-renamed" || obtained.Password != "" {
+		t.Fatalf("\nExpected renamed user\nObtained: %v, %v\n", obtained, err)
+	}
+
+	r = testRequest(t, "GET", endpoint+"/x", "", admin)
+	testProblem(t, r, 400, "invalid_id")
+
+	// Admin deletes users of its organization only
+	partner := models.Organization{Name: "Accounts Partner"}
+
+	if err := stores.Organizations.Create(&partner); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	other := &models.User{Name: "accounts-partner", Password: "x"}
+
+	if err := stores.Users.Tenant(partner.ID).Create(other); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	for _, method := range []string{"GET", "DELETE"} {
+		r = testRequest(t, method, fmt.Sprintf("%s/%d", endpoint, other.ID), "", admin)
+		testProblem(t, r, 404, problem.CodeNotFound)
+	}
+
+	// Seats booked by deleted users are released, their tokens are revoked
+	booker := testAuth(t, "accounts-removed", models.RoleViewer)
+	fid := testBookableFlight(t, "AC1", map[models.Cabin]int{models.CabinEconomy: 3})
+
+	if status, _ := testBook(t, booker, fid, `{"cabin": "economy", "seats": 2}`); status != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, status)
+	}
+
+	if status, _ := testBook(t, viewer, fid, `{"cabin": "economy", "seats": 1}`); status != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, status)
+	}
+
+	removed, err := stores.Users.FindByName("accounts-removed")
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	r = testRequest(t, "DELETE", fmt.Sprintf("%s/%d", endpoint, removed.ID), "", admin)
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	if booked := testBookedSeats(t, admin, fid); booked != 1 {
+		t.Fatalf("\nExpected booked: %d\nObtained: %d\n", 1, booked)
+	}
+
+	// Tokens of deleted user are rejected before they expire
+	r = testRequest(t, "GET", endpoint+"/me", "", booker)
+	testProblem(t, r, 401, "token_revoked")
+
+	r = testRequest(t, "DELETE", fmt.Sprintf("%s/%d", endpoint, removed.ID), "", admin)
+	testProblem(t, r, 404, problem.CodeNotFound)
+
+	// Deleting own account deletes the caller only and logs it out
+	r = testRequest(t, "DELETE", endpoint+"/me", "", viewer)
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	if _, err := stores.Users.Find(u.ID); err != models.ErrNotFound {
+		t.Fatalf("\nExpected: %v\nObtained: %v\n", models.ErrNotFound, err)
+	}
+
+	if booked := testBookedSeats(t, admin, fid); booked != 0 {
+		t.Fatalf("\nExpected booked: %d\nObtained: %d\n", 0, booked)
+	}
+
+	if _, err := stores.Users.FindByName("accounts-admin"); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if status := testBearerStatus(t, token.Token); status != 401 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 401, status)
+	}
+
+	if r = testRefresh(t, token.RefreshToken); r.StatusCode != 401 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 401, r.StatusCode)
+	}
+
+	// Other users of /users/:id/bookings are not found
+	r = testRequest(t, "GET", endpoint+"/1/bookings", "", admin)
+	testProblem(t, r, 404, problem.CodeNotFound)
+}
+
+func TestPasswords(t *testing.T) {
+	endpoint := "http://" + listenOn + "/users"
+
+	for _, tc := range []struct {
+		name     string
+		password string
+		code     string
+	}{
+		{"passwords-short", "Ab1!", "too_short"},
+		{"passwords-common", "Password123", "too_common"},
+		{"passwords-same", "Passwords-Same", "same_as_name"},
+		{"passwords-long", strings.Repeat("x", 73), "too_long"},
+	} {
+		r := testRequest(t, "POST", endpoint, fmt.Sprintf(`{"name": "%s", "password": "%s"}`, tc.name, tc.password), nil)
+		p := problem.Document{}
+
+		if err := helpers.Decode(r.Body, &p); err != nil || r.StatusCode != 400 {
+			t.Fatalf("\nExpected status code: %d\nObtained: %d, %v\n", 400, r.StatusCode, err)
+		}
+
+		if len(p.Fields) != 1 || p.Fields[0].Field != "password" || p.Fields[0].Code != tc.code {
+			t.Fatalf("\nExpected password %s\nObtained: %v\n", tc.code, p.Fields)
+		}
+	}
+
+	// Character classes are required by configuration
+	models.Policy.Classes = 3
+	r := testRequest(t, "POST", endpoint, `{"name": "passwords-simple", "password": "lowercase-only"}`, nil)
+	models.Policy.Classes = 0
+
+	testProblem(t, r, 400, problem.CodeValidation, "password")
+
+	// Hash is replaced on login when algorithm or cost is changed
+	r = testRequest(t, "POST", endpoint, `{"name": "passwords-rehash", "password": "Rehash-Password-1"}`, nil)
+	if r.StatusCode != 200 {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", 200, r.StatusCode)
+	}
+
+	bcryptHasher := models.Hasher
+
+	for _, spec := range []string{"argon2id,m=64,t=1,p=1", "argon2id,m=128,t=1,p=1", "bcrypt,cost=5"} {
+		hasher, err := models.ParsePasswordHasher(spec)
+		if err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		models.Hasher = hasher
+		testLogin(t, "passwords-rehash", "Rehash-Password-1")
+		models.Hasher = bcryptHasher
+
+		u, err := stores.Users.FindByName("passwords-rehash")
+		if err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		if hasher.NeedsRehash(u.Password) || !models.VerifyPassword(u.Password, "Rehash-Password-1") {
+			t.Fatalf("\nExpected password rehashed with %s\nObtained: %s\n", spec, u.Password)
+		}
+	}
+
+	// Rehash of password changed since it was read keeps the new one
+	u, err := stores.Users.FindByName("passwords-rehash")
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if err = stores.Users.Rehash(u.ID, "stale-hash", "rehashed"); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if obtained, err := stores.Users.Find(u.ID); err != nil || obtained.Password != u.Password || obtained.Name != u.Name {
+		t.Fatalf("\nExpected: %v\nObtained: %v, %v\n", u, obtained, err)
+	}
+
+	for _, spec := range []string{"scrypt", "bcrypt,cost=99", "argon2id,m=0", "argon2id,x=1", "argon2id,p=300"} {
+		if _, err := models.ParsePasswordHasher(spec); err == nil {
+			t.Fatalf("\nExpected error parsing %s\n", spec)
+		}
+	}
+}
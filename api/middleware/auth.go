@@ -4,47 +4,137 @@ import (
 	"context"
 	"errors"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/julienschmidt/httprouter"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+type contextKey string
+
+// Problem codes for rejected access tokens
+const (
+	CodeTokenInvalid = "token_invalid"
+	CodeTokenRevoked = "token_revoked"
 )
 
-func Auth(w http.ResponseWriter, r *http.Request, params httprouter.Params) (int, error) {
-	var (
-		authHeader string
-		ctx        context.Context
-	)
+const identityKey contextKey = "identity"
+
+// Identity is authenticated caller as described by access token claims
+type Identity struct {
+	UserID         uint
+	OrganizationID uint
+	Name           string
+	Role           models.Role
+	TokenID        string
+	Family         string
+	ExpiresAt      time.Time
+}
+
+// Verifier checks access token signature and returns its claims
+type Verifier interface {
+	Verify(token string) (jwt.MapClaims, error)
+}
+
+// Auth verifies bearer token, rejects revoked ones and puts caller
+// identity into request context
+func Auth(tokens models.TokenStore, v Verifier) Middleware {
+	return func(next Handler) Handler {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) (int, error) {
+			var (
+				authHeader string
+				ctx        context.Context
+				id         Identity
+				denied     bool
+				err        error
+			)
+
+			if authHeader = r.Header.Get("Authorization"); len(authHeader) < 8 {
+				return http.StatusUnauthorized, problem.Unauthorized(problem.CodeUnauthorized, "missing bearer token")
+			}
+
+			tokenString := authHeader[7:len(authHeader)]
+
+			claims, err := v.Verify(tokenString)
+			if err != nil {
+				return http.StatusUnauthorized, problem.Unauthorized(CodeTokenInvalid, err.Error())
+			}
+
+			if id, err = identity(claims); err != nil {
+				return http.StatusUnauthorized, problem.Unauthorized(CodeTokenInvalid, err.Error())
+			}
 
-	if authHeader = r.Header.Get("Authorization"); len(authHeader) < 8 {
-		return http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized))
+			if id.TokenID != "" {
+				if denied, err = tokens.IsDenied(id.TokenID); err != nil {
+					return http.StatusInternalServerError, err
+				}
+				if denied {
+					return http.StatusUnauthorized, problem.Unauthorized(CodeTokenRevoked, "token has been revoked")
+				}
+			}
+
+			ctx = r.Context()
+			ctx = context.WithValue(ctx, identityKey, id)
+
+			return next(w, r.WithContext(ctx), p)
+		}
+	}
+}
+
+func identity(claims jwt.MapClaims) (Identity, error) {
+	var result Identity
+
+	id, ok := claims["id"].(float64)
+	if !ok {
+		return result, errors.New("token has no user id")
 	}
 
-	tokenString := authHeader[7:len(authHeader)]
+	result.UserID = uint(id)
+	result.Name, _ = claims["name"].(string)
 
-	claims, err := verifyToken(tokenString)
-	if err != nil {
-		return http.StatusBadRequest, err
+	// Tokens issued before roles and revocation were introduced
+	// have no role, jti and fam claims
+	role, _ := claims["role"].(string)
+	result.Role = models.Role(role)
+	result.TokenID, _ = claims["jti"].(string)
+	result.Family, _ = claims["fam"].(string)
+
+	// Tokens issued before organizations belong to users of the default one
+	result.OrganizationID = models.DefaultOrganizationID
+	if org, ok := claims["org"].(float64); ok && org > 0 {
+		result.OrganizationID = uint(org)
 	}
 
-	ctx = r.Context()
-	ctx = context.WithValue(ctx, "userID", claims.(jwt.MapClaims)["id"])
+	if exp, ok := claims["exp"].(float64); ok {
+		result.ExpiresAt = time.Unix(int64(exp), 0).UTC()
+	}
 
-	r = r.WithContext(ctx)
+	return result, nil
+}
 
-	return http.StatusOK, nil
+// CurrentIdentity returns caller identity stored by Auth
+func CurrentIdentity(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey).(Identity)
+	return id, ok
 }
 
-func verifyToken(tokenString string) (jwt.Claims, error) {
-	// TODO, move secret to ENV
-	signingKey := []byte(os.Getenv("JWT_SECRET"))
+// UserID returns id of authenticated user stored by Auth
+func UserID(ctx context.Context) (uint, bool) {
+	id, ok := CurrentIdentity(ctx)
+	return id.UserID, ok
+}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return signingKey, nil
-	})
-	if err != nil {
-		return nil, err
-	}
+// OrganizationID returns organization of authenticated user stored by Auth
+func OrganizationID(ctx context.Context) uint {
+	id, _ := CurrentIdentity(ctx)
+	return id.OrganizationID
+}
 
-	return token.Claims, err
+// Role returns role of authenticated user stored by Auth
+func Role(ctx context.Context) models.Role {
+	id, _ := CurrentIdentity(ctx)
+	return id.Role
 }
@@ -1,33 +1,112 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
 
-	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/problem"
 )
 
-type Middlewares func(res http.ResponseWriter, request *http.Request, p httprouter.Params) (int, error)
+const RequestIDHeader = "X-Request-Id"
+
+const requestIDKey contextKey = "requestID"
+
+// Handler is an endpoint handler. It writes response body and returns status
+// code, or returns an error which is written as problem document instead of the body.
+type Handler func(w http.ResponseWriter, r *http.Request, p httprouter.Params) (int, error)
+
+// Middleware wraps handler. It can run code before and after next handler,
+// replace request or response writer passed to it or not call it at all.
+type Middleware func(next Handler) Handler
+
+// Middlewares is an ordered list of middlewares, the first one is the outermost
+type Middlewares []Middleware
+
+func Chain(m ...Middleware) Middlewares {
+	return Middlewares(m)
+}
+
+// Then wraps h with middlewares and returns router handle. Response is buffered
+// until the whole chain returns, so status code is always written before the body.
+// Every request gets an id, taken from X-Request-Id header or generated.
+// Errors are written as problem documents, see pkg/problem.
+func (m Middlewares) Then(h Handler) httprouter.Handle {
+	for i := len(m) - 1; i >= 0; i-- {
+		h = m[i](h)
+	}
 
-func Chain(m ...Middlewares) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		var (
-			err    error
-			status int
-		)
-
-		for _, middleware := range m {
-			if status, err = middleware(w, r, p); err != nil {
-				break
-			}
+		buf := &responseBuffer{ResponseWriter: w}
+
+		rid := r.Header.Get(RequestIDHeader)
+		if rid == "" || len(rid) > 64 {
+			rid = newRequestID()
 		}
 
-		w.WriteHeader(status)
+		w.Header().Set(RequestIDHeader, rid)
+
+		r = r.WithContext(context.WithValue(r.Context(), requestIDKey, rid))
+
+		status, err := h(buf, r, p)
 
 		if err != nil {
-			helpers.NewJsonResponder(w).Write(helpers.Error{Error: err.Error()})
+			if status >= http.StatusInternalServerError {
+				log.Printf("Request %s %s %s failed - %s\n", rid, r.Method, r.URL.Path, err)
+			}
+
+			problem.Write(w, err, status, rid, r.URL.Path)
 			return
 		}
+
+		// Explicit WriteHeader call takes precedence over returned status
+		if buf.status != 0 {
+			status = buf.status
+		}
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		w.WriteHeader(status)
+
+		if _, err = w.Write(buf.body.Bytes()); err != nil {
+			log.Printf("Error writing response - %s\n", err)
+		}
 	}
 }
+
+// RequestID returns id of the request assigned by Chain
+func RequestID(ctx context.Context) string {
+	rid, _ := ctx.Value(requestIDKey).(string)
+	return rid
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// responseBuffer collects status and body, headers go directly to underlying writer
+type responseBuffer struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	b.status = status
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	return b.body.Write(p)
+}
@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/jwks"
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+type testKey string
+
+func TestChainOrderAndContext(t *testing.T) {
+	var trace []string
+
+	mw := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) (int, error) {
+				trace = append(trace, name+" before")
+
+				ctx := context.WithValue(r.Context(), testKey(name), true)
+				status, err := next(w, r.WithContext(ctx), p)
+
+				trace = append(trace, name+" after")
+				return status, err
+			}
+		}
+	}
+
+	h := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+		for _, name := range []string{"first", "second"} {
+			if r.Context().Value(testKey(name)) == nil {
+				t.Fatalf("Expected context value from %s middleware\n", name)
+			}
+		}
+
+		trace = append(trace, "handler")
+		w.Write([]byte("created"))
+
+		return http.StatusCreated, nil
+	}
+
+	rec := httptest.NewRecorder()
+	Chain(mw("first"), mw("second")).Then(h)(rec, httptest.NewRequest("GET", "/", nil), nil)
+
+	expected := []string{"first before", "second before", "handler", "second after", "first after"}
+
+	if len(trace) != len(expected) {
+		t.Fatalf("\nExpected: %v\nObtained: %v\n", expected, trace)
+	}
+	for i := range expected {
+		if trace[i] != expected[i] {
+			t.Fatalf("\nExpected: %v\nObtained: %v\n", expected, trace)
+		}
+	}
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", http.StatusCreated, rec.Code)
+	}
+
+	if rec.Body.String() != "created" {
+		t.Fatalf("\nExpected body: %s\nObtained: %s\n", "created", rec.Body.String())
+	}
+}
+
+func TestChainError(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+		w.Write([]byte("partial"))
+		return http.StatusConflict, errors.New("conflict")
+	}
+
+	rec := httptest.NewRecorder()
+	Chain().Then(h)(rec, httptest.NewRequest("GET", "/", nil), nil)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", http.StatusConflict, rec.Code)
+	}
+
+	if rec.Body.String() == "partial" {
+		t.Fatalf("Expected partial body to be discarded\n")
+	}
+
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Fatalf("Expected request id header\n")
+	}
+}
+
+func TestChainProblem(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+		if RequestID(r.Context()) != "abc" {
+			t.Fatalf("\nExpected request id: %s\nObtained: %s\n", "abc", RequestID(r.Context()))
+		}
+
+		return http.StatusInternalServerError, problem.NotFound("no such thing")
+	}
+
+	req := httptest.NewRequest("GET", "/things/1", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+
+	rec := httptest.NewRecorder()
+	Chain().Then(h)(rec, req, nil)
+
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", http.StatusNotFound, rec.Code)
+	}
+
+	doc := problem.Document{}
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if doc.Code != problem.CodeNotFound || doc.RequestID != "abc" || doc.Instance != "/things/1" || doc.Status != 404 {
+		t.Fatalf("Unexpected problem - %v\n", doc)
+	}
+}
+
+func TestAuthUserID(t *testing.T) {
+	keys, err := jwks.Generate()
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	token, err := keys.Sign(jwt.MapClaims{"id": 42})
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	var obtained uint
+
+	h := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+		obtained, _ = UserID(r.Context())
+		return http.StatusOK, nil
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rec := httptest.NewRecorder()
+	Chain(Auth(models.NewMemoryStores().Tokens, keys)).Then(h)(rec, req, nil)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", http.StatusOK, rec.Code)
+	}
+
+	if obtained != 42 {
+		t.Fatalf("\nExpected user id: %d\nObtained: %d\n", 42, obtained)
+	}
+}
+
+func TestAuthDenied(t *testing.T) {
+	tokens := models.NewMemoryStores().Tokens
+
+	keys, err := jwks.Generate()
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	token, err := keys.Sign(jwt.MapClaims{"id": 42, "jti": "revoked"})
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if err = tokens.Deny("revoked", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	h := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+		t.Fatalf("Handler must not be called with revoked token\n")
+		return http.StatusOK, nil
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	rec := httptest.NewRecorder()
+	Chain(Auth(tokens, keys)).Then(h)(rec, req, nil)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("\nExpected status code: %d\nObtained: %d\n", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestConditional(t *testing.T) {
+	var etag string
+
+	h := func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) (int, error) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Write([]byte("body"))
+		return http.StatusOK, nil
+	}
+
+	request := func(tag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		if tag != "" {
+			req.Header.Set("If-None-Match", tag)
+		}
+
+		rec := httptest.NewRecorder()
+		Chain(Conditional()).Then(h)(rec, req, nil)
+
+		return rec
+	}
+
+	rec := request("")
+	weak := rec.Header().Get("ETag")
+
+	if rec.Code != http.StatusOK || rec.Body.String() != "body" || weak[:2] != `W/` {
+		t.Fatalf("Expected body with weak ETag, obtained: %d, %s, %s\n", rec.Code, rec.Body.String(), weak)
+	}
+
+	for _, tc := range []struct {
+		etag   string
+		tag    string
+		status int
+	}{
+		{"", weak, http.StatusNotModified},
+		{"", `"other", ` + weak, http.StatusNotModified},
+		{"", `"other"`, http.StatusOK},
+		{`"7"`, `W/"7"`, http.StatusNotModified},
+		{`"7"`, `*`, http.StatusNotModified},
+		{`"7"`, weak, http.StatusOK},
+	} {
+		etag = tc.etag
+
+		if rec = request(tc.tag); rec.Code != tc.status {
+			t.Fatalf("\nExpected %s status code: %d\nObtained: %d\n", tc.tag, tc.status, rec.Code)
+		}
+
+		if tc.status == http.StatusNotModified && rec.Body.Len() != 0 {
+			t.Fatalf("Expected empty body, obtained: %s\n", rec.Body.String())
+		}
+	}
+}
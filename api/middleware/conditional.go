@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Conditional handles conditional GET requests. Successful responses get
+// ETag header, handler may set its own one, otherwise weak tag of the body
+// is used. Response is replaced by 304 Not Modified if If-None-Match
+// header matches the tag.
+func Conditional() Middleware {
+	return func(next Handler) Handler {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) (int, error) {
+			buf := &responseBuffer{ResponseWriter: w}
+
+			status, err := next(buf, r, p)
+			if err != nil {
+				return status, err
+			}
+
+			if buf.status != 0 {
+				status = buf.status
+			}
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				_, err = w.Write(buf.body.Bytes())
+				return status, err
+			}
+
+			etag := w.Header().Get("ETag")
+			if etag == "" {
+				sum := sha256.Sum256(buf.body.Bytes())
+				etag = `W/"` + hex.EncodeToString(sum[:16]) + `"`
+				w.Header().Set("ETag", etag)
+			}
+
+			if NoneMatch(r.Header.Get("If-None-Match"), etag) {
+				_, err = w.Write(buf.body.Bytes())
+				return status, err
+			}
+
+			return http.StatusNotModified, nil
+		}
+	}
+}
+
+// NoneMatch reports whether If-None-Match header value doesn't match
+// entity tag. Tags are compared weakly, "*" matches any tag.
+func NoneMatch(header string, etag string) bool {
+	if strings.TrimSpace(header) == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+
+		if tag == "*" || weakTag(tag) == weakTag(etag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func weakTag(tag string) string {
+	return strings.TrimPrefix(tag, "W/")
+}
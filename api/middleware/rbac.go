@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// CodeInsufficientRole is a problem code for requests lacking required role
+const CodeInsufficientRole = "insufficient_role"
+
+// RequireRole allows request only if authenticated user has the role
+// or a role including it. It must be chained after Auth.
+func RequireRole(required models.Role) Middleware {
+	return func(next Handler) Handler {
+		return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) (int, error) {
+			role := Role(r.Context())
+
+			if !role.Includes(required) {
+				return http.StatusForbidden, problem.Forbidden(CodeInsufficientRole, "insufficient role").
+					With("role", role).
+					With("required", required)
+			}
+
+			return next(w, r, p)
+		}
+	}
+}
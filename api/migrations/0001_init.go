@@ -0,0 +1,58 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Schema as it was created by AutoMigrate before migrations were introduced.
+// Tables are created only if missing, so existing databases are adopted as is.
+
+type user0001 struct {
+	ID       uint   `gorm:"primary_key"`
+	Name     string `gorm:"type:varchar(255) unique"`
+	Password string `gorm:"type:varchar(255)"`
+}
+
+func (user0001) TableName() string {
+	return "users"
+}
+
+type flight0001 struct {
+	ID          uint   `gorm:"primary_key"`
+	Name        string `gorm:"type:varchar(255)"`
+	Number      string `gorm:"type:varchar(255)"`
+	Scheduled   time.Time
+	Arrival     time.Time
+	Departure   time.Time
+	Destination string `gorm:"type:varchar(255)"`
+	Fare        float64
+	Duration    int
+}
+
+func (flight0001) TableName() string {
+	return "flights"
+}
+
+func init() {
+	register(Migration{
+		Version: 1,
+		Name:    "init",
+		Up: func(tx *gorm.DB) error {
+			for _, t := range []interface{}{&user0001{}, &flight0001{}} {
+				if tx.HasTable(t) {
+					continue
+				}
+				if err := tx.CreateTable(t).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&flight0001{}, &user0001{}).Error
+		},
+	})
+}
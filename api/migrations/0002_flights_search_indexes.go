@@ -0,0 +1,26 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 2,
+		Name:    "flights_search_indexes",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Table("flights").AddIndex("idx_flights_destination", "destination").Error; err != nil {
+				return err
+			}
+
+			return tx.Table("flights").AddIndex("idx_flights_scheduled", "scheduled").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("flights").RemoveIndex("idx_flights_scheduled").Error; err != nil {
+				return err
+			}
+
+			return tx.Table("flights").RemoveIndex("idx_flights_destination").Error
+		},
+	})
+}
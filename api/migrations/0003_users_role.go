@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 3,
+		Name:    "users_role",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE users ADD COLUMN role varchar(32) NOT NULL DEFAULT 'viewer'").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Table("users").DropColumn("role").Error
+		},
+	})
+}
@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type refreshToken0004 struct {
+	ID              uint   `gorm:"primary_key"`
+	TokenHash       string `gorm:"type:varchar(64);unique_index"`
+	Family          string `gorm:"type:varchar(64);index"`
+	UserID          uint
+	AccessJTI       string `gorm:"type:varchar(64)"`
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+	CreatedAt       time.Time
+}
+
+func (refreshToken0004) TableName() string {
+	return "refresh_tokens"
+}
+
+type deniedToken0004 struct {
+	JTI       string `gorm:"primary_key;type:varchar(64)"`
+	ExpiresAt time.Time
+}
+
+func (deniedToken0004) TableName() string {
+	return "denied_tokens"
+}
+
+func init() {
+	register(Migration{
+		Version: 4,
+		Name:    "tokens",
+		Up: func(tx *gorm.DB) error {
+			// AutoMigrate is used on snapshots only, as it creates declared indexes
+			return tx.AutoMigrate(&refreshToken0004{}, &deniedToken0004{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&deniedToken0004{}, &refreshToken0004{}).Error
+		},
+	})
+}
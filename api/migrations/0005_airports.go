@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// Codes are not unique indexes, as either of them may be empty.
+// Stores check uniqueness of non-empty codes.
+type airport0005 struct {
+	ID        uint   `gorm:"primary_key"`
+	IATA      string `gorm:"column:iata;type:varchar(3);index"`
+	ICAO      string `gorm:"column:icao;type:varchar(4);index"`
+	Name      string `gorm:"type:varchar(255)"`
+	City      string `gorm:"type:varchar(255)"`
+	Country   string `gorm:"type:varchar(255)"`
+	Latitude  float64
+	Longitude float64
+	TimeZone  string `gorm:"column:timezone;type:varchar(64)"`
+}
+
+func (airport0005) TableName() string {
+	return "airports"
+}
+
+var flightAirportColumns0005 = []string{"origin_airport_id", "destination_airport_id"}
+
+func init() {
+	register(Migration{
+		Version: 5,
+		Name:    "airports",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&airport0005{}).Error; err != nil {
+				return err
+			}
+
+			for _, col := range flightAirportColumns0005 {
+				if err := tx.Exec("ALTER TABLE flights ADD COLUMN " + col + " integer REFERENCES airports(id)").Error; err != nil {
+					return err
+				}
+				if err := tx.Table("flights").AddIndex("idx_flights_"+col, col).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, col := range flightAirportColumns0005 {
+				if err := tx.Table("flights").RemoveIndex("idx_flights_" + col).Error; err != nil {
+					return err
+				}
+				if err := tx.Table("flights").DropColumn(col).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.DropTableIfExists(&airport0005{}).Error
+		},
+	})
+}
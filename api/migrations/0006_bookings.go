@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type flightSeats0006 struct {
+	FlightID uint   `gorm:"primary_key;auto_increment:false;type:integer REFERENCES flights(id) ON DELETE CASCADE"`
+	Cabin    string `gorm:"primary_key;type:varchar(16)"`
+	Capacity int    `gorm:"not null;default:0"`
+	Booked   int    `gorm:"not null;default:0"`
+}
+
+func (flightSeats0006) TableName() string {
+	return "flight_seats"
+}
+
+type booking0006 struct {
+	ID          uint   `gorm:"primary_key"`
+	FlightID    uint   `gorm:"type:integer REFERENCES flights(id) ON DELETE CASCADE;index"`
+	UserID      uint   `gorm:"type:integer REFERENCES users(id) ON DELETE CASCADE;index"`
+	Cabin       string `gorm:"type:varchar(16)"`
+	Seats       int
+	Status      string `gorm:"type:varchar(16)"`
+	CreatedAt   time.Time
+	CancelledAt *time.Time
+}
+
+func (booking0006) TableName() string {
+	return "bookings"
+}
+
+func init() {
+	register(Migration{
+		Version: 6,
+		Name:    "bookings",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&flightSeats0006{}, &booking0006{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&booking0006{}, &flightSeats0006{}).Error
+		},
+	})
+}
@@ -0,0 +1,75 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type statusChange0007 struct {
+	ID        uint   `gorm:"primary_key"`
+	FlightID  uint   `gorm:"type:integer REFERENCES flights(id) ON DELETE CASCADE;index"`
+	From      string `gorm:"column:from_status;type:varchar(16)"`
+	To        string `gorm:"column:to_status;type:varchar(16)"`
+	Time      *time.Time
+	Reason    string `gorm:"type:varchar(255)"`
+	UserID    uint
+	CreatedAt time.Time
+}
+
+func (statusChange0007) TableName() string {
+	return "flight_status_history"
+}
+
+// timeType0007 returns column type gorm uses for time.Time, SQLite driver
+// parses times of datetime columns only
+func timeType0007(tx *gorm.DB) string {
+	if tx.Dialect().GetName() == "postgres" {
+		return "timestamp with time zone"
+	}
+
+	return "datetime"
+}
+
+var flightTimeColumns0007 = []string{"estimated_departure", "actual_departure", "actual_arrival"}
+
+func init() {
+	register(Migration{
+		Version: 7,
+		Name:    "flight_status",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("ALTER TABLE flights ADD COLUMN status varchar(16) NOT NULL DEFAULT 'scheduled'").Error; err != nil {
+				return err
+			}
+
+			for _, col := range flightTimeColumns0007 {
+				if err := tx.Exec("ALTER TABLE flights ADD COLUMN " + col + " " + timeType0007(tx)).Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Table("flights").AddIndex("idx_flights_status", "status").Error; err != nil {
+				return err
+			}
+
+			return tx.AutoMigrate(&statusChange0007{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.DropTableIfExists(&statusChange0007{}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Table("flights").RemoveIndex("idx_flights_status").Error; err != nil {
+				return err
+			}
+
+			for _, col := range flightTimeColumns0007 {
+				if err := tx.Table("flights").DropColumn(col).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Table("flights").DropColumn("status").Error
+		},
+	})
+}
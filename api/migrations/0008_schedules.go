@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type schedule0008 struct {
+	ID                   uint   `gorm:"primary_key"`
+	Name                 string `gorm:"type:varchar(255)"`
+	Number               string `gorm:"type:varchar(255)"`
+	OriginAirportID      uint   `gorm:"type:integer REFERENCES airports(id)"`
+	DestinationAirportID uint   `gorm:"type:integer REFERENCES airports(id)"`
+	Days                 uint8
+	DepartureTime        string `gorm:"type:varchar(5)"`
+	Duration             int
+	Fare                 float64
+	ValidFrom            string `gorm:"type:varchar(10)"`
+	ValidTo              string `gorm:"type:varchar(10)"`
+	Exceptions           string `gorm:"type:text"`
+}
+
+func (schedule0008) TableName() string {
+	return "schedules"
+}
+
+func init() {
+	register(Migration{
+		Version: 8,
+		Name:    "schedules",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&schedule0008{}).Error; err != nil {
+				return err
+			}
+
+			for _, stmt := range []string{
+				"ALTER TABLE flights ADD COLUMN schedule_id integer REFERENCES schedules(id) ON DELETE SET NULL",
+				"ALTER TABLE flights ADD COLUMN schedule_date varchar(10) NOT NULL DEFAULT ''",
+				"ALTER TABLE flights ADD COLUMN detached boolean NOT NULL DEFAULT false",
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+
+			// Generator relies on a single flight per schedule date
+			return tx.Table("flights").AddUniqueIndex("idx_flights_schedule_date", "schedule_id", "schedule_date").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("flights").RemoveIndex("idx_flights_schedule_date").Error; err != nil {
+				return err
+			}
+
+			for _, col := range []string{"detached", "schedule_date", "schedule_id"} {
+				if err := tx.Table("flights").DropColumn(col).Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.DropTableIfExists(&schedule0008{}).Error
+		},
+	})
+}
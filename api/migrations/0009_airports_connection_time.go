@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 9,
+		Name:    "airports_connection_time",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE airports ADD COLUMN min_connection_time integer NOT NULL DEFAULT 0").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Table("airports").DropColumn("min_connection_time").Error
+		},
+	})
+}
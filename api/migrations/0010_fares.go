@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type fareClass0010 struct {
+	ID         uint   `gorm:"primary_key"`
+	FlightID   uint   `gorm:"type:integer REFERENCES flights(id) ON DELETE CASCADE"`
+	Code       string `gorm:"type:varchar(16)"`
+	Cabin      string `gorm:"type:varchar(16)"`
+	Fare       int64  `gorm:"not null"`
+	Refundable bool   `gorm:"not null;default:false"`
+	BaggageKg  int    `gorm:"not null;default:0"`
+}
+
+func (fareClass0010) TableName() string {
+	return "fare_classes"
+}
+
+// Fares of these tables are converted to minor units of currency
+var fareTables0010 = []string{"flights", "schedules"}
+
+// convertFare0010 replaces fare column by fare computed by expression
+// from the old one
+func convertFare0010(tx *gorm.DB, table string, typ string, expr string) error {
+	for _, stmt := range []string{
+		"ALTER TABLE " + table + " ADD COLUMN fare_new " + typ + " NOT NULL DEFAULT 0",
+		"UPDATE " + table + " SET fare_new = " + expr,
+	} {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Table(table).DropColumn("fare").Error; err != nil {
+		return err
+	}
+
+	return tx.Exec("ALTER TABLE " + table + " RENAME COLUMN fare_new TO fare").Error
+}
+
+func init() {
+	register(Migration{
+		Version: 10,
+		Name:    "fares",
+		Up: func(tx *gorm.DB) error {
+			// Existing fares are assumed to be in US dollars
+			for _, table := range fareTables0010 {
+				if err := convertFare0010(tx, table, "bigint", "ROUND(fare * 100)"); err != nil {
+					return err
+				}
+
+				if err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN currency varchar(3) NOT NULL DEFAULT 'USD'").Error; err != nil {
+					return err
+				}
+			}
+
+			if err := tx.AutoMigrate(&fareClass0010{}).Error; err != nil {
+				return err
+			}
+
+			return tx.Model(&fareClass0010{}).AddUniqueIndex("idx_fare_classes_flight_code", "flight_id", "code").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.DropTableIfExists(&fareClass0010{}).Error; err != nil {
+				return err
+			}
+
+			// Fares in other currencies lose their currency
+			for _, table := range fareTables0010 {
+				if err := tx.Table(table).DropColumn("currency").Error; err != nil {
+					return err
+				}
+
+				if err := convertFare0010(tx, table, "numeric", "fare / 100.0"); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,18 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 11,
+		Name:    "flights_version",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE flights ADD COLUMN version integer NOT NULL DEFAULT 1").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Table("flights").DropColumn("version").Error
+		},
+	})
+}
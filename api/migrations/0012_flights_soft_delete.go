@@ -0,0 +1,40 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 12,
+		Name:    "flights_soft_delete",
+		Up: func(tx *gorm.DB) error {
+			for _, stmt := range []string{
+				"ALTER TABLE flights ADD COLUMN deleted_at " + timeType0007(tx),
+				// Who moved flight to trash, cleared on restore
+				"ALTER TABLE flights ADD COLUMN deleted_by integer",
+			} {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+
+			// Retention job purges flights by deletion time
+			return tx.Table("flights").AddIndex("idx_flights_deleted_at", "deleted_at").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("flights").RemoveIndex("idx_flights_deleted_at").Error; err != nil {
+				return err
+			}
+
+			// Deleted flights become visible again
+			for _, col := range []string{"deleted_by", "deleted_at"} {
+				if err := tx.Table("flights").DropColumn(col).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
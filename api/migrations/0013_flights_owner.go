@@ -0,0 +1,38 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+// Creator owns the flight, the last user, who changed it or its status,
+// is updated_by. Existing flights have neither.
+var flightOwnerColumns0013 = []string{"created_by", "updated_by"}
+
+func init() {
+	register(Migration{
+		Version: 13,
+		Name:    "flights_owner",
+		Up: func(tx *gorm.DB) error {
+			for _, col := range flightOwnerColumns0013 {
+				if err := tx.Exec("ALTER TABLE flights ADD COLUMN " + col + " integer").Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.Table("flights").AddIndex("idx_flights_created_by", "created_by").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("flights").RemoveIndex("idx_flights_created_by").Error; err != nil {
+				return err
+			}
+
+			for _, col := range flightOwnerColumns0013 {
+				if err := tx.Table("flights").DropColumn(col).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
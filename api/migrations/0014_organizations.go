@@ -0,0 +1,103 @@
+package migrations
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type organization0014 struct {
+	ID        uint   `gorm:"primary_key"`
+	Name      string `gorm:"type:varchar(255);unique"`
+	CreatedAt time.Time
+}
+
+func (organization0014) TableName() string {
+	return "organizations"
+}
+
+type invitation0014 struct {
+	ID             uint   `gorm:"primary_key"`
+	OrganizationID uint   `gorm:"type:integer REFERENCES organizations(id) ON DELETE CASCADE;index"`
+	Role           string `gorm:"type:varchar(32)"`
+	TokenHash      string `gorm:"type:varchar(64);unique_index"`
+	CreatedBy      uint
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+}
+
+func (invitation0014) TableName() string {
+	return "invitations"
+}
+
+// Existing rows of these tables belong to the default organization
+var tenantTables0014 = []string{"users", "flights", "schedules"}
+
+// flightNumberIndex0014 makes flight number unique per organization and
+// scheduled UTC date, deleted flights don't count
+func flightNumberIndex0014(tx *gorm.DB) string {
+	date := "date(scheduled)"
+
+	if tx.Dialect().GetName() == "postgres" {
+		date = "((scheduled AT TIME ZONE 'UTC')::date)"
+	}
+
+	return "CREATE UNIQUE INDEX idx_flights_organization_number ON flights (organization_id, number, " + date + ") WHERE deleted_at IS NULL"
+}
+
+func init() {
+	register(Migration{
+		Version: 14,
+		Name:    "organizations",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&organization0014{}, &invitation0014{}).Error; err != nil {
+				return err
+			}
+
+			def := organization0014{Name: "default", CreatedAt: time.Now().UTC()}
+
+			if err := tx.Create(&def).Error; err != nil {
+				return err
+			}
+
+			for _, table := range tenantTables0014 {
+				for _, stmt := range []string{
+					"ALTER TABLE " + table + " ADD COLUMN organization_id integer REFERENCES organizations(id)",
+					fmt.Sprintf("UPDATE %s SET organization_id = %d", table, def.ID),
+				} {
+					if err := tx.Exec(stmt).Error; err != nil {
+						return err
+					}
+				}
+
+				if err := tx.Table(table).AddIndex("idx_"+table+"_organization_id", "organization_id").Error; err != nil {
+					return err
+				}
+			}
+
+			// Fails if flights with the same number are scheduled on the same
+			// date already, they have to be renumbered or deleted first
+			return tx.Exec(flightNumberIndex0014(tx)).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("flights").RemoveIndex("idx_flights_organization_number").Error; err != nil {
+				return err
+			}
+
+			// Users and flights of all organizations are merged
+			for _, table := range tenantTables0014 {
+				if err := tx.Table(table).RemoveIndex("idx_" + table + "_organization_id").Error; err != nil {
+					return err
+				}
+
+				if err := tx.Table(table).DropColumn("organization_id").Error; err != nil {
+					return err
+				}
+			}
+
+			return tx.DropTableIfExists(&invitation0014{}, &organization0014{}).Error
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Entries of anonymous and service changes have NULL actor_id
+type auditEntry0015 struct {
+	ID             uint `gorm:"primary_key"`
+	OrganizationID uint `gorm:"type:integer REFERENCES organizations(id)"`
+	ActorID        *uint
+	Action         string `gorm:"type:varchar(16)"`
+	Resource       string `gorm:"type:varchar(32)"`
+	ResourceID     uint
+	Changes        string `gorm:"type:text"`
+	RequestID      string `gorm:"type:varchar(64)"`
+	CreatedAt      time.Time
+	// Every entry has a single successor, so concurrent appends can't
+	// fork the chain
+	PrevHash string `gorm:"type:varchar(64);unique_index"`
+	Hash     string `gorm:"type:varchar(64)"`
+}
+
+func (auditEntry0015) TableName() string {
+	return "audit_entries"
+}
+
+func init() {
+	register(Migration{
+		Version: 15,
+		Name:    "audit",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&auditEntry0015{}).Error; err != nil {
+				return err
+			}
+
+			return tx.Model(&auditEntry0015{}).AddIndex("idx_audit_entries_resource", "organization_id", "resource", "resource_id").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists(&auditEntry0015{}).Error
+		},
+	})
+}
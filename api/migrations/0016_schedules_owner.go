@@ -0,0 +1,19 @@
+package migrations
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+func init() {
+	register(Migration{
+		Version: 16,
+		Name:    "schedules_owner",
+		// Schedules created before have no owner, any operator changes them
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE schedules ADD COLUMN created_by integer").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Table("schedules").DropColumn("created_by").Error
+		},
+	})
+}
@@ -0,0 +1,215 @@
+// Package migrations keeps versioned, reversible database schema changes.
+//
+// Every migration lives in its own file and registers itself from init().
+// Migrations must not reference api/models types, schema snapshots are
+// declared locally, so changing a model never rewrites schema history.
+//
+// Columns referencing users as actors or owners, e.g. created_by, are
+// plain integers without foreign keys, so history outlives removed users.
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Migration is a single numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// State describes migration and whether it has been applied
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// schemaMigration is a record in schema_migrations table
+type schemaMigration struct {
+	Version   int    `gorm:"primary_key;auto_increment:false"`
+	Name      string `gorm:"type:varchar(255)"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+var registry []Migration
+
+func register(m Migration) {
+	for _, tmp := range registry {
+		if tmp.Version == m.Version {
+			panic(fmt.Sprintf("migration %d is already registered", m.Version))
+		}
+	}
+
+	registry = append(registry, m)
+
+	sort.Slice(registry, func(i, j int) bool { return registry[i].Version < registry[j].Version })
+}
+
+// All returns registered migrations ordered by version
+func All() []Migration {
+	return append([]Migration{}, registry...)
+}
+
+func applied(db *gorm.DB) (map[int]schemaMigration, error) {
+	var (
+		records []schemaMigration
+		result  map[int]schemaMigration = make(map[int]schemaMigration)
+	)
+
+	if err := db.AutoMigrate(&schemaMigration{}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Find(&records).Error; err != nil {
+		return nil, err
+	}
+
+	for _, r := range records {
+		result[r.Version] = r
+	}
+
+	return result, nil
+}
+
+// Status returns state of every registered migration
+func Status(db *gorm.DB) ([]State, error) {
+	var (
+		done   map[int]schemaMigration
+		result []State
+		err    error
+	)
+
+	if done, err = applied(db); err != nil {
+		return nil, err
+	}
+
+	for _, m := range registry {
+		s := State{Migration: m}
+
+		if r, ok := done[m.Version]; ok {
+			t := r.AppliedAt
+			s.AppliedAt = &t
+		}
+
+		result = append(result, s)
+	}
+
+	return result, nil
+}
+
+// Pending returns migrations which are not applied yet
+func Pending(db *gorm.DB) ([]Migration, error) {
+	var (
+		done   map[int]schemaMigration
+		result []Migration
+		err    error
+	)
+
+	if done, err = applied(db); err != nil {
+		return nil, err
+	}
+
+	for _, m := range registry {
+		if _, ok := done[m.Version]; !ok {
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
+// Check returns an error if database schema is behind registered migrations
+func Check(db *gorm.DB) error {
+	pending, err := Pending(db)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) != 0 {
+		return fmt.Errorf("database schema is behind, %d migration(s) pending starting from %d_%s",
+			len(pending), pending[0].Version, pending[0].Name)
+	}
+
+	return nil
+}
+
+// Up applies all pending migrations, each one in its own transaction
+func Up(db *gorm.DB) ([]Migration, error) {
+	var (
+		pending []Migration
+		result  []Migration
+		err     error
+	)
+
+	if pending, err = Pending(db); err != nil {
+		return nil, err
+	}
+
+	for _, m := range pending {
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+
+			return tx.Create(&schemaMigration{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		})
+		if err != nil {
+			return result, fmt.Errorf("migration %d_%s failed - %s", m.Version, m.Name, err)
+		}
+
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// Down reverts the latest applied migration. It returns nil if there is nothing to revert.
+func Down(db *gorm.DB) (*Migration, error) {
+	var (
+		done map[int]schemaMigration
+		last *Migration
+		err  error
+	)
+
+	if done, err = applied(db); err != nil {
+		return nil, err
+	}
+
+	for i := len(registry) - 1; i >= 0; i-- {
+		if _, ok := done[registry[i].Version]; ok {
+			last = &registry[i]
+			break
+		}
+	}
+
+	if last == nil {
+		return nil, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := last.Down(tx); err != nil {
+			return err
+		}
+
+		return tx.Delete(&schemaMigration{}, "version = ?", last.Version).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("migration %d_%s revert failed - %s", last.Version, last.Name, err)
+	}
+
+	return last, nil
+}
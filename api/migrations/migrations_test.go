@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+)
+
+// testDB opens SQLite with foreign keys enabled, as models.ConnectDatabase does
+func testDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open("sqlite3", ":memory:?_foreign_keys=1")
+	if err != nil {
+		t.Fatalf("Error opening database - %s\n", err)
+	}
+
+	db.DB().SetMaxOpenConns(1)
+
+	return db
+}
+
+func TestUpDown(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	if err := Check(db); err == nil {
+		t.Fatalf("Expected pending migrations error\n")
+	}
+
+	done, err := Up(db)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if len(done) != len(All()) {
+		t.Fatalf("\nExpected applied: %d\nObtained: %d\n", len(All()), len(done))
+	}
+
+	if err = Check(db); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	// Every migration should be revertable and applicable again
+	for i := len(All()) - 1; i >= 0; i-- {
+		m, err := Down(db)
+		if err != nil {
+			t.Fatalf("Unexpected error - %s\n", err)
+		}
+
+		if m == nil || m.Version != All()[i].Version {
+			t.Fatalf("\nExpected reverted version: %d\nObtained: %v\n", All()[i].Version, m)
+		}
+	}
+
+	if m, err := Down(db); m != nil || err != nil {
+		t.Fatalf("Expected nothing to revert, obtained: %v, %v\n", m, err)
+	}
+
+	if db.HasTable("flights") || db.HasTable("users") {
+		t.Fatalf("Expected tables to be dropped\n")
+	}
+
+	if _, err = Up(db); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	if _, err := Up(db); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if _, err := Down(db); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	states, err := Status(db)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	for i, s := range states {
+		last := i == len(states)-1
+
+		if last && s.AppliedAt != nil {
+			t.Fatalf("Expected migration %d to be pending\n", s.Version)
+		}
+		if !last && s.AppliedAt == nil {
+			t.Fatalf("Expected migration %d to be applied\n", s.Version)
+		}
+	}
+}
+
+func TestForeignKeys(t *testing.T) {
+	db := testDB(t)
+	defer db.Close()
+
+	if _, err := Up(db); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	for _, q := range []string{
+		"INSERT INTO users (id, name) VALUES (1, 'fk')",
+		"INSERT INTO schedules (id, name, number) VALUES (1, 'fk', 'FK1')",
+		"INSERT INTO flights (id, name, number, schedule_id) VALUES (1, 'fk', 'FK1', 1), (2, 'fk', 'FK2', NULL)",
+		"INSERT INTO flight_seats (flight_id, cabin, capacity) VALUES (1, 'economy', 10)",
+		"INSERT INTO bookings (id, flight_id, user_id) VALUES (1, 1, 1), (2, 2, 1)",
+		"DELETE FROM schedules WHERE id = 1",
+		"DELETE FROM flights WHERE id = 2",
+		"DELETE FROM users WHERE id = 1",
+	} {
+		if err := db.Exec(q).Error; err != nil {
+			t.Fatalf("Error executing %s - %s\n", q, err)
+		}
+	}
+
+	// Schedule of kept flight is cleared, bookings and seats of removed
+	// flight and user are removed with them
+	for q, expected := range map[string]int{
+		"SELECT count(*) FROM flights WHERE schedule_id IS NULL": 1,
+		"SELECT count(*) FROM flight_seats":                      1,
+		"SELECT count(*) FROM bookings":                          0,
+	} {
+		var obtained int
+
+		if err := db.Raw(q).Row().Scan(&obtained); err != nil {
+			t.Fatalf("Error executing %s - %s\n", q, err)
+		}
+
+		if obtained != expected {
+			t.Fatalf("\nExpected %s: %d\nObtained: %d\n", q, expected, obtained)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+var ErrAirportExists = problem.Conflict("airport_exists", "airport with this IATA or ICAO code already exists")
+
+var (
+	iataPattern = regexp.MustCompile(`^[A-Z0-9]{3}$`)
+	icaoPattern = regexp.MustCompile(`^[A-Z0-9]{4}$`)
+)
+
+type Airport struct {
+	ID        uint    `gorm:"primary_key"`
+	IATA      string  `json:"iata" gorm:"column:iata;type:varchar(3)"`
+	ICAO      string  `json:"icao" gorm:"column:icao;type:varchar(4)"`
+	Name      string  `json:"name" gorm:"type:varchar(255)"`
+	City      string  `json:"city" gorm:"type:varchar(255)"`
+	Country   string  `json:"country" gorm:"type:varchar(255)"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	TimeZone  string  `json:"timezone" gorm:"column:timezone;type:varchar(64)"`
+	// MinConnectionTime is minimum connection time in minutes,
+	// zero means DefaultMinConnectionTime
+	MinConnectionTime int `json:"min_connection_time"`
+}
+
+// AirportFilter filters airports list, empty fields match everything
+type AirportFilter struct {
+	// Code is either IATA or ICAO code
+	Code    string
+	City    string
+	Country string
+}
+
+// AirportStore is implemented by airports storage backends
+type AirportStore interface {
+	Create(a *Airport) error
+	Update(id uint, a *Airport) error
+	Delete(id uint) error
+	Find(id uint) (*Airport, error)
+	// FindByCode finds airport by IATA or ICAO code
+	FindByCode(code string) (*Airport, error)
+	List(f AirportFilter) ([]Airport, error)
+	// Upsert creates airports or updates existing ones with the same
+	// IATA code, or ICAO code if there is no IATA code
+	Upsert(airports []Airport) error
+}
+
+// Validate checks all fields and reports every invalid one
+func (a *Airport) Validate() error {
+	var v problem.Validation
+
+	v.Check(a.IATA != "" || a.ICAO != "", "iata", "required", "Please provide IATA or ICAO code")
+	v.Check(a.IATA == "" || iataPattern.MatchString(a.IATA), "iata", "invalid", "IATA code must be 3 uppercase letters or digits")
+	v.Check(a.ICAO == "" || icaoPattern.MatchString(a.ICAO), "icao", "invalid", "ICAO code must be 4 uppercase letters or digits")
+	v.Check(a.Name != "", "name", "required", "Please provide airport name")
+	v.Check(a.City != "", "city", "required", "Please provide airport city")
+	v.Check(a.Country != "", "country", "required", "Please provide airport country")
+	v.Check(a.Latitude >= -90 && a.Latitude <= 90, "latitude", "range", "Latitude must be from -90 to 90")
+	v.Check(a.Longitude >= -180 && a.Longitude <= 180, "longitude", "range", "Longitude must be from -180 to 180")
+
+	v.Check(a.MinConnectionTime >= 0, "min_connection_time", "negative", "Minimum connection time can't be negative")
+
+	if a.TimeZone == "" {
+		v.Add("timezone", "required", "Please provide IANA time zone")
+	} else if _, err := time.LoadLocation(a.TimeZone); err != nil {
+		v.Add("timezone", "invalid", fmt.Sprintf("Unknown time zone '%s'", a.TimeZone))
+	}
+
+	return v.Err()
+}
+
+// Location returns airport time zone
+func (a *Airport) Location() *time.Location {
+	loc, err := time.LoadLocation(a.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// normalize upper cases codes
+func (a *Airport) normalize() {
+	a.IATA = strings.ToUpper(strings.TrimSpace(a.IATA))
+	a.ICAO = strings.ToUpper(strings.TrimSpace(a.ICAO))
+}
+
+// sameCode reports whether airports share IATA or ICAO code
+func (a *Airport) sameCode(b *Airport) bool {
+	return (a.IATA != "" && a.IATA == b.IATA) || (a.ICAO != "" && a.ICAO == b.ICAO)
+}
+
+// ParseAirportsCSV reads airports in OpenFlights airports.dat format.
+// Rows which are not valid airports, e.g. without codes or time zone,
+// are skipped and counted.
+func ParseAirportsCSV(r io.Reader) ([]Airport, int, error) {
+	var (
+		result  []Airport
+		skipped int
+	)
+
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	for line := 1; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		if len(rec) < 12 {
+			return nil, 0, fmt.Errorf("line %d - expected at least 12 columns, obtained %d", line, len(rec))
+		}
+
+		for i := range rec {
+			if rec[i] == `\N` {
+				rec[i] = ""
+			}
+		}
+
+		a := Airport{
+			Name:     rec[1],
+			City:     rec[2],
+			Country:  rec[3],
+			IATA:     rec[4],
+			ICAO:     rec[5],
+			TimeZone: rec[11],
+		}
+
+		if a.Latitude, err = strconv.ParseFloat(rec[6], 64); err != nil {
+			skipped++
+			continue
+		}
+		if a.Longitude, err = strconv.ParseFloat(rec[7], 64); err != nil {
+			skipped++
+			continue
+		}
+
+		a.normalize()
+
+		if a.Validate() != nil {
+			skipped++
+			continue
+		}
+
+		result = append(result, a)
+	}
+
+	return result, skipped, nil
+}
@@ -0,0 +1,157 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+type dbAirportStore struct {
+	db *gorm.DB
+}
+
+// conflict checks there is no other airport with the same code
+func (s *dbAirportStore) conflict(tx *gorm.DB, a *Airport) error {
+	var count int
+
+	q := tx.Model(&Airport{}).Where("id <> ?", a.ID)
+
+	switch {
+	case a.IATA != "" && a.ICAO != "":
+		q = q.Where("iata = ? OR icao = ?", a.IATA, a.ICAO)
+	case a.IATA != "":
+		q = q.Where("iata = ?", a.IATA)
+	default:
+		q = q.Where("icao = ?", a.ICAO)
+	}
+
+	if err := q.Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return ErrAirportExists
+	}
+
+	return nil
+}
+
+func (s *dbAirportStore) Create(a *Airport) error {
+	a.normalize()
+	a.ID = 0
+
+	if err := s.conflict(s.db, a); err != nil {
+		return err
+	}
+
+	return s.db.Create(a).Error
+}
+
+func (s *dbAirportStore) Update(id uint, a *Airport) error {
+	a.normalize()
+	a.ID = id
+
+	if _, err := s.Find(id); err != nil {
+		return err
+	}
+
+	if err := s.conflict(s.db, a); err != nil {
+		return err
+	}
+
+	return s.db.Save(a).Error
+}
+
+func (s *dbAirportStore) Delete(id uint) error {
+	result := s.db.Delete(&Airport{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *dbAirportStore) Find(id uint) (*Airport, error) {
+	var a Airport
+
+	if err := s.db.First(&a, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *dbAirportStore) FindByCode(code string) (*Airport, error) {
+	var a Airport
+
+	code = strings.ToUpper(code)
+
+	if err := s.db.Where("iata = ? OR icao = ?", code, code).First(&a).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &a, nil
+}
+
+func (s *dbAirportStore) List(f AirportFilter) ([]Airport, error) {
+	var airports []Airport
+
+	q := s.db.Model(&Airport{})
+
+	if f.Code != "" {
+		code := strings.ToUpper(f.Code)
+		q = q.Where("iata = ? OR icao = ?", code, code)
+	}
+	if f.City != "" {
+		q = q.Where("LOWER(city) = ?", strings.ToLower(f.City))
+	}
+	if f.Country != "" {
+		q = q.Where("LOWER(country) = ?", strings.ToLower(f.Country))
+	}
+
+	err := q.Order("iata, icao").Find(&airports).Error
+
+	return airports, err
+}
+
+func (s *dbAirportStore) Upsert(airports []Airport) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for _, a := range airports {
+			var cur Airport
+
+			a.normalize()
+
+			q := tx.Where("icao = ?", a.ICAO)
+			if a.IATA != "" {
+				q = tx.Where("iata = ?", a.IATA)
+			}
+
+			err := q.First(&cur).Error
+			if err != nil && !gorm.IsRecordNotFoundError(err) {
+				return err
+			}
+
+			a.ID = cur.ID
+			// Connection times are not in CSV, they are kept as set by admins
+			if a.MinConnectionTime == 0 {
+				a.MinConnectionTime = cur.MinConnectionTime
+			}
+
+			if err = tx.Save(&a).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type memAirportStore struct {
+	sync.RWMutex
+	seq      uint
+	airports map[uint]Airport
+}
+
+func newMemAirportStore() *memAirportStore {
+	return &memAirportStore{airports: make(map[uint]Airport)}
+}
+
+func (s *memAirportStore) conflict(a *Airport) error {
+	for id, tmp := range s.airports {
+		if id != a.ID && a.sameCode(&tmp) {
+			return ErrAirportExists
+		}
+	}
+
+	return nil
+}
+
+func (s *memAirportStore) Create(a *Airport) error {
+	s.Lock()
+	defer s.Unlock()
+
+	a.normalize()
+	a.ID = 0
+
+	if err := s.conflict(a); err != nil {
+		return err
+	}
+
+	s.seq++
+	a.ID = s.seq
+	s.airports[a.ID] = *a
+
+	return nil
+}
+
+func (s *memAirportStore) Update(id uint, a *Airport) error {
+	s.Lock()
+	defer s.Unlock()
+
+	a.normalize()
+	a.ID = id
+
+	if _, ok := s.airports[id]; !ok {
+		return ErrNotFound
+	}
+
+	if err := s.conflict(a); err != nil {
+		return err
+	}
+
+	s.airports[id] = *a
+
+	return nil
+}
+
+func (s *memAirportStore) Delete(id uint) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.airports[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(s.airports, id)
+
+	return nil
+}
+
+func (s *memAirportStore) Find(id uint) (*Airport, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	a, ok := s.airports[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &a, nil
+}
+
+func (s *memAirportStore) FindByCode(code string) (*Airport, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	code = strings.ToUpper(code)
+
+	for _, a := range s.airports {
+		if a.IATA == code || a.ICAO == code {
+			return &a, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memAirportStore) List(f AirportFilter) ([]Airport, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := []Airport{}
+	code := strings.ToUpper(f.Code)
+
+	for _, a := range s.airports {
+		if code != "" && a.IATA != code && a.ICAO != code {
+			continue
+		}
+		if f.City != "" && !strings.EqualFold(a.City, f.City) {
+			continue
+		}
+		if f.Country != "" && !strings.EqualFold(a.Country, f.Country) {
+			continue
+		}
+
+		result = append(result, a)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].IATA != result[j].IATA {
+			return result[i].IATA < result[j].IATA
+		}
+		return result[i].ICAO < result[j].ICAO
+	})
+
+	return result, nil
+}
+
+func (s *memAirportStore) Upsert(airports []Airport) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, a := range airports {
+		a.normalize()
+		a.ID = 0
+
+		for id, tmp := range s.airports {
+			if (a.IATA != "" && a.IATA == tmp.IATA) || (a.IATA == "" && a.ICAO == tmp.ICAO) {
+				a.ID = id
+				// Connection times are not in CSV, they are kept as set by admins
+				if a.MinConnectionTime == 0 {
+					a.MinConnectionTime = tmp.MinConnectionTime
+				}
+				break
+			}
+		}
+
+		if a.ID == 0 {
+			s.seq++
+			a.ID = s.seq
+		}
+
+		s.airports[a.ID] = a
+	}
+
+	return nil
+}
@@ -0,0 +1,314 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// Audited actions
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	// AuditPurge is permanent removal of deleted resource
+	AuditPurge = "purge"
+)
+
+// Audited resources
+const (
+	AuditFlight = "flight"
+	AuditUser   = "user"
+)
+
+var (
+	auditActions   = map[string]bool{AuditCreate: true, AuditUpdate: true, AuditDelete: true, AuditRestore: true, AuditPurge: true}
+	auditResources = map[string]bool{AuditFlight: true, AuditUser: true}
+	// Changes of auditSecrets are recorded without values
+	auditSecrets = map[string]bool{"password": true}
+)
+
+// AuditChange is a field value before and after the change, missing
+// value means that field was absent, e.g. before creation. Both values
+// are missing for changed secrets.
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditChanges maps JSON fields of resource to their changes, it is
+// stored as JSON text
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	b, err := json.Marshal(c)
+	return string(b), err
+}
+
+func (c *AuditChanges) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, c)
+	case string:
+		return json.Unmarshal([]byte(v), c)
+	case nil:
+		*c = nil
+		return nil
+	}
+
+	return fmt.Errorf("unsupported audit changes type %T", src)
+}
+
+// AuditEntry is an append only record of resource change. Every entry
+// holds hash of the previous one, so changed or removed entries break
+// the chain, see AuditStore.Verify.
+type AuditEntry struct {
+	ID             uint `gorm:"primary_key" json:"id"`
+	OrganizationID uint `json:"organization_id"`
+	// ActorID is nil for changes made by anonymous users, e.g. registration,
+	// and by the service itself, e.g. schedule generator and retention purge
+	ActorID    *uint        `json:"actor_id"`
+	Action     string       `json:"action" gorm:"type:varchar(16)"`
+	Resource   string       `json:"resource" gorm:"type:varchar(32)"`
+	ResourceID uint         `json:"resource_id"`
+	Changes    AuditChanges `json:"changes" gorm:"type:text"`
+	RequestID  string       `json:"request_id" gorm:"type:varchar(64)"`
+	CreatedAt  time.Time    `json:"created_at"`
+	PrevHash   string       `json:"prev_hash" gorm:"type:varchar(64)"`
+	Hash       string       `json:"hash" gorm:"type:varchar(64)"`
+}
+
+// AuditSearch describes audit entries filter and page, entries are
+// returned newest first
+type AuditSearch struct {
+	Resources []string
+	// ResourceIDs match entries of any of resources with these ids
+	ResourceIDs []uint
+	Actors      []uint
+	Actions     []string
+	// Time bounds are inclusive, nil means unbounded
+	From  *time.Time
+	To    *time.Time
+	Limit int
+	// Before is id of the last entry of the previous page
+	Before uint
+}
+
+// AuditStore is implemented by audit log storage backends
+type AuditStore interface {
+	// Tenant returns store scoped to entries of organization, store of
+	// organization 0 is not scoped
+	Tenant(org uint) AuditStore
+	// Append chains entry to the last one of all organizations and adds
+	// it to organization of scoped store
+	Append(e *AuditEntry) error
+	Find(s AuditSearch) ([]AuditEntry, error)
+	// Verify checks hash chain of all entries and returns their number
+	Verify() (int, error)
+}
+
+// NewAuditEntry returns entry with changes between JSON encodings of
+// resource before and after action. Nil before or after means that
+// resource didn't exist, all fields of the other one are recorded then.
+func NewAuditEntry(action string, resource string, id uint, before, after interface{}) (*AuditEntry, error) {
+	var (
+		old, cur map[string]json.RawMessage
+		err      error
+	)
+
+	if old, err = auditFields(before); err != nil {
+		return nil, err
+	}
+
+	if cur, err = auditFields(after); err != nil {
+		return nil, err
+	}
+
+	changes := make(AuditChanges)
+
+	for k := range auditSecrets {
+		if v, w := old[k], cur[k]; !bytes.Equal(v, w) {
+			changes[k] = AuditChange{}
+		}
+
+		delete(old, k)
+		delete(cur, k)
+	}
+
+	for k, v := range old {
+		if w, ok := cur[k]; !ok || !bytes.Equal(v, w) {
+			changes[k] = AuditChange{Before: v, After: w}
+		}
+	}
+
+	for k, w := range cur {
+		if _, ok := old[k]; !ok {
+			changes[k] = AuditChange{After: w}
+		}
+	}
+
+	return &AuditEntry{
+		Action:     action,
+		Resource:   resource,
+		ResourceID: id,
+		Changes:    changes,
+		// Databases keep microseconds, hash must survive round trip
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}, nil
+}
+
+// AppendAudit records change of resource made by actor to audit log of
+// organization. Change is made already, callers report the error, e.g.
+// request fails, so changes missing in audit log never go unnoticed.
+func AppendAudit(s AuditStore, org uint, actor *uint, requestID string, action string, resource string, id uint, before, after interface{}) error {
+	e, err := NewAuditEntry(action, resource, id, before, after)
+	if err != nil {
+		return err
+	}
+
+	e.ActorID, e.RequestID = actor, requestID
+
+	return s.Tenant(org).Append(e)
+}
+
+// auditFields returns JSON members of v, nil v has none
+func auditFields(v interface{}) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+
+	if v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(b, &fields)
+
+	return fields, err
+}
+
+// seal links entry to the previous entry hash
+func (e *AuditEntry) seal(prev string) error {
+	var err error
+
+	e.PrevHash = prev
+	e.Hash, err = e.digest()
+
+	return err
+}
+
+// digest is SHA-256 of entry fields, id is assigned by storage and is
+// not hashed
+func (e *AuditEntry) digest() (string, error) {
+	b, err := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.OrganizationID,
+		e.ActorID,
+		e.Action,
+		e.Resource,
+		e.ResourceID,
+		e.Changes,
+		e.RequestID,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// verifyAuditChain checks that entries ordered by id continue chain
+// ending with prev hash, it returns hash of the last entry
+func verifyAuditChain(entries []AuditEntry, prev string) (string, error) {
+	for i := range entries {
+		e := &entries[i]
+
+		digest, err := e.digest()
+		if err != nil {
+			return "", err
+		}
+
+		if e.PrevHash != prev || e.Hash != digest {
+			return "", fmt.Errorf("audit log is broken at entry %d", e.ID)
+		}
+
+		prev = e.Hash
+	}
+
+	return prev, nil
+}
+
+// ParseAuditSearch parses audit log query parameters:
+//
+//	resource        flight or user, comma separated or repeated
+//	id              resource ids, comma separated or repeated
+//	actor           ids of users, who made changes
+//	action          create, update, delete, restore or purge
+//	from, to        inclusive time range, RFC 3339 time or YYYY-MM-DD
+//	limit, cursor   page size and next_cursor of the previous page
+//
+// Every malformed parameter is reported as a validation problem field.
+func ParseAuditSearch(q url.Values) (AuditSearch, error) {
+	var (
+		s AuditSearch
+		v problem.Validation
+	)
+
+	s.Resources = listParam(q, "resource")
+	for _, r := range s.Resources {
+		if !auditResources[r] {
+			v.Add("resource", "invalid", "resource must be flight or user")
+			break
+		}
+	}
+
+	s.Actions = listParam(q, "action")
+	for _, a := range s.Actions {
+		if !auditActions[a] {
+			v.Add("action", "invalid", "action must be create, update, delete, restore or purge")
+			break
+		}
+	}
+
+	s.ResourceIDs = idListParam(&v, q, "id")
+	s.Actors = idListParam(&v, q, "actor")
+
+	v.Check(len(s.ResourceIDs) == 0 || len(s.Resources) != 0, "id", "resource", "id requires resource")
+
+	s.From, _ = timeParam(&v, q, "from")
+	_, s.To = timeParam(&v, q, "to")
+
+	v.Check(s.From == nil || s.To == nil || !s.From.After(*s.To), "to", "range", "to must not be before from")
+
+	s.Limit = DefaultSearchLimit
+
+	if limit := q.Get("limit"); limit != "" {
+		var err error
+
+		s.Limit, err = strconv.Atoi(limit)
+		v.Check(err == nil && s.Limit > 0 && s.Limit <= MaxSearchLimit, "limit", "invalid",
+			fmt.Sprintf("limit must be an integer from 1 to %d", MaxSearchLimit))
+	}
+
+	if cursor := q.Get("cursor"); cursor != "" {
+		before, err := strconv.ParseUint(cursor, 10, 32)
+		v.Check(err == nil && before != 0, "cursor", "invalid", "cursor must be next_cursor of the previous page")
+		s.Before = uint(before)
+	}
+
+	return s, v.Err()
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"sync"
+)
+
+// memAudit is audit log of all organizations shared by scoped stores
+type memAudit struct {
+	sync.RWMutex
+	entries []AuditEntry
+}
+
+type memAuditStore struct {
+	*memAudit
+	// org scopes store to organization, 0 is all organizations
+	org uint
+}
+
+func newMemAuditStore() *memAuditStore {
+	return &memAuditStore{memAudit: &memAudit{}}
+}
+
+func (s *memAuditStore) Tenant(org uint) AuditStore {
+	return &memAuditStore{memAudit: s.memAudit, org: org}
+}
+
+func (s *memAuditStore) Append(e *AuditEntry) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.org != 0 {
+		e.OrganizationID = s.org
+	}
+
+	prev := ""
+	if n := len(s.entries); n != 0 {
+		prev = s.entries[n-1].Hash
+	}
+
+	if err := e.seal(prev); err != nil {
+		return err
+	}
+
+	e.ID = uint(len(s.entries) + 1)
+	s.entries = append(s.entries, *e)
+
+	return nil
+}
+
+func (s *memAuditStore) Find(search AuditSearch) ([]AuditEntry, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := []AuditEntry{}
+
+	for i := len(s.entries) - 1; i >= 0; i-- {
+		e := s.entries[i]
+
+		if search.Limit > 0 && len(result) == search.Limit {
+			break
+		}
+
+		if (s.org != 0 && e.OrganizationID != s.org) ||
+			(search.Before != 0 && e.ID >= search.Before) ||
+			(len(search.Resources) != 0 && !containsString(search.Resources, e.Resource, false)) ||
+			(len(search.ResourceIDs) != 0 && !containsID(search.ResourceIDs, &e.ResourceID)) ||
+			(len(search.Actors) != 0 && !containsID(search.Actors, e.ActorID)) ||
+			(len(search.Actions) != 0 && !containsString(search.Actions, e.Action, false)) ||
+			!inTimeRange(e.CreatedAt, search.From, search.To) {
+			continue
+		}
+
+		result = append(result, e)
+	}
+
+	return result, nil
+}
+
+func (s *memAuditStore) Verify() (int, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if _, err := verifyAuditChain(s.entries, ""); err != nil {
+		return 0, err
+	}
+
+	return len(s.entries), nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// MaxBookingSeats limits seats reserved by a single booking
+const MaxBookingSeats = 9
+
+var (
+	ErrSoldOut          = problem.Conflict("sold_out", "not enough seats available")
+	ErrCabinUnavailable = problem.Conflict("cabin_unavailable", "flight has no seats in this cabin")
+	ErrBookingCancelled = problem.Conflict("booking_cancelled", "booking is already cancelled")
+	ErrCapacityBooked   = problem.Conflict("capacity_below_booked", "capacity can't be less than already booked seats")
+	ErrFlightBooked     = problem.Conflict("flight_has_bookings", "flight has confirmed bookings")
+	ErrFlightClosed     = problem.Conflict("flight_closed", "departed, landed or cancelled flight can't be booked")
+)
+
+// Cabin is a class of service with its own seat capacity
+type Cabin string
+
+const (
+	CabinEconomy  Cabin = "economy"
+	CabinPremium  Cabin = "premium"
+	CabinBusiness Cabin = "business"
+	CabinFirst    Cabin = "first"
+)
+
+var cabins = map[Cabin]bool{
+	CabinEconomy:  true,
+	CabinPremium:  true,
+	CabinBusiness: true,
+	CabinFirst:    true,
+}
+
+func ParseCabin(s string) (Cabin, error) {
+	if !cabins[Cabin(s)] {
+		return "", fmt.Errorf("unknown cabin '%s', expected economy, premium, business or first", s)
+	}
+
+	return Cabin(s), nil
+}
+
+// Seats is flight inventory of a single cabin
+type Seats struct {
+	FlightID uint  `json:"-" gorm:"primary_key;auto_increment:false"`
+	Cabin    Cabin `json:"cabin" gorm:"primary_key;type:varchar(16)"`
+	Capacity int   `json:"capacity"`
+	Booked   int   `json:"booked"`
+}
+
+func (Seats) TableName() string {
+	return "flight_seats"
+}
+
+// Available returns number of seats which can be booked
+func (s Seats) Available() int {
+	return s.Capacity - s.Booked
+}
+
+type BookingStatus string
+
+const (
+	BookingConfirmed BookingStatus = "confirmed"
+	BookingCancelled BookingStatus = "cancelled"
+)
+
+type Booking struct {
+	ID          uint          `gorm:"primary_key"`
+	FlightID    uint          `json:"flight_id"`
+	UserID      uint          `json:"user_id"`
+	Cabin       Cabin         `json:"cabin" gorm:"type:varchar(16)"`
+	Seats       int           `json:"seats"`
+	Status      BookingStatus `json:"status" gorm:"type:varchar(16)"`
+	CreatedAt   time.Time     `json:"created_at"`
+	CancelledAt *time.Time    `json:"cancelled_at,omitempty"`
+}
+
+// BookingFilter filters bookings list, zero fields match everything
+type BookingFilter struct {
+	UserID   uint
+	FlightID uint
+	Status   BookingStatus
+}
+
+func (f BookingFilter) matches(b *Booking) bool {
+	return (f.UserID == 0 || b.UserID == f.UserID) &&
+		(f.FlightID == 0 || b.FlightID == f.FlightID) &&
+		(f.Status == "" || b.Status == f.Status)
+}
+
+// BookingStore keeps seat inventory and bookings. Booking and cancellation
+// change inventory atomically, so seats are never oversold.
+type BookingStore interface {
+	// Seats returns flight inventory ordered by cabin
+	Seats(flightID uint) ([]Seats, error)
+	// SetCapacity sets capacity of given cabins, other cabins are kept as is
+	SetCapacity(flightID uint, capacity map[Cabin]int) error
+	// Book reserves seats and creates confirmed booking. Flight, which is
+	// deleted or not bookable by status, returns ErrNotFound or
+	// ErrFlightClosed.
+	Book(b *Booking) error
+	// Cancel cancels confirmed booking and releases its seats
+	Cancel(id uint) (*Booking, error)
+	Find(id uint) (*Booking, error)
+	// List returns bookings, the most recent first
+	List(f BookingFilter) ([]Booking, error)
+}
+
+// Validate checks requested cabin and seats
+func (b *Booking) Validate() error {
+	var v problem.Validation
+
+	if _, err := ParseCabin(string(b.Cabin)); err != nil {
+		v.Add("cabin", "invalid", err.Error())
+	}
+
+	v.Check(b.Seats >= 1 && b.Seats <= MaxBookingSeats, "seats", "range",
+		fmt.Sprintf("Seats must be from 1 to %d", MaxBookingSeats))
+
+	return v.Err()
+}
+
+// ValidateCapacity checks cabins and capacities
+func ValidateCapacity(capacity map[Cabin]int) error {
+	var v problem.Validation
+
+	v.Check(len(capacity) != 0, "cabins", "required", "Please provide capacity of at least one cabin")
+
+	names := make([]string, 0, len(capacity))
+	for cabin := range capacity {
+		names = append(names, string(cabin))
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cabin, n := Cabin(name), capacity[Cabin(name)]
+
+		if _, err := ParseCabin(string(cabin)); err != nil {
+			v.Add(string(cabin), "invalid", err.Error())
+			continue
+		}
+		v.Check(n >= 0, string(cabin), "negative", "Capacity can't be negative")
+	}
+
+	return v.Err()
+}
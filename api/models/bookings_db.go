@@ -0,0 +1,179 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type dbBookingStore struct {
+	db *gorm.DB
+}
+
+func (s *dbBookingStore) Seats(flightID uint) ([]Seats, error) {
+	seats := []Seats{}
+
+	err := s.db.Where("flight_id = ?", flightID).Order("cabin").Find(&seats).Error
+
+	return seats, err
+}
+
+func (s *dbBookingStore) SetCapacity(flightID uint, capacity map[Cabin]int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		for cabin, n := range capacity {
+			var cur Seats
+
+			err := tx.Where("flight_id = ? AND cabin = ?", flightID, cabin).First(&cur).Error
+			if gorm.IsRecordNotFoundError(err) {
+				if err = tx.Create(&Seats{FlightID: flightID, Cabin: cabin, Capacity: n}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			// Condition guards against bookings made since the row was read
+			result := tx.Model(&Seats{}).
+				Where("flight_id = ? AND cabin = ? AND booked <= ?", flightID, cabin, n).
+				UpdateColumn("capacity", n)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return ErrCapacityBooked
+			}
+		}
+
+		return nil
+	})
+}
+
+func (s *dbBookingStore) Book(b *Booking) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var f Flight
+
+		// Flight row is locked, so it's not deleted or closed meanwhile.
+		// SQLite serializes writers itself.
+		q := tx.Select("id, status").Where("id = ?", b.FlightID)
+		if tx.Dialect().GetName() == DriverPostgres {
+			q = q.Set("gorm:query_option", "FOR SHARE")
+		}
+
+		if err := q.First(&f).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if !f.Status.Bookable() {
+			return ErrFlightClosed
+		}
+
+		// Single conditional update is atomic, concurrent bookings
+		// can't take the same seats
+		result := tx.Model(&Seats{}).
+			Where("flight_id = ? AND cabin = ? AND booked + ? <= capacity", b.FlightID, b.Cabin, b.Seats).
+			UpdateColumn("booked", gorm.Expr("booked + ?", b.Seats))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			var count int
+
+			if err := tx.Model(&Seats{}).Where("flight_id = ? AND cabin = ? AND capacity > 0", b.FlightID, b.Cabin).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrCabinUnavailable
+			}
+			return ErrSoldOut
+		}
+
+		b.ID = 0
+		b.Status = BookingConfirmed
+		b.CancelledAt = nil
+
+		return tx.Create(b).Error
+	})
+}
+
+func (s *dbBookingStore) Cancel(id uint) (*Booking, error) {
+	var b Booking
+
+	err := s.db.Transaction(func(tx *gorm.DB) (err error) {
+		b, err = cancelBooking(tx, id, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+// cancelBooking cancels confirmed booking and releases its seats within
+// transaction tx
+func cancelBooking(tx *gorm.DB, id uint, now time.Time) (Booking, error) {
+	var b Booking
+
+	result := tx.Model(&Booking{}).
+		Where("id = ? AND status = ?", id, BookingConfirmed).
+		Updates(map[string]interface{}{"status": BookingCancelled, "cancelled_at": now})
+	if result.Error != nil {
+		return b, result.Error
+	}
+
+	if err := tx.First(&b, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return b, ErrNotFound
+		}
+		return b, err
+	}
+
+	if result.RowsAffected == 0 {
+		return b, ErrBookingCancelled
+	}
+
+	err := tx.Model(&Seats{}).
+		Where("flight_id = ? AND cabin = ?", b.FlightID, b.Cabin).
+		UpdateColumn("booked", gorm.Expr("booked - ?", b.Seats)).Error
+
+	return b, err
+}
+
+func (s *dbBookingStore) Find(id uint) (*Booking, error) {
+	var b Booking
+
+	if err := s.db.First(&b, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+func (s *dbBookingStore) List(f BookingFilter) ([]Booking, error) {
+	bookings := []Booking{}
+
+	q := s.db.Model(&Booking{})
+
+	if f.UserID != 0 {
+		q = q.Where("user_id = ?", f.UserID)
+	}
+	if f.FlightID != 0 {
+		q = q.Where("flight_id = ?", f.FlightID)
+	}
+	if f.Status != "" {
+		q = q.Where("status = ?", f.Status)
+	}
+
+	err := q.Order("created_at DESC, id DESC").Find(&bookings).Error
+
+	return bookings, err
+}
@@ -0,0 +1,188 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type seatsKey struct {
+	flightID uint
+	cabin    Cabin
+}
+
+// memBookingStore guards inventory and bookings with a single lock,
+// so booking is atomic
+type memBookingStore struct {
+	sync.RWMutex
+	seq      uint
+	seats    map[seatsKey]Seats
+	bookings map[uint]Booking
+	// flights are checked to be bookable, their lock is taken first
+	flights *memFlights
+}
+
+func newMemBookingStore() *memBookingStore {
+	return &memBookingStore{
+		seats:    make(map[seatsKey]Seats),
+		bookings: make(map[uint]Booking),
+	}
+}
+
+func (s *memBookingStore) Seats(flightID uint) ([]Seats, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := []Seats{}
+
+	for k, seats := range s.seats {
+		if k.flightID == flightID {
+			result = append(result, seats)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Cabin < result[j].Cabin
+	})
+
+	return result, nil
+}
+
+func (s *memBookingStore) SetCapacity(flightID uint, capacity map[Cabin]int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for cabin, n := range capacity {
+		if s.seats[seatsKey{flightID, cabin}].Booked > n {
+			return ErrCapacityBooked
+		}
+	}
+
+	for cabin, n := range capacity {
+		k := seatsKey{flightID, cabin}
+		seats := s.seats[k]
+		seats.FlightID, seats.Cabin, seats.Capacity = flightID, cabin, n
+		s.seats[k] = seats
+	}
+
+	return nil
+}
+
+func (s *memBookingStore) Book(b *Booking) error {
+	if s.flights != nil {
+		s.flights.RLock()
+		defer s.flights.RUnlock()
+
+		f, ok := s.flights.flights[b.FlightID]
+		if !ok || f.DeletedAt != nil {
+			return ErrNotFound
+		}
+
+		if !f.Status.Bookable() {
+			return ErrFlightClosed
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	k := seatsKey{b.FlightID, b.Cabin}
+
+	seats, ok := s.seats[k]
+	if !ok || seats.Capacity == 0 {
+		return ErrCabinUnavailable
+	}
+
+	if seats.Available() < b.Seats {
+		return ErrSoldOut
+	}
+
+	seats.Booked += b.Seats
+	s.seats[k] = seats
+
+	s.seq++
+	b.ID = s.seq
+	b.Status = BookingConfirmed
+	b.CreatedAt = time.Now().UTC()
+	b.CancelledAt = nil
+	s.bookings[b.ID] = *b
+
+	return nil
+}
+
+func (s *memBookingStore) Cancel(id uint) (*Booking, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.cancel(id)
+}
+
+// cancel cancels confirmed booking and releases its seats, store must
+// be locked
+func (s *memBookingStore) cancel(id uint) (*Booking, error) {
+	b, ok := s.bookings[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if b.Status == BookingCancelled {
+		return nil, ErrBookingCancelled
+	}
+
+	now := time.Now().UTC()
+	b.Status = BookingCancelled
+	b.CancelledAt = &now
+	s.bookings[id] = b
+
+	k := seatsKey{b.FlightID, b.Cabin}
+	seats := s.seats[k]
+	seats.Booked -= b.Seats
+	s.seats[k] = seats
+
+	return &b, nil
+}
+
+// confirmed reports whether flight has confirmed bookings
+func (s *memBookingStore) confirmed(flightID uint) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, b := range s.bookings {
+		if b.FlightID == flightID && b.Status == BookingConfirmed {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *memBookingStore) Find(id uint) (*Booking, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	b, ok := s.bookings[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &b, nil
+}
+
+func (s *memBookingStore) List(f BookingFilter) ([]Booking, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := []Booking{}
+
+	for _, b := range s.bookings {
+		if f.matches(&b) {
+			result = append(result, b)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID > result[j].ID
+	})
+
+	return result, nil
+}
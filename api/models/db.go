@@ -2,35 +2,99 @@ package models
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
 
 	"github.com/3d0c/sample-api/pkg/helpers"
 )
 
-var db *gorm.DB
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite3"
+)
 
-func ConnectDatabase() error {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable",
-		helpers.Getenv("DBHOST", "127.0.0.1"),
-		helpers.Getenv("DBPORT", "5432"),
-		helpers.Getenv("DBUSER", "postgres"),
-		helpers.Getenv("DBNAME", "sampleapi"),
+// ConnectDatabase opens database using one of supported drivers.
+// PostgreSQL is configured by DBHOST, DBPORT, DBUSER and DBNAME,
+// SQLite by DBPATH, which is either a file name or ":memory:".
+// Schema is managed by api/migrations package.
+func ConnectDatabase(driver string) (*gorm.DB, error) {
+	var (
+		dsn  string
+		conn *gorm.DB
+		err  error
 	)
 
-	conn, err := gorm.Open("postgres", dsn)
-	if err != nil {
-		return err
+	switch driver {
+	case DriverPostgres:
+		dsn = fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable",
+			helpers.Getenv("DBHOST", "127.0.0.1"),
+			helpers.Getenv("DBPORT", "5432"),
+			helpers.Getenv("DBUSER", "postgres"),
+			helpers.Getenv("DBNAME", "sampleapi"),
+		)
+	case DriverSQLite:
+		dsn = helpers.Getenv("DBPATH", "sampleapi.db")
+
+		// SQLite enforces foreign keys, i.e. ON DELETE rules of
+		// migrations, only if connection enables them
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "_foreign_keys=1"
+	default:
+		return nil, fmt.Errorf("unsupported database driver '%s'", driver)
+	}
+
+	if conn, err = gorm.Open(driver, dsn); err != nil {
+		return nil, err
+	}
+
+	if driver == DriverSQLite {
+		// Every connection to ":memory:" gets its own empty database,
+		// single connection also avoids "database is locked" errors
+		conn.DB().SetMaxOpenConns(1)
 	}
 
 	conn.LogMode(true)
 
-	if err = conn.AutoMigrate(&User{}, &Flight{}).Error; err != nil {
-		return err
+	return conn, nil
+}
+
+// NewDBStores returns stores backed by database connection
+func NewDBStores(conn *gorm.DB) *Stores {
+	return &Stores{
+		Flights:   &dbFlightStore{db: conn},
+		Users:     &dbUserStore{db: conn},
+		Tokens:    &dbTokenStore{db: conn},
+		Airports:  &dbAirportStore{db: conn},
+		Bookings:  &dbBookingStore{db: conn},
+		Schedules: &dbScheduleStore{db: conn},
+
+		Organizations: &dbOrganizationStore{db: conn},
+		Audit:         &dbAuditStore{db: conn},
 	}
+}
+
+// NewMemoryStores returns stores which keep everything in memory
+func NewMemoryStores() *Stores {
+	// Flights aren't deleted with bookings, bookings are made for
+	// bookable flights only
+	flights, bookings := newMemFlightStore(), newMemBookingStore()
+	flights.bookings, bookings.flights = bookings, flights.memFlights
 
-	db = conn
+	return &Stores{
+		Flights:   flights,
+		Users:     newMemUserStore(bookings),
+		Tokens:    newMemTokenStore(),
+		Airports:  newMemAirportStore(),
+		Bookings:  bookings,
+		Schedules: newMemScheduleStore(flights.memFlights),
 
-	return nil
+		Organizations: newMemOrganizationStore(),
+		Audit:         newMemAuditStore(),
+	}
 }
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// DefaultCurrency is used for fares without explicit currency
+const DefaultCurrency = "USD"
+
+// ErrCurrencyUnavailable is returned when there is no exchange rate
+// for requested conversion
+var ErrCurrencyUnavailable = problem.BadRequest("currency_unavailable", "no exchange rate for currency")
+
+// currencies maps supported ISO 4217 codes to number of minor unit digits
+var currencies = map[string]int{
+	"AED": 2, "AMD": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2,
+	"CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2, "GEL": 2, "HKD": 2,
+	"HUF": 2, "ILS": 2, "INR": 2, "JPY": 0, "KRW": 0, "KWD": 3, "KZT": 2,
+	"MXN": 2, "NOK": 2, "NZD": 2, "PLN": 2, "RUB": 2, "SEK": 2, "SGD": 2,
+	"THB": 2, "TRY": 2, "UAH": 2, "USD": 2, "ZAR": 2,
+}
+
+// ValidCurrency reports whether code is a supported ISO 4217 currency
+func ValidCurrency(code string) bool {
+	_, ok := currencies[code]
+	return ok
+}
+
+// FareClass is a fare of flight, it is priced in flight currency
+type FareClass struct {
+	ID         uint   `gorm:"primary_key" json:"-"`
+	FlightID   uint   `json:"-"`
+	Code       string `json:"code" gorm:"type:varchar(16)"`
+	Cabin      Cabin  `json:"cabin" gorm:"type:varchar(16)"`
+	Fare       int64  `json:"fare"`
+	Refundable bool   `json:"refundable"`
+	// BaggageKg is checked baggage allowance, 0 is hand luggage only
+	BaggageKg int `json:"baggage_kg"`
+}
+
+func (FareClass) TableName() string {
+	return "fare_classes"
+}
+
+// ValidatePricingUpdate validates changed currency, fare or fare classes.
+// Fare of flight with fare classes is changed by classes only, empty
+// classes list removes them and requires fare.
+func (f *Flight) ValidatePricingUpdate(cur *Flight) error {
+	var v problem.Validation
+
+	v.Check(f.Fare == 0 || f.FareClasses != nil || len(cur.FareClasses) == 0, "fare", "fare_classes",
+		"Fare of flight with fare classes is the lowest class fare, please update fare classes")
+
+	if err := v.Merge(f.validatePricing(true)); err != nil {
+		return err
+	}
+
+	return v.Err()
+}
+
+// validatePricing checks currency and fare classes. Currency defaults to
+// DefaultCurrency, fare is the lowest class fare if classes are set.
+// Partial validation is used for updates, where missing fields are kept.
+func (f *Flight) validatePricing(partial bool) error {
+	var v problem.Validation
+
+	f.Currency = strings.ToUpper(strings.TrimSpace(f.Currency))
+
+	if f.Currency == "" && !partial {
+		f.Currency = DefaultCurrency
+	}
+
+	v.Check(f.Currency == "" || ValidCurrency(f.Currency), "currency", "invalid", "Currency must be a supported ISO 4217 code")
+
+	if len(f.FareClasses) == 0 {
+		v.Check(f.Fare != 0 || (partial && f.FareClasses == nil), "fare", "required", "Please provide flight fare")
+		v.Check(f.Fare >= 0, "fare", "negative", "Flight fare can't be negative")
+		return v.Err()
+	}
+
+	codes := make(map[string]bool)
+
+	for i := range f.FareClasses {
+		c := &f.FareClasses[i]
+		field := fmt.Sprintf("fare_classes[%d]", i)
+
+		c.ID, c.FlightID = 0, 0
+		c.Code = strings.ToUpper(strings.TrimSpace(c.Code))
+
+		if c.Cabin == "" {
+			c.Cabin = CabinEconomy
+		}
+
+		v.Check(c.Code != "", field+".code", "required", "Please provide fare class code")
+		v.Check(c.Code == "" || !codes[c.Code], field+".code", "duplicate", fmt.Sprintf("Fare class '%s' is set twice", c.Code))
+		v.Check(cabins[c.Cabin], field+".cabin", "invalid", "Cabin must be economy, premium, business or first")
+		v.Check(c.Fare > 0, field+".fare", "required", "Please provide positive fare class fare")
+		v.Check(c.BaggageKg >= 0, field+".baggage_kg", "negative", "Baggage allowance can't be negative")
+
+		codes[c.Code] = true
+
+		if i == 0 || c.Fare < f.Fare {
+			f.Fare = c.Fare
+		}
+	}
+
+	return v.Err()
+}
+
+// Rates is an exchange rates table, every rate is amount of currency
+// for one unit of base currency
+type Rates struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// LoadRates reads rates table from JSON file:
+//
+//	{"base": "USD", "rates": {"EUR": 0.92, "GBP": 0.79}}
+func LoadRates(file string) (*Rates, error) {
+	var r Rates
+
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("malformed rates file %s - %s", file, err)
+	}
+
+	if !ValidCurrency(r.Base) {
+		return nil, fmt.Errorf("unsupported base currency '%s'", r.Base)
+	}
+
+	for code, rate := range r.Rates {
+		if !ValidCurrency(code) {
+			return nil, fmt.Errorf("unsupported currency '%s'", code)
+		}
+		if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+			return nil, fmt.Errorf("rate of %s must be positive", code)
+		}
+	}
+
+	if r.Rates == nil {
+		r.Rates = make(map[string]float64)
+	}
+
+	r.Rates[r.Base] = 1
+
+	return &r, nil
+}
+
+// Supports reports whether amounts can be converted to or from currency
+func (r *Rates) Supports(currency string) bool {
+	if r == nil {
+		return false
+	}
+
+	_, ok := r.Rates[currency]
+
+	return ok
+}
+
+// Convert converts amount in minor units, result is rounded to the
+// nearest minor unit of target currency. Nil rates convert nothing
+// but the same currency.
+func (r *Rates) Convert(amount int64, from, to string) (int64, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	if !r.Supports(from) || !r.Supports(to) {
+		return 0, ErrCurrencyUnavailable
+	}
+
+	major := float64(amount) / math.Pow10(currencies[from])
+	converted := major / r.Rates[from] * r.Rates[to]
+
+	return int64(math.Round(converted * math.Pow10(currencies[to]))), nil
+}
+
+// ConvertFlights converts fares of flights to currency. Flights, which
+// currency has no exchange rate, keep their fares and currency.
+func (r *Rates) ConvertFlights(flights []Flight, currency string) error {
+	var err error
+
+	for i := range flights {
+		f := &flights[i]
+
+		if f.Currency != currency && !r.Supports(f.Currency) {
+			continue
+		}
+
+		if f.Fare, err = r.Convert(f.Fare, f.Currency, currency); err != nil {
+			return err
+		}
+
+		for j := range f.FareClasses {
+			if f.FareClasses[j].Fare, err = r.Convert(f.FareClasses[j].Fare, f.Currency, currency); err != nil {
+				return err
+			}
+		}
+
+		f.Currency = currency
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// CodeIllegalTransition is a problem code for rejected status change
+const CodeIllegalTransition = "illegal_status_transition"
+
+// ErrStatusChanged is returned when status was changed by concurrent request
+var ErrStatusChanged = problem.Conflict("status_changed", "flight status was changed by another request, please retry")
+
+// FlightStatus is a flight lifecycle state
+type FlightStatus string
+
+const (
+	StatusScheduled FlightStatus = "scheduled"
+	StatusDelayed   FlightStatus = "delayed"
+	StatusBoarding  FlightStatus = "boarding"
+	StatusDeparted  FlightStatus = "departed"
+	StatusLanded    FlightStatus = "landed"
+	StatusCancelled FlightStatus = "cancelled"
+)
+
+// statusTransitions lists allowed next states. Delayed flight can be
+// delayed again, landed and cancelled flights are final.
+var statusTransitions = map[FlightStatus][]FlightStatus{
+	StatusScheduled: {StatusDelayed, StatusBoarding, StatusCancelled},
+	StatusDelayed:   {StatusDelayed, StatusBoarding, StatusCancelled},
+	StatusBoarding:  {StatusDelayed, StatusDeparted, StatusCancelled},
+	StatusDeparted:  {StatusLanded},
+	StatusLanded:    {},
+	StatusCancelled: {},
+}
+
+func ParseFlightStatus(s string) (FlightStatus, error) {
+	if _, ok := statusTransitions[FlightStatus(s)]; !ok {
+		return "", fmt.Errorf("unknown status '%s', expected scheduled, delayed, boarding, departed, landed or cancelled", s)
+	}
+
+	return FlightStatus(s), nil
+}
+
+// CanBecome reports whether flight in status s can change to next
+func (s FlightStatus) CanBecome(next FlightStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Bookable reports whether seats of flight in status s can be sold
+func (s FlightStatus) Bookable() bool {
+	return s == StatusScheduled || s == StatusDelayed || s == StatusBoarding
+}
+
+// transition checks status change and returns conflict problem with
+// allowed states if it is illegal
+func (s FlightStatus) transition(next FlightStatus) error {
+	if s.CanBecome(next) {
+		return nil
+	}
+
+	allowed := make([]string, len(statusTransitions[s]))
+	for i, a := range statusTransitions[s] {
+		allowed[i] = string(a)
+	}
+
+	return problem.Conflict(CodeIllegalTransition, fmt.Sprintf("flight can't change status from %s to %s", s, next)).
+		With("from", s).
+		With("to", next).
+		With("allowed", allowed)
+}
+
+// StatusChange is a record of flight status history
+type StatusChange struct {
+	ID       uint         `gorm:"primary_key"`
+	FlightID uint         `json:"flight_id"`
+	From     FlightStatus `json:"from" gorm:"column:from_status;type:varchar(16)"`
+	To       FlightStatus `json:"status" gorm:"column:to_status;type:varchar(16)"`
+	// Time is actual departure or arrival time, or estimated departure of delayed flight
+	Time      *time.Time `json:"time,omitempty"`
+	Reason    string     `json:"reason,omitempty" gorm:"type:varchar(255)"`
+	UserID    uint       `json:"user_id"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (StatusChange) TableName() string {
+	return "flight_status_history"
+}
+
+// Validate checks requested status and fields required by it
+func (c *StatusChange) Validate() error {
+	var v problem.Validation
+
+	if _, err := ParseFlightStatus(string(c.To)); err != nil {
+		v.Add("status", "invalid", err.Error())
+	}
+
+	c.Reason = strings.TrimSpace(c.Reason)
+
+	v.Check(c.Reason != "" || (c.To != StatusDelayed && c.To != StatusCancelled),
+		"reason", "required", fmt.Sprintf("Please provide reason of %s status", c.To))
+	v.Check(c.Time != nil || c.To != StatusDelayed,
+		"time", "required", "Please provide estimated departure time of delayed flight")
+	v.Check(c.Time == nil || c.To == StatusDelayed || c.To == StatusDeparted || c.To == StatusLanded,
+		"time", "unexpected", fmt.Sprintf("Time can't be set for %s status", c.To))
+
+	return v.Err()
+}
+
+// apply checks transition and changes flight status and times. Actual
+// times default to now.
+func (c *StatusChange) apply(f *Flight, now time.Time) error {
+	if err := f.Status.transition(c.To); err != nil {
+		return err
+	}
+
+	c.FlightID = f.ID
+	c.From = f.Status
+	c.CreatedAt = now
+
+	if c.Time != nil {
+		t := c.Time.UTC()
+		c.Time = &t
+	} else if c.To == StatusDeparted || c.To == StatusLanded {
+		c.Time = &now
+	}
+
+	switch c.To {
+	case StatusDelayed:
+		f.EstimatedDeparture = c.Time
+	case StatusDeparted:
+		f.ActualDeparture = c.Time
+	case StatusLanded:
+		if f.ActualDeparture != nil && c.Time.Before(*f.ActualDeparture) {
+			var v problem.Validation
+			v.Add("time", "range", "Arrival can't be before actual departure")
+			return v.Err()
+		}
+		f.ActualArrival = c.Time
+	}
+
+	f.Status = c.To
+
+	if c.UserID != 0 {
+		by := c.UserID
+		f.UpdatedBy = &by
+	}
+
+	return nil
+}
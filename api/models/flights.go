@@ -2,75 +2,374 @@ package models
 
 import (
 	"fmt"
+	"net/http"
 	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
 )
 
+// ErrVersionMismatch is returned when flight was changed since the version
+// update or delete is conditioned on
+var ErrVersionMismatch = problem.New(http.StatusPreconditionFailed, "version_mismatch", "flight was changed by another request")
+
+// ErrFlightNotDeleted is returned on restore of flight, which is not deleted
+var ErrFlightNotDeleted = problem.Conflict("flight_not_deleted", "flight is not deleted")
+
+// ErrNotFlightOwner is returned when user changes flight owned by another user
+var ErrNotFlightOwner = problem.Forbidden("not_flight_owner", "flight is owned by another user")
+
 type Flight struct {
-	ID          uint      `gorm:"primary_key"`
+	ID             uint `gorm:"primary_key"`
+	OrganizationID uint `json:"organization_id"`
+	// Version is incremented by every change, it starts from 1
+	Version     int       `json:"version"`
 	Name        string    `json:"name" gorm:"type:varchar(255)"`
 	Number      string    `json:"number" gorm:"type:varchar(255)"`
 	Scheduled   time.Time `json:"scheduled"`
 	Arrival     time.Time `json:"arrival"`
 	Departure   time.Time `json:"departure"`
 	Destination string    `json:"destination" gorm:"type:varchar(255)"`
-	Fare        float64   `json:"fare"`
 	Duration    int       `json:"duration"`
+
+	// Fare is in minor units of currency, e.g. cents. It is the lowest
+	// fare class fare if flight has fare classes.
+	Fare        int64       `json:"fare"`
+	Currency    string      `json:"currency" gorm:"type:varchar(3)"`
+	FareClasses []FareClass `json:"fare_classes,omitempty" gorm:"-"`
+
+	OriginAirportID      *uint `json:"origin_airport_id,omitempty"`
+	DestinationAirportID *uint `json:"destination_airport_id,omitempty"`
+
+	// Status and actual times are changed by status transitions only
+	Status             FlightStatus `json:"status" gorm:"type:varchar(16)"`
+	EstimatedDeparture *time.Time   `json:"estimated_departure,omitempty"`
+	ActualDeparture    *time.Time   `json:"actual_departure,omitempty"`
+	ActualArrival      *time.Time   `json:"actual_arrival,omitempty"`
+
+	// Flights materialized by schedule, Detached is set when such flight
+	// is edited manually, generator doesn't change it anymore
+	ScheduleID   *uint  `json:"schedule_id,omitempty"`
+	ScheduleDate string `json:"schedule_date,omitempty" gorm:"type:varchar(10)"`
+	Detached     bool   `json:"detached,omitempty"`
+
+	// CreatedBy is the owner of flight, UpdatedBy is the last user who
+	// changed it. Flights generated by schedules have no owner.
+	CreatedBy *uint `json:"created_by,omitempty"`
+	UpdatedBy *uint `json:"updated_by,omitempty"`
+
+	// Deleted flights are kept in trash until retention job purges them
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	DeletedBy *uint      `json:"deleted_by,omitempty"`
+
+	// Times in zones of origin and destination airports, they are set
+	// for responses only by Localize
+	OriginTimeZone      string     `json:"origin_timezone,omitempty" gorm:"-"`
+	DestinationTimeZone string     `json:"destination_timezone,omitempty" gorm:"-"`
+	ScheduledLocal      *time.Time `json:"scheduled_local,omitempty" gorm:"-"`
+	DepartureLocal      *time.Time `json:"departure_local,omitempty" gorm:"-"`
+	ArrivalLocal        *time.Time `json:"arrival_local,omitempty" gorm:"-"`
+}
+
+// utc converts flight times to UTC, so they are stored and compared
+// the same way by all database drivers. Local times are dropped.
+func (f *Flight) utc() {
+	f.OriginTimeZone, f.DestinationTimeZone = "", ""
+	f.ScheduledLocal, f.DepartureLocal, f.ArrivalLocal = nil, nil, nil
+
+	for _, t := range []*time.Time{f.EstimatedDeparture, f.ActualDeparture, f.ActualArrival} {
+		if t != nil {
+			*t = t.UTC()
+		}
+	}
+
+	if f.DeletedAt != nil {
+		*f.DeletedAt = f.DeletedAt.UTC()
+	}
+
+	f.Scheduled = f.Scheduled.UTC()
+	f.Arrival = f.Arrival.UTC()
+	f.Departure = f.Departure.UTC()
+}
+
+// sameInstance reports whether schedule instance has the same fields
+// as generated one
+func (f *Flight) sameInstance(g *Flight) bool {
+	return f.Name == g.Name &&
+		f.Number == g.Number &&
+		f.Scheduled.Equal(g.Scheduled) &&
+		f.Departure.Equal(g.Departure) &&
+		f.Arrival.Equal(g.Arrival) &&
+		f.Destination == g.Destination &&
+		f.Fare == g.Fare &&
+		f.Currency == g.Currency &&
+		f.Duration == g.Duration &&
+		equalID(f.OriginAirportID, g.OriginAirportID) &&
+		equalID(f.DestinationAirportID, g.DestinationAirportID)
+}
+
+// scheduledDate returns start of UTC day of scheduled time, flight numbers
+// are unique per organization and date
+func scheduledDate(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
 }
 
-type Search struct {
-	Name        string
-	Scheduled   string
-	Departure   string
-	Destination string
+func equalID(a, b *uint) bool {
+	return (a == nil && b == nil) || (a != nil && b != nil && *a == *b)
 }
 
-// TODO
-func (f *Flight) Validate() error {
-	if f.Name == "" {
-		return fmt.Errorf("Please provide flight name")
-	}
-	if f.Number == "" {
-		return fmt.Errorf("Please provide flight number")
-	}
-	// if f.Scheduled.IsZero() {
-	// 	return fmt.Errorf("Please provide flight scheduled time")
-	// }
-	// if f.Arrival.IsZero() {
-	// 	return fmt.Errorf("Please provide flight arrival time")
-	// }
-	// if f.Departure.IsZero() {
-	// 	return fmt.Errorf("Please provide flight departure time")
-	// }
-	if f.Destination == "" {
-		return fmt.Errorf("Please provide flight destination")
-	}
-	if f.Fare == 0 {
-		return fmt.Errorf("Please provide flight fare")
+// resetReadOnly drops status and deletion fields, which can't be set directly
+func (f *Flight) resetReadOnly() {
+	f.Status = ""
+	f.EstimatedDeparture = nil
+	f.ActualDeparture = nil
+	f.ActualArrival = nil
+	f.DeletedAt = nil
+	f.DeletedBy = nil
+}
+
+// CanModify reports whether user may change flight. Owned flights are
+// changed by their owners and admins, flights without owner by anyone
+// allowed to manage flights.
+func (f *Flight) CanModify(userID uint, role Role) bool {
+	return f.CreatedBy == nil || *f.CreatedBy == userID || role.Includes(RoleAdmin)
+}
+
+// Validate checks all fields and reports every invalid one. Referenced
+// airports must exist in airports store.
+func (f *Flight) Validate(airports AirportStore) error {
+	var v problem.Validation
+
+	v.Check(f.Name != "", "name", "required", "Please provide flight name")
+	v.Check(f.Number != "", "number", "required", "Please provide flight number")
+	v.Check(!f.Departure.IsZero(), "departure", "required", "Please provide flight departure time")
+	v.Check(!f.Arrival.IsZero(), "arrival", "required", "Please provide flight arrival time")
+	v.Check(f.Destination != "" || f.DestinationAirportID != nil, "destination", "required", "Please provide flight destination or destination airport")
+
+	if !f.Departure.IsZero() && !f.Arrival.IsZero() {
+		if err := v.Merge(f.ValidateTimes()); err != nil {
+			return err
+		}
 	}
+
+	if err := v.Merge(f.validatePricing(false)); err != nil {
+		return err
+	}
+
+	if err := v.Merge(f.ValidateAirports(airports)); err != nil {
+		return err
+	}
+
+	return v.Err()
+}
+
+// ValidateTimes checks that departure precedes arrival and duration
+// agrees with them. Missing scheduled time defaults to departure and
+// missing duration is derived from departure and arrival.
+func (f *Flight) ValidateTimes() error {
+	var v problem.Validation
+
+	if f.Scheduled.IsZero() {
+		f.Scheduled = f.Departure
+	}
+
+	if !f.Arrival.After(f.Departure) {
+		v.Add("arrival", "range", "Arrival must be after departure")
+		return v.Err()
+	}
+
+	duration := int(f.Arrival.Sub(f.Departure) / time.Minute)
+
 	if f.Duration == 0 {
-		return fmt.Errorf("Please provide esimated flight duration")
+		f.Duration = duration
 	}
 
+	v.Check(f.Duration == duration, "duration", "inconsistent",
+		fmt.Sprintf("Duration must be %d minutes between departure and arrival", duration))
+
+	return v.Err()
+}
+
+// ValidateTimesUpdate validates changed times together with current ones.
+// Duration is derived again if departure or arrival is changed without it.
+func (f *Flight) ValidateTimesUpdate(cur *Flight) error {
+	if f.Scheduled.IsZero() && f.Departure.IsZero() && f.Arrival.IsZero() && f.Duration == 0 {
+		return nil
+	}
+
+	merged := *cur
+	merged.Duration = f.Duration
+
+	if !f.Scheduled.IsZero() {
+		merged.Scheduled = f.Scheduled
+	}
+	if !f.Departure.IsZero() {
+		merged.Departure = f.Departure
+	}
+	if !f.Arrival.IsZero() {
+		merged.Arrival = f.Arrival
+	}
+
+	// Flights created before times were required can't be checked
+	if merged.Departure.IsZero() || merged.Arrival.IsZero() {
+		var v problem.Validation
+		v.Check(f.Duration >= 0, "duration", "negative", "Flight duration can't be negative")
+		return v.Err()
+	}
+
+	if err := merged.ValidateTimes(); err != nil {
+		return err
+	}
+
+	f.Duration = merged.Duration
+
 	return nil
 }
 
-func (f *Flight) Create() error {
-	return db.Create(&f).Error
+// Localize sets times in zones of referenced airports
+func (f *Flight) Localize(airports AirportStore) error {
+	flights := []Flight{*f}
+
+	if err := LocalizeFlights(flights, airports); err != nil {
+		return err
+	}
+
+	*f = flights[0]
+
+	return nil
 }
 
-func (f *Flight) Delete(id int) error {
-	return db.Delete(&Flight{}, id).Error
+// LocalizeFlights sets local times of flights, every airport is looked up once
+func LocalizeFlights(flights []Flight, airports AirportStore) error {
+	zones := make(map[uint]*time.Location)
+
+	zone := func(id *uint) (*time.Location, error) {
+		if id == nil {
+			return nil, nil
+		}
+
+		if loc, ok := zones[*id]; ok {
+			return loc, nil
+		}
+
+		a, err := airports.Find(*id)
+		if err == ErrNotFound {
+			zones[*id] = nil
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		zones[*id] = a.Location()
+
+		return zones[*id], nil
+	}
+
+	for i := range flights {
+		f := &flights[i]
+
+		origin, err := zone(f.OriginAirportID)
+		if err != nil {
+			return err
+		}
+
+		destination, err := zone(f.DestinationAirportID)
+		if err != nil {
+			return err
+		}
+
+		if origin != nil {
+			f.OriginTimeZone = origin.String()
+			f.ScheduledLocal = localTime(f.Scheduled, origin)
+			f.DepartureLocal = localTime(f.Departure, origin)
+		}
+
+		if destination != nil {
+			f.DestinationTimeZone = destination.String()
+			f.ArrivalLocal = localTime(f.Arrival, destination)
+		}
+	}
+
+	return nil
 }
 
-func (f *Flight) Update(id int) error {
-	f.ID = uint(id)
-	return db.Model(&Flight{}).Updates(f).Error
+func localTime(t time.Time, loc *time.Location) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	t = t.In(loc)
+
+	return &t
 }
 
-func (f *Flight) Find(s map[string]interface{}) ([]Flight, error) {
-	var flights []Flight
+// ValidateAirports checks that referenced airports exist and differ
+func (f *Flight) ValidateAirports(airports AirportStore) error {
+	var v problem.Validation
+
+	refs := []struct {
+		field string
+		id    *uint
+	}{
+		{"origin_airport_id", f.OriginAirportID},
+		{"destination_airport_id", f.DestinationAirportID},
+	}
+
+	for _, ref := range refs {
+		if ref.id == nil {
+			continue
+		}
+
+		_, err := airports.Find(*ref.id)
+		if err == ErrNotFound {
+			v.Add(ref.field, "not_found", fmt.Sprintf("Airport %d doesn't exist", *ref.id))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	err := db.Where(s).Find(&flights).Error
+	v.Check(f.OriginAirportID == nil || f.DestinationAirportID == nil || *f.OriginAirportID != *f.DestinationAirportID,
+		"destination_airport_id", "same_airport", "Destination airport must differ from origin airport")
+
+	return v.Err()
+}
 
-	return flights, err
+// FlightStore is implemented by flights storage backends
+type FlightStore interface {
+	// Tenant returns store scoped to flights of organization, flights
+	// of other organizations are never found or changed through it.
+	// Store of organization 0 is not scoped.
+	Tenant(org uint) FlightStore
+	// Create adds flight to organization of scoped store. Flights with
+	// the same number on the same scheduled date are rejected with
+	// ErrFlightExists.
+	Create(f *Flight) error
+	// Update saves non-zero fields of f. Non-zero f.Version is a version
+	// flight must have, ErrVersionMismatch is returned otherwise. f.Version
+	// is set to the new version.
+	Update(id int, f *Flight) error
+	// Save saves all fields of f including zero ones, but status, owner
+	// and organization.
+	// Flight must have f.Version, which is set to the new version.
+	Save(f *Flight) error
+	// Delete moves flight, which has version unless version is 0, to trash.
+	// Deleted flights are not found by Get and by default search. Flights
+	// with confirmed bookings are not deleted, ErrFlightBooked is returned.
+	Delete(id int, version int, by uint) error
+	// Restore returns deleted flight from trash
+	Restore(id int) (*Flight, error)
+	// Purge removes flight for good, unless it has changed since version
+	Purge(id int, version int) error
+	// PurgeDeleted removes flights deleted before time and returns them
+	PurgeDeleted(before time.Time) ([]Flight, error)
+	Get(id int) (*Flight, error)
+	Find(s Search) (FlightPage, error)
+	// SetStatus applies status change if transition from current status
+	// is allowed and records it in flight history
+	SetStatus(id int, c *StatusChange) (*Flight, error)
+	// History returns status changes, the oldest first
+	History(id int) ([]StatusChange, error)
 }
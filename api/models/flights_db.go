@@ -0,0 +1,586 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type dbFlightStore struct {
+	db *gorm.DB
+	// org scopes all queries to organization, 0 is all organizations
+	org uint
+}
+
+func (s *dbFlightStore) Tenant(org uint) FlightStore {
+	return &dbFlightStore{db: s.db, org: org}
+}
+
+// scoped returns flights query restricted to store organization
+func (s *dbFlightStore) scoped(db *gorm.DB) *gorm.DB {
+	q := db.Model(&Flight{})
+
+	if s.org != 0 {
+		q = q.Where("organization_id = ?", s.org)
+	}
+
+	return q
+}
+
+// organization returns organization of new flight, unscoped store keeps
+// the one flight has
+func (s *dbFlightStore) organization(f *Flight) uint {
+	if s.org != 0 {
+		return s.org
+	}
+
+	if f.OrganizationID == 0 {
+		return DefaultOrganizationID
+	}
+
+	return f.OrganizationID
+}
+
+// duplicate returns ErrFlightExists if organization has another live flight
+// with the same number scheduled on the same date
+func duplicate(tx *gorm.DB, org uint, number string, scheduled time.Time, id uint) error {
+	var count int
+
+	day := scheduledDate(scheduled)
+
+	err := tx.Model(&Flight{}).
+		Where("organization_id = ? AND number = ? AND id <> ?", org, number, id).
+		Where("scheduled >= ? AND scheduled < ?", day, day.Add(24*time.Hour)).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return ErrFlightExists
+	}
+
+	return nil
+}
+
+func (s *dbFlightStore) Create(f *Flight) error {
+	f.resetReadOnly()
+	f.Status = StatusScheduled
+	f.Version = 1
+	f.OrganizationID = s.organization(f)
+
+	// Same as currency column default
+	if f.Currency == "" {
+		f.Currency = DefaultCurrency
+	}
+	f.utc()
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := duplicate(tx, f.OrganizationID, f.Number, f.Scheduled, 0); err != nil {
+			return err
+		}
+		if err := tx.Create(f).Error; err != nil {
+			return err
+		}
+		return saveFareClasses(tx, f)
+	})
+}
+
+// Delete relies on gorm soft delete, which excludes rows with deleted_at
+// from all scoped queries
+func (s *dbFlightStore) Delete(id int, version int, by uint) error {
+	var deletedBy *uint
+
+	if by != 0 {
+		deletedBy = &by
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		q := s.scoped(tx).Where("id = ?", id)
+
+		if version != 0 {
+			q = q.Where("version = ?", version)
+		}
+
+		result := q.Updates(map[string]interface{}{
+			"deleted_at": time.Now().UTC(),
+			"deleted_by": deletedBy,
+			"version":    gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return s.conflict(tx, id)
+		}
+
+		// Bookings are counted after the update, which locks flight
+		// row till commit
+		var count int
+
+		if err := tx.Model(&Booking{}).Where("flight_id = ? AND status = ?", id, BookingConfirmed).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count != 0 {
+			return ErrFlightBooked
+		}
+
+		return nil
+	})
+}
+
+func (s *dbFlightStore) Restore(id int) (*Flight, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var f Flight
+
+		if err := s.scoped(tx.Unscoped()).Where("id = ?", id).First(&f).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if f.DeletedAt == nil {
+			return ErrFlightNotDeleted
+		}
+
+		// Number could be taken since flight was deleted
+		if err := duplicate(tx, f.OrganizationID, f.Number, f.Scheduled, f.ID); err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Model(&Flight{}).Where("id = ? AND deleted_at IS NOT NULL", id).Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"deleted_by": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrFlightNotDeleted
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(id)
+}
+
+func (s *dbFlightStore) Purge(id int, version int) error {
+	result := s.scoped(s.db.Unscoped()).Where("id = ? AND version = ?", id, version).Delete(&Flight{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return s.conflict(s.db.Unscoped(), id)
+	}
+
+	return nil
+}
+
+func (s *dbFlightStore) PurgeDeleted(before time.Time) ([]Flight, error) {
+	var deleted, purged []Flight
+
+	if err := s.scoped(s.db.Unscoped()).Where("deleted_at < ?", before.UTC()).Order("id").Find(&deleted).Error; err != nil {
+		return nil, err
+	}
+
+	for _, f := range deleted {
+		// Flight restored since it was read is kept
+		result := s.db.Unscoped().Where("id = ? AND deleted_at < ?", f.ID, before.UTC()).Delete(&Flight{})
+		if result.Error != nil {
+			return purged, result.Error
+		}
+
+		if result.RowsAffected != 0 {
+			purged = append(purged, f)
+		}
+	}
+
+	return purged, nil
+}
+
+// conflict tells missing flight from changed one, when conditional
+// write affected no rows
+func (s *dbFlightStore) conflict(db *gorm.DB, id int) error {
+	var count int
+
+	if err := s.scoped(db).Where("id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return ErrVersionMismatch
+}
+
+func (s *dbFlightStore) Update(id int, f *Flight) error {
+	f.ID = uint(id)
+	f.resetReadOnly()
+	f.CreatedBy = nil
+	f.OrganizationID = 0
+	f.utc()
+
+	version := f.Version
+	f.Version = 0
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var cur Flight
+
+		q := s.scoped(tx).Where("id = ?", id)
+
+		if version != 0 {
+			q = q.Where("version = ?", version)
+		}
+
+		result := q.UpdateColumn("version", gorm.Expr("version + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return s.conflict(tx, id)
+		}
+
+		if err := tx.First(&cur, id).Error; err != nil {
+			return err
+		}
+
+		number, scheduled := cur.Number, cur.Scheduled
+		if f.Number != "" {
+			number = f.Number
+		}
+		if !f.Scheduled.IsZero() {
+			scheduled = f.Scheduled
+		}
+
+		if err := duplicate(tx, cur.OrganizationID, number, scheduled, cur.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&Flight{}).Updates(f).Error; err != nil {
+			return err
+		}
+
+		f.Version = cur.Version
+
+		// Fare classes are replaced if provided
+		if f.FareClasses == nil {
+			return nil
+		}
+
+		if err := tx.Where("flight_id = ?", f.ID).Delete(&FareClass{}).Error; err != nil {
+			return err
+		}
+
+		return saveFareClasses(tx, f)
+	})
+}
+
+func (s *dbFlightStore) Save(f *Flight) error {
+	f.utc()
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var cur Flight
+
+		if err := s.scoped(tx).Where("id = ?", f.ID).First(&cur).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err := duplicate(tx, cur.OrganizationID, f.Number, f.Scheduled, f.ID); err != nil {
+			return err
+		}
+
+		fields := make(map[string]interface{})
+
+		for _, field := range tx.NewScope(f).Fields() {
+			if field.IsNormal && !field.IsIgnored && !field.IsPrimaryKey {
+				fields[field.DBName] = field.Field.Interface()
+			}
+		}
+
+		// Status is changed by SetStatus only, deleted flights are restored,
+		// owner and organization are never changed
+		for _, col := range []string{"status", "estimated_departure", "actual_departure", "actual_arrival",
+			"deleted_at", "deleted_by", "created_by", "organization_id"} {
+			delete(fields, col)
+		}
+
+		fields["version"] = gorm.Expr("version + 1")
+
+		result := tx.Model(&Flight{}).Where("id = ? AND version = ?", f.ID, f.Version).Updates(fields)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return s.conflict(tx, int(f.ID))
+		}
+
+		f.Version++
+		f.OrganizationID = cur.OrganizationID
+
+		if err := tx.Where("flight_id = ?", f.ID).Delete(&FareClass{}).Error; err != nil {
+			return err
+		}
+
+		return saveFareClasses(tx, f)
+	})
+}
+
+func saveFareClasses(tx *gorm.DB, f *Flight) error {
+	for i := range f.FareClasses {
+		c := &f.FareClasses[i]
+		c.ID, c.FlightID = 0, f.ID
+
+		if err := tx.Create(c).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadFareClasses sets fare classes of flights, the cheapest first
+func loadFareClasses(db *gorm.DB, flights []Flight) error {
+	var (
+		classes []FareClass
+		ids     = make([]uint, len(flights))
+		byID    = make(map[uint]*Flight, len(flights))
+	)
+
+	if len(flights) == 0 {
+		return nil
+	}
+
+	for i := range flights {
+		ids[i] = flights[i].ID
+		byID[flights[i].ID] = &flights[i]
+		flights[i].FareClasses = nil
+	}
+
+	if err := db.Where("flight_id IN (?)", ids).Order("fare, code").Find(&classes).Error; err != nil {
+		return err
+	}
+
+	for _, c := range classes {
+		f := byID[c.FlightID]
+		f.FareClasses = append(f.FareClasses, c)
+	}
+
+	return nil
+}
+
+func (s *dbFlightStore) SetStatus(id int, c *StatusChange) (*Flight, error) {
+	var f Flight
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.scoped(tx).Where("id = ?", id).First(&f).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		from := f.Status
+
+		if err := c.apply(&f, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		// Status condition rejects concurrent change made since flight was read
+		result := tx.Model(&Flight{}).Where("id = ? AND status = ?", id, from).Updates(map[string]interface{}{
+			"status":              f.Status,
+			"estimated_departure": f.EstimatedDeparture,
+			"actual_departure":    f.ActualDeparture,
+			"actual_arrival":      f.ActualArrival,
+			"updated_by":          f.UpdatedBy,
+			"version":             gorm.Expr("version + 1"),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrStatusChanged
+		}
+
+		f.Version++
+
+		c.ID = 0
+		return tx.Create(c).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	flights := []Flight{f}
+
+	if err = loadFareClasses(s.db, flights); err != nil {
+		return nil, err
+	}
+
+	return &flights[0], nil
+}
+
+func (s *dbFlightStore) History(id int) ([]StatusChange, error) {
+	history := []StatusChange{}
+
+	err := s.db.Where("flight_id = ?", id).Order("id").Find(&history).Error
+
+	return history, err
+}
+
+func (s *dbFlightStore) Get(id int) (*Flight, error) {
+	var f Flight
+
+	if err := s.scoped(s.db).Where("id = ?", id).First(&f).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	flights := []Flight{f}
+
+	if err := loadFareClasses(s.db, flights); err != nil {
+		return nil, err
+	}
+
+	return &flights[0], nil
+}
+
+func (s *dbFlightStore) Find(search Search) (FlightPage, error) {
+	var (
+		flights []Flight
+		result  FlightPage
+		err     error
+	)
+
+	q := s.scoped(s.db)
+
+	switch search.Deleted {
+	case DeletedInclude:
+		q = s.scoped(s.db.Unscoped())
+	case DeletedOnly:
+		q = s.scoped(s.db.Unscoped()).Where("deleted_at IS NOT NULL")
+	}
+
+	if len(search.Names) != 0 {
+		q = q.Where("name IN (?)", search.Names)
+	}
+	if len(search.Numbers) != 0 {
+		q = q.Where("number IN (?)", search.Numbers)
+	}
+	if search.NumberPrefix != "" {
+		q = q.Where("UPPER(number) LIKE ? ESCAPE '\\'", escapeLike(strings.ToUpper(search.NumberPrefix))+"%")
+	}
+	if len(search.Destinations) != 0 {
+		lower := make([]string, len(search.Destinations))
+		for i, d := range search.Destinations {
+			lower[i] = strings.ToLower(d)
+		}
+		q = q.Where("LOWER(destination) IN (?)", lower)
+	}
+	if len(search.Statuses) != 0 {
+		q = q.Where("status IN (?)", search.Statuses)
+	}
+	if len(search.Schedules) != 0 {
+		q = q.Where("schedule_id IN (?)", search.Schedules)
+	}
+	if len(search.OriginAirports) != 0 {
+		q = q.Where("origin_airport_id IN (?)", search.OriginAirports)
+	}
+	if len(search.DestinationAirports) != 0 {
+		q = q.Where("destination_airport_id IN (?)", search.DestinationAirports)
+	}
+	if len(search.Owners) != 0 {
+		q = q.Where("created_by IN (?)", search.Owners)
+	}
+	if search.ScheduledFrom != nil {
+		q = q.Where("scheduled >= ?", search.ScheduledFrom.UTC())
+	}
+	if search.ScheduledTo != nil {
+		q = q.Where("scheduled <= ?", search.ScheduledTo.UTC())
+	}
+	if search.DepartureFrom != nil {
+		q = q.Where("departure >= ?", search.DepartureFrom.UTC())
+	}
+	if search.DepartureTo != nil {
+		q = q.Where("departure <= ?", search.DepartureTo.UTC())
+	}
+	if search.FareCurrency != "" {
+		q = q.Where("currency = ?", search.FareCurrency)
+	}
+	if search.FareMin != nil {
+		q = q.Where("fare >= ?", *search.FareMin)
+	}
+	if search.FareMax != nil {
+		q = q.Where("fare <= ?", *search.FareMax)
+	}
+	if search.DurationMin != nil {
+		q = q.Where("duration >= ?", *search.DurationMin)
+	}
+	if search.DurationMax != nil {
+		q = q.Where("duration <= ?", *search.DurationMax)
+	}
+
+	if search.After == nil {
+		var total int
+
+		if err = q.Count(&total).Error; err != nil {
+			return result, err
+		}
+
+		result.Total = &total
+	}
+
+	col, dir, op := search.sort(), "ASC", ">"
+	if search.Desc {
+		dir, op = "DESC", "<"
+	}
+
+	if c := search.After; c != nil {
+		if col == SortID {
+			q = q.Where("id "+op+" ?", c.ID)
+		} else {
+			q = q.Where(col+" "+op+" ? OR ("+col+" = ? AND id "+op+" ?)", c.value(), c.value(), c.ID)
+		}
+	}
+
+	if col != SortID {
+		q = q.Order(col + " " + dir)
+	}
+
+	err = q.Order("id " + dir).Limit(search.limit() + 1).Find(&flights).Error
+	if err != nil {
+		return result, err
+	}
+
+	page := search.page(flights)
+	page.Total = result.Total
+
+	if err = loadFareClasses(s.db, page.Flights); err != nil {
+		return result, err
+	}
+
+	return page, nil
+}
+
+// escapeLike escapes LIKE pattern wildcards
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
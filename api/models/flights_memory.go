@@ -0,0 +1,429 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// memFlights are flights of all organizations shared by scoped stores
+type memFlights struct {
+	sync.RWMutex
+	seq        uint
+	flights    map[uint]Flight
+	historySeq uint
+	history    []StatusChange
+	// bookings keep flights with confirmed bookings from deletion
+	bookings *memBookingStore
+}
+
+type memFlightStore struct {
+	*memFlights
+	// org scopes store to organization, 0 is all organizations
+	org uint
+}
+
+func newMemFlightStore() *memFlightStore {
+	return &memFlightStore{memFlights: &memFlights{flights: make(map[uint]Flight)}}
+}
+
+func (s *memFlightStore) Tenant(org uint) FlightStore {
+	return &memFlightStore{memFlights: s.memFlights, org: org}
+}
+
+// owns reports whether flight is visible through the store
+func (s *memFlightStore) owns(f Flight) bool {
+	return s.org == 0 || f.OrganizationID == s.org
+}
+
+// duplicate returns ErrFlightExists if organization has another live flight
+// with the same number scheduled on the same date
+func (s *memFlightStore) duplicate(f *Flight) error {
+	for _, tmp := range s.flights {
+		if tmp.ID != f.ID && tmp.DeletedAt == nil && tmp.OrganizationID == f.OrganizationID &&
+			tmp.Number == f.Number && scheduledDate(tmp.Scheduled).Equal(scheduledDate(f.Scheduled)) {
+			return ErrFlightExists
+		}
+	}
+
+	return nil
+}
+
+func (s *memFlightStore) Create(f *Flight) error {
+	s.Lock()
+	defer s.Unlock()
+
+	f.ID = 0
+	f.resetReadOnly()
+	f.Status = StatusScheduled
+	f.Version = 1
+	f.utc()
+
+	// Same as currency column default
+	if f.Currency == "" {
+		f.Currency = DefaultCurrency
+	}
+
+	if s.org != 0 {
+		f.OrganizationID = s.org
+	} else if f.OrganizationID == 0 {
+		f.OrganizationID = DefaultOrganizationID
+	}
+
+	if err := s.duplicate(f); err != nil {
+		return err
+	}
+
+	s.seq++
+	f.ID = s.seq
+	f.sortFareClasses()
+	s.flights[f.ID] = f.clone()
+
+	return nil
+}
+
+func (s *memFlightStore) Delete(id int, version int, by uint) error {
+	s.Lock()
+	defer s.Unlock()
+
+	f, ok := s.live(id)
+	if !ok {
+		return ErrNotFound
+	}
+	if version != 0 && f.Version != version {
+		return ErrVersionMismatch
+	}
+
+	if s.bookings != nil && s.bookings.confirmed(f.ID) {
+		return ErrFlightBooked
+	}
+
+	now := time.Now().UTC()
+	f.DeletedAt = &now
+	f.DeletedBy = nil
+	if by != 0 {
+		f.DeletedBy = &by
+	}
+	f.Version++
+
+	s.flights[f.ID] = f
+
+	return nil
+}
+
+// live returns flight of store organization, which is not deleted
+func (s *memFlightStore) live(id int) (Flight, bool) {
+	f, ok := s.flights[uint(id)]
+	return f, ok && f.DeletedAt == nil && s.owns(f)
+}
+
+func (s *memFlightStore) Restore(id int) (*Flight, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	f, ok := s.flights[uint(id)]
+	if !ok || !s.owns(f) {
+		return nil, ErrNotFound
+	}
+	if f.DeletedAt == nil {
+		return nil, ErrFlightNotDeleted
+	}
+
+	// Number could be taken since flight was deleted
+	if err := s.duplicate(&f); err != nil {
+		return nil, err
+	}
+
+	f.DeletedAt, f.DeletedBy = nil, nil
+	f.Version++
+
+	s.flights[f.ID] = f
+	f = f.clone()
+
+	return &f, nil
+}
+
+func (s *memFlightStore) Purge(id int, version int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	f, ok := s.flights[uint(id)]
+	if !ok || !s.owns(f) {
+		return ErrNotFound
+	}
+	if f.Version != version {
+		return ErrVersionMismatch
+	}
+
+	delete(s.flights, f.ID)
+
+	return nil
+}
+
+func (s *memFlightStore) PurgeDeleted(before time.Time) ([]Flight, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var purged []Flight
+
+	for id, f := range s.flights {
+		if f.DeletedAt != nil && f.DeletedAt.Before(before) && s.owns(f) {
+			delete(s.flights, id)
+			purged = append(purged, f.clone())
+		}
+	}
+
+	sort.Slice(purged, func(i, j int) bool { return purged[i].ID < purged[j].ID })
+
+	return purged, nil
+}
+
+// Update mimics gorm Updates(struct) behaviour: only non-zero fields are saved
+func (s *memFlightStore) Update(id int, f *Flight) error {
+	s.Lock()
+	defer s.Unlock()
+
+	f.ID = uint(id)
+	f.resetReadOnly()
+	f.CreatedBy = nil
+	f.OrganizationID = 0
+	f.utc()
+
+	cur, ok := s.live(int(f.ID))
+	if !ok {
+		return ErrNotFound
+	}
+	if f.Version != 0 && cur.Version != f.Version {
+		return ErrVersionMismatch
+	}
+
+	if f.Name != "" {
+		cur.Name = f.Name
+	}
+	if f.Number != "" {
+		cur.Number = f.Number
+	}
+	if !f.Scheduled.IsZero() {
+		cur.Scheduled = f.Scheduled
+	}
+	if !f.Arrival.IsZero() {
+		cur.Arrival = f.Arrival
+	}
+	if !f.Departure.IsZero() {
+		cur.Departure = f.Departure
+	}
+	if f.Destination != "" {
+		cur.Destination = f.Destination
+	}
+	if f.Fare != 0 {
+		cur.Fare = f.Fare
+	}
+	if f.Currency != "" {
+		cur.Currency = f.Currency
+	}
+	if f.FareClasses != nil {
+		f.sortFareClasses()
+		cur.FareClasses = f.clone().FareClasses
+	}
+	if f.Duration != 0 {
+		cur.Duration = f.Duration
+	}
+	if f.OriginAirportID != nil {
+		cur.OriginAirportID = f.OriginAirportID
+	}
+	if f.DestinationAirportID != nil {
+		cur.DestinationAirportID = f.DestinationAirportID
+	}
+	if f.Detached {
+		cur.Detached = true
+	}
+	if f.UpdatedBy != nil {
+		cur.UpdatedBy = f.UpdatedBy
+	}
+
+	if err := s.duplicate(&cur); err != nil {
+		return err
+	}
+
+	cur.Version++
+	f.Version = cur.Version
+
+	s.flights[f.ID] = cur
+
+	return nil
+}
+
+func (s *memFlightStore) Save(f *Flight) error {
+	s.Lock()
+	defer s.Unlock()
+
+	f.utc()
+
+	cur, ok := s.live(int(f.ID))
+	if !ok {
+		return ErrNotFound
+	}
+	if cur.Version != f.Version {
+		return ErrVersionMismatch
+	}
+
+	// Status is changed by SetStatus only
+	f.Status = cur.Status
+	f.EstimatedDeparture = cur.EstimatedDeparture
+	f.ActualDeparture = cur.ActualDeparture
+	f.ActualArrival = cur.ActualArrival
+	f.DeletedAt, f.DeletedBy = nil, nil
+	f.CreatedBy = cur.CreatedBy
+	f.OrganizationID = cur.OrganizationID
+
+	if err := s.duplicate(f); err != nil {
+		return err
+	}
+
+	f.Version++
+	f.sortFareClasses()
+	s.flights[f.ID] = f.clone()
+
+	return nil
+}
+
+func (s *memFlightStore) Get(id int) (*Flight, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	f, ok := s.live(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	f = f.clone()
+
+	return &f, nil
+}
+
+func (s *memFlightStore) SetStatus(id int, c *StatusChange) (*Flight, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	f, ok := s.live(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if err := c.apply(&f, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	f.Version++
+	s.flights[f.ID] = f
+
+	s.historySeq++
+	c.ID = s.historySeq
+	s.history = append(s.history, *c)
+
+	f = f.clone()
+
+	return &f, nil
+}
+
+func (s *memFlightStore) History(id int) ([]StatusChange, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := []StatusChange{}
+
+	for _, c := range s.history {
+		if c.FlightID == uint(id) {
+			result = append(result, c)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *memFlightStore) Find(search Search) (FlightPage, error) {
+	var (
+		result  FlightPage
+		flights []Flight = []Flight{}
+	)
+
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, f := range s.flights {
+		if s.owns(f) && search.matches(f) {
+			flights = append(flights, f.clone())
+		}
+	}
+
+	sort.Slice(flights, func(i, j int) bool {
+		if search.Desc {
+			return search.compare(flights[i], flights[j]) > 0
+		}
+		return search.compare(flights[i], flights[j]) < 0
+	})
+
+	if search.After == nil {
+		total := len(flights)
+		result.Total = &total
+	} else {
+		// Skip everything up to and including cursor position
+		last := Flight{ID: search.After.ID}
+
+		switch search.After.Sort {
+		case SortScheduled:
+			last.Scheduled = search.After.Time
+		case SortFare:
+			last.Fare = search.After.Int
+		case SortDuration:
+			last.Duration = int(search.After.Int)
+		}
+
+		i := sort.Search(len(flights), func(i int) bool {
+			r := search.compare(flights[i], last)
+			if search.Desc {
+				return r < 0
+			}
+			return r > 0
+		})
+
+		flights = flights[i:]
+	}
+
+	if len(flights) > search.limit()+1 {
+		flights = flights[:search.limit()+1]
+	}
+
+	page := search.page(flights)
+	page.Total = result.Total
+
+	return page, nil
+}
+
+// clone copies flight with its fare classes, so stored flights are not
+// changed through returned ones
+func (f Flight) clone() Flight {
+	if len(f.FareClasses) == 0 {
+		f.FareClasses = nil
+		return f
+	}
+
+	f.FareClasses = append([]FareClass{}, f.FareClasses...)
+
+	return f
+}
+
+// sortFareClasses orders fare classes the same way as database store
+func (f *Flight) sortFareClasses() {
+	for i := range f.FareClasses {
+		f.FareClasses[i].ID, f.FareClasses[i].FlightID = 0, f.ID
+	}
+
+	sort.SliceStable(f.FareClasses, func(i, j int) bool {
+		a, b := f.FareClasses[i], f.FareClasses[j]
+		if a.Fare != b.Fare {
+			return a.Fare < b.Fare
+		}
+		return a.Code < b.Code
+	})
+}
@@ -0,0 +1,367 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+const (
+	// DefaultMinConnectionTime is used for airports without own minimum
+	DefaultMinConnectionTime = 45
+	DefaultMaxLayover        = 12 * 60
+	MaxItineraryStops        = 2
+	DefaultItineraryLimit    = 20
+	MaxItineraryLimit        = 100
+)
+
+// Itineraries can be ranked by these fields, ties are broken by another one
+const (
+	RankDuration = "duration"
+	RankFare     = "fare"
+)
+
+// ItinerarySearch describes connections search
+type ItinerarySearch struct {
+	From *Airport
+	To   *Airport
+	// Date is local departure date at origin airport
+	Date time.Time
+	// MaxStops is from 0 (direct flights only) to MaxItineraryStops
+	MaxStops int
+	// MaxLayover is maximum connection time in minutes
+	MaxLayover int
+	Rank       string
+	Limit      int
+	// Currency of itinerary fares, currency of the first flight if empty
+	Currency string
+}
+
+// Itinerary is a direct flight or a chain of connecting flights
+type Itinerary struct {
+	Flights   []Flight  `json:"flights"`
+	Stops     int       `json:"stops"`
+	Departure time.Time `json:"departure"`
+	Arrival   time.Time `json:"arrival"`
+	// Duration is total travel time including connections, in minutes
+	Duration int `json:"duration"`
+	// Fare is a sum of flight fares in minor units of currency, it is nil
+	// if some fare can't be converted to currency
+	Fare     *int64 `json:"fare"`
+	Currency string `json:"currency"`
+}
+
+// ParseItinerarySearch parses itineraries query parameters:
+//
+//	from, to      IATA or ICAO airport codes
+//	date          YYYY-MM-DD local departure date at origin airport
+//	max_stops     from 0 to 2, default 2
+//	max_layover   maximum connection time in minutes, default 720
+//	sort          duration (default) or fare
+//	limit         from 1 to 100, default 20
+//	currency      ISO 4217 currency of fares, it must be in rates table
+func ParseItinerarySearch(q url.Values, airports AirportStore, rates *Rates) (ItinerarySearch, error) {
+	var (
+		s = ItinerarySearch{
+			MaxStops:   MaxItineraryStops,
+			MaxLayover: DefaultMaxLayover,
+			Rank:       RankDuration,
+			Limit:      DefaultItineraryLimit,
+		}
+		v   problem.Validation
+		err error
+	)
+
+	for _, param := range []struct {
+		name    string
+		airport **Airport
+	}{{"from", &s.From}, {"to", &s.To}} {
+		code := strings.TrimSpace(q.Get(param.name))
+		if code == "" {
+			v.Add(param.name, "required", fmt.Sprintf("Please provide %s airport code", param.name))
+			continue
+		}
+
+		*param.airport, err = airports.FindByCode(code)
+		if err == ErrNotFound {
+			v.Add(param.name, "not_found", fmt.Sprintf("Airport '%s' doesn't exist", code))
+			continue
+		}
+		if err != nil {
+			return s, err
+		}
+	}
+
+	v.Check(s.From == nil || s.To == nil || s.From.ID != s.To.ID, "to", "same_airport", "Destination airport must differ from origin airport")
+
+	if s.Date, err = time.Parse(dateLayout, q.Get("date")); err != nil {
+		v.Add("date", "invalid", "Please provide YYYY-MM-DD date")
+	}
+
+	if p := intParam(&v, q, "max_stops"); p != nil {
+		s.MaxStops = *p
+		v.Check(s.MaxStops >= 0 && s.MaxStops <= MaxItineraryStops, "max_stops", "range",
+			fmt.Sprintf("max_stops must be from 0 to %d", MaxItineraryStops))
+	}
+
+	if p := intParam(&v, q, "max_layover"); p != nil {
+		s.MaxLayover = *p
+		v.Check(s.MaxLayover > 0, "max_layover", "range", "max_layover must be positive")
+	}
+
+	if rank := q.Get("sort"); rank != "" {
+		s.Rank = rank
+		v.Check(rank == RankDuration || rank == RankFare, "sort", "invalid", "sort must be duration or fare")
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		s.Limit, err = strconv.Atoi(limit)
+		v.Check(err == nil && s.Limit > 0 && s.Limit <= MaxItineraryLimit, "limit", "invalid",
+			fmt.Sprintf("limit must be an integer from 1 to %d", MaxItineraryLimit))
+	}
+
+	if currency := q.Get("currency"); currency != "" {
+		s.Currency = strings.ToUpper(currency)
+		v.Check(rates.Supports(s.Currency), "currency", "unavailable", fmt.Sprintf("There is no exchange rate for '%s'", currency))
+	}
+
+	return s, v.Err()
+}
+
+// departs returns flight departure time, scheduled time if not set
+func (f *Flight) departs() time.Time {
+	if f.Departure.IsZero() {
+		return f.Scheduled
+	}
+	return f.Departure
+}
+
+// arrives returns flight arrival time, estimated by duration if not set
+func (f *Flight) arrives() time.Time {
+	if f.Arrival.IsZero() {
+		return f.departs().Add(time.Duration(f.Duration) * time.Minute)
+	}
+	return f.Arrival
+}
+
+// minConnection returns minimum connection time at airport
+func (a *Airport) minConnection() time.Duration {
+	if a.MinConnectionTime == 0 {
+		return DefaultMinConnectionTime * time.Minute
+	}
+	return time.Duration(a.MinConnectionTime) * time.Minute
+}
+
+// FindItineraries searches flights graph for direct flights and
+// connections with up to s.MaxStops stops. Connection time at every
+// airport is from its minimum to s.MaxLayover, an airport is never
+// visited twice. Fares in different currencies are converted by rates,
+// itineraries with fares which can't be converted have no total fare.
+func FindItineraries(s ItinerarySearch, flights FlightStore, airports AirportStore, rates *Rates) ([]Itinerary, error) {
+	var (
+		result  []Itinerary
+		layover = time.Duration(s.MaxLayover) * time.Minute
+		start   = time.Date(s.Date.Year(), s.Date.Month(), s.Date.Day(), 0, 0, 0, 0, s.From.Location())
+		end     = start.AddDate(0, 0, 1)
+		// Connections depart within a day after previous arrival at most
+		last = end.Add(time.Duration(s.MaxStops) * (layover + 24*time.Hour))
+	)
+
+	candidates, err := findAll(flights, Search{
+		Statuses:      []FlightStatus{StatusScheduled, StatusDelayed, StatusBoarding},
+		DepartureFrom: &start,
+		DepartureTo:   &last,
+		Sort:          SortScheduled,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Flights by origin airport
+	graph := make(map[uint][]Flight)
+
+	for _, f := range candidates {
+		if f.OriginAirportID != nil && f.DestinationAirportID != nil {
+			graph[*f.OriginAirportID] = append(graph[*f.OriginAirportID], f)
+		}
+	}
+
+	connections := make(map[uint]time.Duration)
+
+	minConnection := func(id uint) (time.Duration, error) {
+		if d, ok := connections[id]; ok {
+			return d, nil
+		}
+
+		a, err := airports.Find(id)
+		if err != nil {
+			return 0, err
+		}
+
+		connections[id] = a.minConnection()
+
+		return connections[id], nil
+	}
+
+	var walk func(path []Flight, visited map[uint]bool) error
+
+	walk = func(path []Flight, visited map[uint]bool) error {
+		prev := path[len(path)-1]
+		at := *prev.DestinationAirportID
+
+		if at == s.To.ID {
+			result = append(result, newItinerary(path, s.Currency, rates))
+
+			return nil
+		}
+
+		if len(path) > s.MaxStops {
+			return nil
+		}
+
+		mct, err := minConnection(at)
+		if err != nil {
+			return err
+		}
+
+		for _, next := range graph[at] {
+			wait := next.departs().Sub(prev.arrives())
+
+			if wait < mct || wait > layover || visited[*next.DestinationAirportID] {
+				continue
+			}
+
+			visited[at] = true
+			err := walk(append(path[:len(path):len(path)], next), visited)
+			delete(visited, at)
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	for _, f := range graph[s.From.ID] {
+		if f.departs().Before(start) || !f.departs().Before(end) {
+			continue
+		}
+
+		if err := walk([]Flight{f}, map[uint]bool{s.From.ID: true}); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].less(&result[j], s.Rank)
+	})
+
+	if len(result) > s.Limit {
+		result = result[:s.Limit]
+	}
+
+	return result, nil
+}
+
+func newItinerary(path []Flight, currency string, rates *Rates) Itinerary {
+	// Flight may be a leg of several itineraries, their flights are
+	// converted to currency separately
+	flights := make([]Flight, len(path))
+	for i, f := range path {
+		flights[i] = f.clone()
+	}
+
+	it := Itinerary{
+		Flights:   flights,
+		Stops:     len(path) - 1,
+		Departure: path[0].departs(),
+		Arrival:   path[len(path)-1].arrives(),
+		Currency:  currency,
+	}
+
+	it.Duration = int(it.Arrival.Sub(it.Departure) / time.Minute)
+
+	if it.Currency == "" {
+		it.Currency = path[0].Currency
+	}
+
+	var total int64
+
+	for _, f := range path {
+		fare, err := rates.Convert(f.Fare, f.Currency, it.Currency)
+		if err != nil {
+			return it
+		}
+
+		total += fare
+	}
+
+	it.Fare = &total
+
+	return it
+}
+
+// less ranks itineraries by duration or fare, then by another one,
+// by number of stops and by departure. Itineraries without fare are
+// the most expensive.
+func (it *Itinerary) less(other *Itinerary, rank string) bool {
+	primary, secondary := int64(it.Duration-other.Duration), compareFares(it.Fare, other.Fare)
+	if rank == RankFare {
+		primary, secondary = secondary, primary
+	}
+
+	switch {
+	case primary != 0:
+		return primary < 0
+	case secondary != 0:
+		return secondary < 0
+	case it.Stops != other.Stops:
+		return it.Stops < other.Stops
+	}
+
+	return it.Departure.Before(other.Departure)
+}
+
+// compareFares returns sign of a - b, nil fare is greater than any other
+func compareFares(a, b *int64) int64 {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return 1
+	case b == nil:
+		return -1
+	}
+
+	return *a - *b
+}
+
+// findAll returns all flights matching search, page by page
+func findAll(flights FlightStore, search Search) ([]Flight, error) {
+	var result []Flight
+
+	search.Limit = MaxSearchLimit
+
+	for {
+		page, err := flights.Find(search)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, page.Flights...)
+
+		if page.NextCursor == "" {
+			return result, nil
+		}
+
+		if search.After, err = ParseCursor(page.NextCursor, search.Sort, search.Desc); err != nil {
+			return nil, err
+		}
+	}
+}
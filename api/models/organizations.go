@@ -0,0 +1,91 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// DefaultOrganizationID is the organization of users and flights created
+// before tenants were introduced. Its admins manage other organizations.
+const DefaultOrganizationID uint = 1
+
+// InvitationTTL is how long invitation can be accepted
+const InvitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrOrganizationExists = problem.Conflict("organization_exists", "organization with this name already exists")
+	ErrInvitationInvalid  = problem.BadRequest("invitation_invalid", "invalid, used or expired invitation")
+	ErrFlightExists       = problem.Conflict("flight_exists", "flight with this number is scheduled on the same date")
+)
+
+// Organization is a tenant, its users see and change its flights and
+// schedules only. Airports are shared by all organizations.
+type Organization struct {
+	ID        uint      `gorm:"primary_key" json:"id"`
+	Name      string    `json:"name" gorm:"type:varchar(255);unique"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Invitation lets user register in organization with the role. Only
+// the hash of the token is stored, token itself is returned once.
+type Invitation struct {
+	ID             uint       `gorm:"primary_key" json:"id"`
+	OrganizationID uint       `json:"organization_id"`
+	Role           Role       `json:"role" gorm:"type:varchar(32)"`
+	Token          string     `json:"token,omitempty" gorm:"-"`
+	TokenHash      string     `json:"-" gorm:"type:varchar(64);unique_index"`
+	CreatedBy      uint       `json:"created_by"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at,omitempty"`
+}
+
+// OrganizationStore is implemented by organizations and invitations
+// storage backends
+type OrganizationStore interface {
+	Create(o *Organization) error
+	Find(id uint) (*Organization, error)
+	List() ([]Organization, error)
+	Invite(inv *Invitation) error
+	// Accept atomically marks invitation accepted, it returns
+	// ErrInvitationInvalid if invitation is unknown, used or expired
+	Accept(hash string, at time.Time) (*Invitation, error)
+}
+
+// Validate checks all fields and reports every invalid one
+func (o *Organization) Validate() error {
+	var v problem.Validation
+
+	o.Name = strings.TrimSpace(o.Name)
+
+	v.Check(o.Name != "", "name", "required", "Please provide organization name")
+
+	return v.Err()
+}
+
+// NewInvitation returns invitation to organization with a new token
+func NewInvitation(org uint, role Role, by uint) (*Invitation, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	return &Invitation{
+		OrganizationID: org,
+		Role:           role,
+		Token:          token,
+		TokenHash:      hashToken(token),
+		CreatedBy:      by,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(InvitationTTL),
+	}, nil
+}
+
+// AcceptInvitation consumes invitation token
+func AcceptInvitation(s OrganizationStore, token string) (*Invitation, error) {
+	return s.Accept(hashToken(token), time.Now().UTC())
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type dbOrganizationStore struct {
+	db *gorm.DB
+}
+
+func (s *dbOrganizationStore) Create(o *Organization) error {
+	var count int
+
+	if err := s.db.Model(&Organization{}).Where("name = ?", o.Name).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return ErrOrganizationExists
+	}
+
+	o.ID = 0
+
+	return s.db.Create(o).Error
+}
+
+func (s *dbOrganizationStore) Find(id uint) (*Organization, error) {
+	var o Organization
+
+	if err := s.db.First(&o, id).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &o, nil
+}
+
+func (s *dbOrganizationStore) List() ([]Organization, error) {
+	result := []Organization{}
+
+	err := s.db.Order("id").Find(&result).Error
+
+	return result, err
+}
+
+func (s *dbOrganizationStore) Invite(inv *Invitation) error {
+	inv.ID = 0
+	return s.db.Create(inv).Error
+}
+
+func (s *dbOrganizationStore) Accept(hash string, at time.Time) (*Invitation, error) {
+	var inv Invitation
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("token_hash = ?", hash).First(&inv).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return ErrInvitationInvalid
+			}
+			return err
+		}
+
+		if at.After(inv.ExpiresAt) {
+			return ErrInvitationInvalid
+		}
+
+		// Condition rejects invitation accepted concurrently
+		result := tx.Model(&Invitation{}).Where("id = ? AND accepted_at IS NULL", inv.ID).Update("accepted_at", at)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrInvitationInvalid
+		}
+
+		inv.AcceptedAt = &at
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &inv, nil
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type memOrganizationStore struct {
+	sync.RWMutex
+	seq           uint
+	organizations map[uint]Organization
+	invitationSeq uint
+	invitations   map[uint]Invitation
+}
+
+// newMemOrganizationStore returns store with default organization, as
+// database gets it from migration
+func newMemOrganizationStore() *memOrganizationStore {
+	s := &memOrganizationStore{
+		seq:           DefaultOrganizationID,
+		organizations: make(map[uint]Organization),
+		invitations:   make(map[uint]Invitation),
+	}
+
+	s.organizations[DefaultOrganizationID] = Organization{
+		ID:        DefaultOrganizationID,
+		Name:      "default",
+		CreatedAt: time.Now().UTC(),
+	}
+
+	return s
+}
+
+func (s *memOrganizationStore) Create(o *Organization) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, tmp := range s.organizations {
+		if tmp.Name == o.Name {
+			return ErrOrganizationExists
+		}
+	}
+
+	s.seq++
+	o.ID = s.seq
+	o.CreatedAt = time.Now().UTC()
+	s.organizations[o.ID] = *o
+
+	return nil
+}
+
+func (s *memOrganizationStore) Find(id uint) (*Organization, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	o, ok := s.organizations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &o, nil
+}
+
+func (s *memOrganizationStore) List() ([]Organization, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := make([]Organization, 0, len(s.organizations))
+	for _, o := range s.organizations {
+		result = append(result, o)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+func (s *memOrganizationStore) Invite(inv *Invitation) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.invitationSeq++
+	inv.ID = s.invitationSeq
+
+	stored := *inv
+	stored.Token = ""
+	s.invitations[inv.ID] = stored
+
+	return nil
+}
+
+func (s *memOrganizationStore) Accept(hash string, at time.Time) (*Invitation, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, inv := range s.invitations {
+		if inv.TokenHash != hash {
+			continue
+		}
+
+		if inv.AcceptedAt != nil || at.After(inv.ExpiresAt) {
+			return nil, ErrInvitationInvalid
+		}
+
+		inv.AcceptedAt = &at
+		s.invitations[id] = inv
+
+		return &inv, nil
+	}
+
+	return nil, ErrInvitationInvalid
+}
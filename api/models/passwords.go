@@ -0,0 +1,259 @@
+package models
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// Password hashing algorithms
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// bcrypt ignores password bytes after the 72nd, longer passwords are
+// rejected for any algorithm, so hashes can be migrated back to bcrypt
+const maxPasswordBytes = 72
+
+const (
+	argon2SaltSize = 16
+	argon2KeySize  = 32
+)
+
+// Hasher hashes new passwords, it is configured on start. Hashes made
+// with other algorithm or parameters are replaced on login.
+var Hasher = PasswordHasher{Algorithm: AlgorithmBcrypt, Cost: bcrypt.DefaultCost}
+
+// Policy is checked for new passwords, it is configured on start
+var Policy = PasswordPolicy{MinLength: 8}
+
+// PasswordHasher is a password hashing algorithm with its parameters.
+// Cost is used by bcrypt, Time, Memory (KiB) and Threads by argon2id.
+type PasswordHasher struct {
+	Algorithm string
+	Cost      int
+	Time      uint32
+	Memory    uint32
+	Threads   uint8
+}
+
+// ParsePasswordHasher parses algorithm with optional parameters:
+//
+//	bcrypt
+//	bcrypt,cost=12
+//	argon2id,m=19456,t=2,p=1
+//
+// Omitted parameters get default values.
+func ParsePasswordHasher(spec string) (PasswordHasher, error) {
+	var (
+		parts = strings.Split(spec, ",")
+		h     = PasswordHasher{Algorithm: strings.TrimSpace(parts[0])}
+	)
+
+	switch h.Algorithm {
+	case AlgorithmBcrypt:
+		h.Cost = bcrypt.DefaultCost
+	case AlgorithmArgon2id:
+		// OWASP recommended minimum
+		h.Time, h.Memory, h.Threads = 2, 19*1024, 1
+	default:
+		return h, fmt.Errorf("unsupported password hashing algorithm '%s', expected bcrypt or argon2id", h.Algorithm)
+	}
+
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) != 2 {
+			return h, fmt.Errorf("malformed %s parameter '%s'", h.Algorithm, param)
+		}
+
+		value, err := strconv.ParseUint(kv[1], 10, 32)
+		if err != nil || value == 0 {
+			return h, fmt.Errorf("%s parameter %s must be a positive integer", h.Algorithm, kv[0])
+		}
+
+		switch key := h.Algorithm + ":" + kv[0]; key {
+		case "bcrypt:cost":
+			h.Cost = int(value)
+		case "argon2id:t":
+			h.Time = uint32(value)
+		case "argon2id:m":
+			h.Memory = uint32(value)
+		case "argon2id:p":
+			if value > 255 {
+				return h, fmt.Errorf("argon2id parameter p must be at most 255")
+			}
+			h.Threads = uint8(value)
+		default:
+			return h, fmt.Errorf("unknown %s parameter '%s'", h.Algorithm, kv[0])
+		}
+	}
+
+	if h.Algorithm == AlgorithmBcrypt && (h.Cost < bcrypt.MinCost || h.Cost > bcrypt.MaxCost) {
+		return h, fmt.Errorf("bcrypt cost must be from %d to %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+
+	return h, nil
+}
+
+// Hash returns hash of password in bcrypt or PHC string format
+func (h PasswordHasher) Hash(password string) (string, error) {
+	if h.Algorithm == AlgorithmArgon2id {
+		salt := make([]byte, argon2SaltSize)
+
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+
+		key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, argon2KeySize)
+
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	enc, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+
+	return string(enc), err
+}
+
+// NeedsRehash reports whether hash is made by other algorithm or with
+// other parameters than configured ones
+func (h PasswordHasher) NeedsRehash(hash string) bool {
+	if h.Algorithm == AlgorithmArgon2id {
+		params, _, _, err := parseArgon2(hash)
+		return err != nil || params != h
+	}
+
+	cost, err := bcrypt.Cost([]byte(hash))
+
+	return err != nil || cost != h.Cost
+}
+
+// VerifyPassword checks password against hash made by any supported
+// algorithm
+func VerifyPassword(hash string, password string) bool {
+	if !strings.HasPrefix(hash, "$"+AlgorithmArgon2id+"$") {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+
+	params, salt, key, err := parseArgon2(hash)
+	if err != nil {
+		return false
+	}
+
+	computed := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, computed) == 1
+}
+
+// parseArgon2 parses argon2id hash in PHC string format
+func parseArgon2(hash string) (PasswordHasher, []byte, []byte, error) {
+	var (
+		h       = PasswordHasher{Algorithm: AlgorithmArgon2id}
+		version int
+		threads uint32
+	)
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return h, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.Memory, &h.Time, &threads); err != nil || threads == 0 || threads > 255 {
+		return h, nil, nil, fmt.Errorf("malformed argon2id parameters")
+	}
+
+	h.Threads = uint8(threads)
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return h, nil, nil, err
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return h, nil, nil, fmt.Errorf("malformed argon2id key")
+	}
+
+	return h, salt, key, nil
+}
+
+// PasswordPolicy is a set of rules for new passwords. Classes is a number
+// of character classes (lower and upper case letters, digits and other
+// characters) password must contain. Passwords from DenyList are rejected
+// case insensitive.
+type PasswordPolicy struct {
+	MinLength int
+	Classes   int
+	DenyList  map[string]bool
+}
+
+// LoadDenyList reads passwords deny-list, one password per line, lines
+// starting with # are skipped
+func LoadDenyList(r io.Reader) (map[string]bool, error) {
+	result := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line != "" && !strings.HasPrefix(line, "#") {
+			result[strings.ToLower(line)] = true
+		}
+	}
+
+	return result, scanner.Err()
+}
+
+// Check records violations of policy by password of user with name as
+// invalid field
+func (p *PasswordPolicy) Check(v *problem.Validation, field string, name string, password string) {
+	if password == "" {
+		return
+	}
+
+	v.Check(utf8.RuneCountInString(password) >= p.MinLength, field, "too_short",
+		fmt.Sprintf("Password must be at least %d characters long", p.MinLength))
+	v.Check(len(password) <= maxPasswordBytes, field, "too_long",
+		fmt.Sprintf("Password must be at most %d bytes long", maxPasswordBytes))
+	v.Check(passwordClasses(password) >= p.Classes, field, "too_simple",
+		fmt.Sprintf("Password must contain %d of lower case letters, upper case letters, digits and other characters", p.Classes))
+	v.Check(!p.DenyList[strings.ToLower(password)], field, "too_common", "Password is too common")
+	v.Check(!strings.EqualFold(password, name), field, "same_as_name", "Password must differ from username")
+}
+
+// passwordClasses returns number of character classes in password
+func passwordClasses(password string) int {
+	var lower, upper, digit, other int
+
+	for _, c := range password {
+		switch {
+		case unicode.IsLower(c):
+			lower = 1
+		case unicode.IsUpper(c):
+			upper = 1
+		case unicode.IsDigit(c):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	return lower + upper + digit + other
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"fmt"
+)
+
+// Role defines what user is allowed to do. Every role includes
+// permissions of roles below it: admin > operator > viewer.
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var roleRanks = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+func ParseRole(s string) (Role, error) {
+	if _, ok := roleRanks[Role(s)]; !ok {
+		return "", fmt.Errorf("unknown role '%s', expected viewer, operator or admin", s)
+	}
+
+	return Role(s), nil
+}
+
+// Includes reports whether r grants permissions of other role
+func (r Role) Includes(other Role) bool {
+	rank, ok := roleRanks[r]
+	if !ok {
+		return false
+	}
+
+	return rank >= roleRanks[other]
+}
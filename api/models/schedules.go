@@ -0,0 +1,377 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// DefaultScheduleHorizon is how far ahead schedules materialize flights
+const DefaultScheduleHorizon = 60 * 24 * time.Hour
+
+// ErrNotScheduleOwner is returned when user changes schedule owned by another user
+var ErrNotScheduleOwner = problem.Forbidden("not_schedule_owner", "schedule is owned by another user")
+
+// Days is a days of week bitmask, Monday is bit 0 and Sunday is bit 6
+type Days uint8
+
+const (
+	Monday Days = 1 << iota
+	Tuesday
+	Wednesday
+	Thursday
+	Friday
+	Saturday
+	Sunday
+
+	EveryDay = Monday | Tuesday | Wednesday | Thursday | Friday | Saturday | Sunday
+)
+
+// Has reports whether weekday is in the mask
+func (d Days) Has(wd time.Weekday) bool {
+	return d&(1<<((uint(wd)+6)%7)) != 0
+}
+
+// DateList is a list of YYYY-MM-DD dates, stored as comma separated text
+type DateList []string
+
+func (l DateList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+func (l *DateList) Scan(value interface{}) error {
+	var s string
+
+	switch v := value.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("can't scan %T into DateList", value)
+	}
+
+	*l = DateList{}
+	if s != "" {
+		*l = strings.Split(s, ",")
+	}
+
+	return nil
+}
+
+func (l DateList) contains(date string) bool {
+	for _, d := range l {
+		if d == date {
+			return true
+		}
+	}
+	return false
+}
+
+// Schedule is a recurring flight. Departure time is local time of origin
+// airport, validity dates are inclusive, exceptions are dates without flight.
+type Schedule struct {
+	ID                   uint     `gorm:"primary_key"`
+	OrganizationID       uint     `json:"organization_id"`
+	Name                 string   `json:"name" gorm:"type:varchar(255)"`
+	Number               string   `json:"number" gorm:"type:varchar(255)"`
+	OriginAirportID      uint     `json:"origin_airport_id"`
+	DestinationAirportID uint     `json:"destination_airport_id"`
+	Days                 Days     `json:"days"`
+	DepartureTime        string   `json:"departure_time" gorm:"type:varchar(5)"`
+	Duration             int      `json:"duration"`
+	Fare                 int64    `json:"fare"`
+	Currency             string   `json:"currency" gorm:"type:varchar(3)"`
+	ValidFrom            string   `json:"valid_from" gorm:"type:varchar(10)"`
+	ValidTo              string   `json:"valid_to,omitempty" gorm:"type:varchar(10)"`
+	Exceptions           DateList `json:"exceptions" gorm:"type:text"`
+	// CreatedBy owns schedule and its flights, it's nil for schedules
+	// created before ownership was recorded
+	CreatedBy *uint `json:"created_by,omitempty"`
+}
+
+// ScheduleStore is implemented by schedules storage backends
+type ScheduleStore interface {
+	// Tenant returns store scoped to schedules of organization, store of
+	// organization 0 is not scoped
+	Tenant(org uint) ScheduleStore
+	// Create adds schedule to organization of scoped store
+	Create(s *Schedule) error
+	// Update replaces schedule, organization and owner are kept
+	Update(id uint, s *Schedule) error
+	Delete(id uint) error
+	Find(id uint) (*Schedule, error)
+	List() ([]Schedule, error)
+}
+
+// Validate checks all fields and referenced airports
+func (s *Schedule) Validate(airports AirportStore) error {
+	var v problem.Validation
+
+	v.Check(s.Name != "", "name", "required", "Please provide flight name")
+	v.Check(s.Number != "", "number", "required", "Please provide flight number")
+	v.Check(s.Days != 0, "days", "required", "Please provide days of week")
+	v.Check(s.Days&^EveryDay == 0, "days", "invalid", "Days must be a bitmask from 1 to 127, Monday is 1")
+	v.Check(s.Duration > 0, "duration", "required", "Please provide esimated flight duration")
+	v.Check(s.Fare > 0, "fare", "required", "Please provide flight fare")
+
+	if s.Currency = strings.ToUpper(strings.TrimSpace(s.Currency)); s.Currency == "" {
+		s.Currency = DefaultCurrency
+	}
+
+	v.Check(ValidCurrency(s.Currency), "currency", "invalid", "Currency must be a supported ISO 4217 code")
+
+	if _, err := time.Parse("15:04", s.DepartureTime); err != nil {
+		v.Add("departure_time", "invalid", "Departure time must be local HH:MM time")
+	}
+
+	from, err := time.Parse(dateLayout, s.ValidFrom)
+	if err != nil {
+		v.Add("valid_from", "invalid", "Please provide YYYY-MM-DD date")
+	}
+
+	if s.ValidTo != "" {
+		to, err := time.Parse(dateLayout, s.ValidTo)
+		v.Check(err == nil, "valid_to", "invalid", "valid_to must be YYYY-MM-DD date")
+		v.Check(err != nil || to.After(from) || to.Equal(from), "valid_to", "range", "valid_to must not be before valid_from")
+	}
+
+	for _, d := range s.Exceptions {
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			v.Add("exceptions", "invalid", fmt.Sprintf("Exception '%s' must be YYYY-MM-DD date", d))
+			break
+		}
+	}
+
+	f := Flight{OriginAirportID: &s.OriginAirportID, DestinationAirportID: &s.DestinationAirportID}
+
+	v.Check(s.OriginAirportID != 0, "origin_airport_id", "required", "Please provide origin airport")
+	v.Check(s.DestinationAirportID != 0, "destination_airport_id", "required", "Please provide destination airport")
+
+	if s.OriginAirportID != 0 && s.DestinationAirportID != 0 {
+		if err := v.Merge(f.ValidateAirports(airports)); err != nil {
+			return err
+		}
+	}
+
+	return v.Err()
+}
+
+// CanModify reports whether user may change schedule, same as flight
+func (s *Schedule) CanModify(userID uint, role Role) bool {
+	return s.CreatedBy == nil || *s.CreatedBy == userID || role.Includes(RoleAdmin)
+}
+
+// flies reports whether schedule has flight on local date
+func (s *Schedule) flies(date time.Time) bool {
+	day := date.Format(dateLayout)
+
+	return s.Days.Has(date.Weekday()) &&
+		day >= s.ValidFrom &&
+		(s.ValidTo == "" || day <= s.ValidTo) &&
+		!s.Exceptions.contains(day)
+}
+
+// Departures returns departures from now to now + horizon by local dates
+// of origin airport time zone
+func (s *Schedule) Departures(loc *time.Location, now time.Time, horizon time.Duration) map[string]time.Time {
+	result := make(map[string]time.Time)
+
+	clock, err := time.Parse("15:04", s.DepartureTime)
+	if err != nil {
+		return result
+	}
+
+	end := now.Add(horizon)
+	local := now.In(loc)
+
+	for date := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.UTC); ; date = date.AddDate(0, 0, 1) {
+		dep := time.Date(date.Year(), date.Month(), date.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		if dep.After(end) {
+			break
+		}
+
+		if dep.After(now) && s.flies(date) {
+			result[date.Format(dateLayout)] = dep.UTC()
+		}
+	}
+
+	return result
+}
+
+// instance returns flight materialized for local date, it's owned by
+// schedule owner
+func (s *Schedule) instance(date string, dep time.Time, destination *Airport) Flight {
+	id, origin, dest := s.ID, s.OriginAirportID, s.DestinationAirportID
+
+	var owner *uint
+	if s.CreatedBy != nil {
+		uid := *s.CreatedBy
+		owner = &uid
+	}
+
+	return Flight{
+		OrganizationID:       s.OrganizationID,
+		Name:                 s.Name,
+		Number:               s.Number,
+		Scheduled:            dep,
+		Departure:            dep,
+		Arrival:              dep.Add(time.Duration(s.Duration) * time.Minute),
+		Destination:          destination.City,
+		Fare:                 s.Fare,
+		Currency:             s.Currency,
+		Duration:             s.Duration,
+		OriginAirportID:      &origin,
+		DestinationAirportID: &dest,
+		ScheduleID:           &id,
+		ScheduleDate:         date,
+		CreatedBy:            owner,
+	}
+}
+
+// GenerateResult counts flights changed by schedule generator
+type GenerateResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+	// Kept are instances, which differ from schedule, but were edited
+	// manually, are not scheduled anymore or have bookings
+	Kept int `json:"kept"`
+}
+
+// generateMu serializes generators, so concurrent runs don't create
+// the same instance twice
+var generateMu sync.Mutex
+
+// GenerateFlights materializes schedule flights departing from now to
+// now + horizon. It's idempotent: existing instances are updated to match
+// schedule, instances of dates not flown anymore are removed. Instances
+// edited manually, with changed status or confirmed bookings are kept
+// as is. Past flights are never changed. Changes are recorded to audit
+// log without actor.
+func GenerateFlights(sc *Schedule, s *Stores, now time.Time, horizon time.Duration) (GenerateResult, error) {
+	var result GenerateResult
+
+	generateMu.Lock()
+	defer generateMu.Unlock()
+
+	origin, err := s.Airports.Find(sc.OriginAirportID)
+	if err != nil {
+		return result, err
+	}
+
+	destination, err := s.Airports.Find(sc.DestinationAirportID)
+	if err != nil {
+		return result, err
+	}
+
+	existing, err := scheduleInstances(s.Flights, sc.ID, now)
+	if err != nil {
+		return result, err
+	}
+
+	for date, dep := range sc.Departures(origin.Location(), now, horizon) {
+		f := sc.instance(date, dep, destination)
+
+		cur, ok := existing[date]
+		if !ok {
+			if err = s.Flights.Create(&f); err != nil {
+				return result, err
+			}
+			if err = AppendAudit(s.Audit, f.OrganizationID, nil, "", AuditCreate, AuditFlight, f.ID, nil, &f); err != nil {
+				return result, err
+			}
+			result.Created++
+			continue
+		}
+
+		delete(existing, date)
+
+		if cur.sameInstance(&f) {
+			continue
+		}
+
+		if cur.Detached || cur.Status != StatusScheduled || cur.DeletedAt != nil {
+			result.Kept++
+			continue
+		}
+
+		// Flight edited since it was read is kept as well
+		f.Version = cur.Version
+
+		err = s.Flights.Update(int(cur.ID), &f)
+		if err == ErrNotFound {
+			continue
+		}
+		if err == ErrVersionMismatch {
+			result.Kept++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+
+		updated, err := s.Flights.Get(int(cur.ID))
+		if err != nil {
+			return result, err
+		}
+		if err = AppendAudit(s.Audit, cur.OrganizationID, nil, "", AuditUpdate, AuditFlight, cur.ID, &cur, updated); err != nil {
+			return result, err
+		}
+		result.Updated++
+	}
+
+	for _, cur := range existing {
+		if cur.Detached || cur.Status != StatusScheduled || cur.DeletedAt != nil {
+			result.Kept++
+			continue
+		}
+
+		booked, err := s.Bookings.List(BookingFilter{FlightID: cur.ID, Status: BookingConfirmed})
+		if err != nil {
+			return result, err
+		}
+
+		if len(booked) != 0 {
+			result.Kept++
+			continue
+		}
+
+		if err = s.Flights.Purge(int(cur.ID), cur.Version); err == ErrNotFound {
+			continue
+		}
+		if err == ErrVersionMismatch {
+			result.Kept++
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		if err = AppendAudit(s.Audit, cur.OrganizationID, nil, "", AuditDelete, AuditFlight, cur.ID, &cur, nil); err != nil {
+			return result, err
+		}
+		result.Deleted++
+	}
+
+	return result, nil
+}
+
+// scheduleInstances returns future schedule flights by schedule date
+func scheduleInstances(flights FlightStore, scheduleID uint, now time.Time) (map[string]Flight, error) {
+	instances, err := findAll(flights, Search{Schedules: []uint{scheduleID}, DepartureFrom: &now, Deleted: DeletedInclude})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]Flight, len(instances))
+	for _, f := range instances {
+		result[f.ScheduleDate] = f
+	}
+
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"github.com/jinzhu/gorm"
+)
+
+type dbScheduleStore struct {
+	db *gorm.DB
+	// org scopes all queries to organization, 0 is all organizations
+	org uint
+}
+
+func (s *dbScheduleStore) Tenant(org uint) ScheduleStore {
+	return &dbScheduleStore{db: s.db, org: org}
+}
+
+// scoped returns schedules query restricted to store organization
+func (s *dbScheduleStore) scoped() *gorm.DB {
+	q := s.db.Model(&Schedule{})
+
+	if s.org != 0 {
+		q = q.Where("organization_id = ?", s.org)
+	}
+
+	return q
+}
+
+func (s *dbScheduleStore) Create(sc *Schedule) error {
+	sc.ID = 0
+
+	if s.org != 0 {
+		sc.OrganizationID = s.org
+	} else if sc.OrganizationID == 0 {
+		sc.OrganizationID = DefaultOrganizationID
+	}
+
+	return s.db.Create(sc).Error
+}
+
+func (s *dbScheduleStore) Update(id uint, sc *Schedule) error {
+	cur, err := s.Find(id)
+	if err != nil {
+		return err
+	}
+
+	sc.ID = id
+	sc.OrganizationID, sc.CreatedBy = cur.OrganizationID, cur.CreatedBy
+
+	return s.db.Save(sc).Error
+}
+
+// Delete removes schedule, its remaining flights are kept without schedule
+func (s *dbScheduleStore) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		store := &dbScheduleStore{db: tx, org: s.org}
+
+		result := store.scoped().Where("id = ?", id).Delete(&Schedule{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		// Same as ON DELETE SET NULL, which SQLite applies only with
+		// foreign keys enabled
+		return tx.Table("flights").Where("schedule_id = ?", id).UpdateColumn("schedule_id", nil).Error
+	})
+}
+
+func (s *dbScheduleStore) Find(id uint) (*Schedule, error) {
+	var sc Schedule
+
+	if err := s.scoped().Where("id = ?", id).First(&sc).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+func (s *dbScheduleStore) List() ([]Schedule, error) {
+	schedules := []Schedule{}
+
+	err := s.scoped().Order("id").Find(&schedules).Error
+
+	return schedules, err
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"sort"
+	"sync"
+)
+
+// memSchedules are schedules of all organizations shared by scoped stores
+type memSchedules struct {
+	sync.RWMutex
+	seq       uint
+	schedules map[uint]Schedule
+	// flights are cleared of deleted schedules
+	flights *memFlights
+}
+
+type memScheduleStore struct {
+	*memSchedules
+	// org scopes store to organization, 0 is all organizations
+	org uint
+}
+
+func newMemScheduleStore(flights *memFlights) *memScheduleStore {
+	return &memScheduleStore{memSchedules: &memSchedules{schedules: make(map[uint]Schedule), flights: flights}}
+}
+
+func (s *memScheduleStore) Tenant(org uint) ScheduleStore {
+	return &memScheduleStore{memSchedules: s.memSchedules, org: org}
+}
+
+// find returns schedule of store organization
+func (s *memScheduleStore) find(id uint) (Schedule, bool) {
+	sc, ok := s.schedules[id]
+	return sc, ok && (s.org == 0 || sc.OrganizationID == s.org)
+}
+
+func (s *memScheduleStore) Create(sc *Schedule) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.org != 0 {
+		sc.OrganizationID = s.org
+	} else if sc.OrganizationID == 0 {
+		sc.OrganizationID = DefaultOrganizationID
+	}
+
+	s.seq++
+	sc.ID = s.seq
+	s.schedules[sc.ID] = *sc
+
+	return nil
+}
+
+func (s *memScheduleStore) Update(id uint, sc *Schedule) error {
+	s.Lock()
+	defer s.Unlock()
+
+	cur, ok := s.find(id)
+	if !ok {
+		return ErrNotFound
+	}
+
+	sc.ID = id
+	sc.OrganizationID, sc.CreatedBy = cur.OrganizationID, cur.CreatedBy
+	s.schedules[id] = *sc
+
+	return nil
+}
+
+// Delete removes schedule, its remaining flights are kept without schedule
+func (s *memScheduleStore) Delete(id uint) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.find(id); !ok {
+		return ErrNotFound
+	}
+
+	delete(s.schedules, id)
+
+	s.flights.Lock()
+	defer s.flights.Unlock()
+
+	for fid, f := range s.flights.flights {
+		if f.ScheduleID != nil && *f.ScheduleID == id {
+			f.ScheduleID = nil
+			s.flights.flights[fid] = f
+		}
+	}
+
+	return nil
+}
+
+func (s *memScheduleStore) Find(id uint) (*Schedule, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	sc, ok := s.find(id)
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &sc, nil
+}
+
+func (s *memScheduleStore) List() ([]Schedule, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := make([]Schedule, 0, len(s.schedules))
+	for _, sc := range s.schedules {
+		if s.org == 0 || sc.OrganizationID == s.org {
+			result = append(result, sc)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
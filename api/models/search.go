@@ -0,0 +1,326 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// Flights can be sorted by these fields, ties are broken by id
+const (
+	SortID        = "id"
+	SortScheduled = "scheduled"
+	SortFare      = "fare"
+	SortDuration  = "duration"
+)
+
+// Deleted flights filter, deleted flights are excluded by default
+const (
+	DeletedInclude = "include"
+	DeletedOnly    = "only"
+)
+
+var sortFields = map[string]bool{
+	SortID:        true,
+	SortScheduled: true,
+	SortFare:      true,
+	SortDuration:  true,
+}
+
+// Search describes flights filter, order and page. All filters are combined
+// with AND, list filters match any of values.
+type Search struct {
+	Names        []string
+	Numbers      []string
+	NumberPrefix string
+	// Destinations are matched case insensitive
+	Destinations []string
+	Statuses     []FlightStatus
+	Schedules    []uint
+	// Airport filters match flights referencing any of airports
+	OriginAirports      []uint
+	DestinationAirports []uint
+	// Owners match flights created by any of users
+	Owners []uint
+	// Deleted is empty, DeletedInclude or DeletedOnly
+	Deleted string
+
+	// Time bounds are inclusive, nil means unbounded
+	ScheduledFrom *time.Time
+	ScheduledTo   *time.Time
+	DepartureFrom *time.Time
+	DepartureTo   *time.Time
+
+	// Fare bounds are in minor units of FareCurrency
+	FareMin *int64
+	FareMax *int64
+	// FareCurrency restricts flights to ones priced in it, so fare bounds
+	// and fare order compare amounts of the same currency
+	FareCurrency string
+	DurationMin  *int
+	DurationMax  *int
+
+	Sort  string
+	Desc  bool
+	Limit int
+	// After is a position of the last flight of the previous page
+	After *Cursor
+}
+
+// FlightPage is a single page of search results
+type FlightPage struct {
+	Flights []Flight
+	// NextCursor is empty on the last page
+	NextCursor string
+	// Total is a number of all matching flights, it is counted
+	// for the first page only
+	Total *int
+}
+
+// Cursor is an opaque position in sorted search results
+type Cursor struct {
+	Sort string    `json:"s"`
+	Desc bool      `json:"d,omitempty"`
+	ID   uint      `json:"id"`
+	Time time.Time `json:"t,omitempty"`
+	Int  int64     `json:"i,omitempty"`
+}
+
+// ParseSort parses "field" or "-field" for descending order
+func ParseSort(s string) (string, bool, error) {
+	desc := false
+
+	if len(s) > 0 && s[0] == '-' {
+		desc, s = true, s[1:]
+	}
+
+	if s == "" {
+		s = SortID
+	}
+
+	if !sortFields[s] {
+		return "", false, fmt.Errorf("unknown sort field '%s', expected scheduled, fare or duration", s)
+	}
+
+	return s, desc, nil
+}
+
+// ParseCursor decodes cursor and checks it was issued for the same sort order
+func ParseCursor(s string, sort string, desc bool) (*Cursor, error) {
+	var c Cursor
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	if c.Sort != sort || c.Desc != desc {
+		return nil, fmt.Errorf("cursor was issued for another sort order")
+	}
+
+	return &c, nil
+}
+
+func (c *Cursor) String() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cursorOf returns position of the flight in results sorted by search
+func (s Search) cursorOf(f Flight) *Cursor {
+	c := &Cursor{Sort: s.sort(), Desc: s.Desc, ID: f.ID}
+
+	switch c.Sort {
+	case SortScheduled:
+		c.Time = f.Scheduled.UTC()
+	case SortFare:
+		c.Int = f.Fare
+	case SortDuration:
+		c.Int = int64(f.Duration)
+	}
+
+	return c
+}
+
+// value returns cursor value of the sort field
+func (c *Cursor) value() interface{} {
+	switch c.Sort {
+	case SortScheduled:
+		return c.Time
+	case SortFare, SortDuration:
+		return c.Int
+	}
+
+	return c.ID
+}
+
+func (s Search) sort() string {
+	if s.Sort == "" {
+		return SortID
+	}
+	return s.Sort
+}
+
+func (s Search) limit() int {
+	if s.Limit <= 0 {
+		return DefaultSearchLimit
+	}
+	if s.Limit > MaxSearchLimit {
+		return MaxSearchLimit
+	}
+	return s.Limit
+}
+
+// compare compares flights by sort field and id, regardless of direction
+func (s Search) compare(a, b Flight) int {
+	var r int
+
+	switch s.sort() {
+	case SortScheduled:
+		r = compareTime(a.Scheduled, b.Scheduled)
+	case SortFare:
+		r = compareInt(a.Fare, b.Fare)
+	case SortDuration:
+		r = compareInt(int64(a.Duration), int64(b.Duration))
+	}
+
+	if r == 0 {
+		r = compareInt(int64(a.ID), int64(b.ID))
+	}
+
+	return r
+}
+
+// page cuts sorted flights fetched with limit+1 into page
+func (s Search) page(flights []Flight) FlightPage {
+	result := FlightPage{Flights: flights}
+
+	if len(flights) > s.limit() {
+		result.Flights = flights[:s.limit()]
+		result.NextCursor = s.cursorOf(result.Flights[len(result.Flights)-1]).String()
+	}
+
+	return result
+}
+
+// matches reports whether flight satisfies search filters
+func (s Search) matches(f Flight) bool {
+	if (f.DeletedAt != nil && s.Deleted == "") || (f.DeletedAt == nil && s.Deleted == DeletedOnly) {
+		return false
+	}
+	if len(s.Names) != 0 && !containsString(s.Names, f.Name, false) {
+		return false
+	}
+	if len(s.Numbers) != 0 && !containsString(s.Numbers, f.Number, false) {
+		return false
+	}
+	if s.NumberPrefix != "" && !strings.HasPrefix(strings.ToUpper(f.Number), strings.ToUpper(s.NumberPrefix)) {
+		return false
+	}
+	if len(s.Destinations) != 0 && !containsString(s.Destinations, f.Destination, true) {
+		return false
+	}
+	if len(s.Statuses) != 0 && !containsStatus(s.Statuses, f.Status) {
+		return false
+	}
+	if len(s.Schedules) != 0 && !containsID(s.Schedules, f.ScheduleID) {
+		return false
+	}
+	if len(s.OriginAirports) != 0 && !containsID(s.OriginAirports, f.OriginAirportID) {
+		return false
+	}
+	if len(s.DestinationAirports) != 0 && !containsID(s.DestinationAirports, f.DestinationAirportID) {
+		return false
+	}
+	if len(s.Owners) != 0 && !containsID(s.Owners, f.CreatedBy) {
+		return false
+	}
+	if !inTimeRange(f.Scheduled, s.ScheduledFrom, s.ScheduledTo) {
+		return false
+	}
+	if !inTimeRange(f.Departure, s.DepartureFrom, s.DepartureTo) {
+		return false
+	}
+	if s.FareCurrency != "" && f.Currency != s.FareCurrency {
+		return false
+	}
+	if (s.FareMin != nil && f.Fare < *s.FareMin) || (s.FareMax != nil && f.Fare > *s.FareMax) {
+		return false
+	}
+	if (s.DurationMin != nil && f.Duration < *s.DurationMin) || (s.DurationMax != nil && f.Duration > *s.DurationMax) {
+		return false
+	}
+
+	return true
+}
+
+func containsString(list []string, s string, fold bool) bool {
+	for _, item := range list {
+		if item == s || (fold && strings.EqualFold(item, s)) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsStatus(list []FlightStatus, status FlightStatus) bool {
+	for _, item := range list {
+		if item == status {
+			return true
+		}
+	}
+	return false
+}
+
+func containsID(list []uint, id *uint) bool {
+	if id == nil {
+		return false
+	}
+	for _, item := range list {
+		if item == *id {
+			return true
+		}
+	}
+	return false
+}
+
+func inTimeRange(t time.Time, from, to *time.Time) bool {
+	if from != nil && t.Before(*from) {
+		return false
+	}
+	if to != nil && t.After(*to) {
+		return false
+	}
+	return true
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
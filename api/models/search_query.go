@@ -0,0 +1,203 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+const dateLayout = "2006-01-02"
+
+// ParseSearch parses flights search query parameters:
+//
+//	flight_name, number, destination   exact match, comma separated or repeated values match any
+//	number_prefix                      flight number prefix, case insensitive
+//	destination                        is matched case insensitive
+//	status                             flight statuses, comma separated or repeated
+//	schedule_id                        flights materialized by schedules
+//	origin_airport_id                  origin airport ids, comma separated or repeated
+//	destination_airport_id             destination airport ids, comma separated or repeated
+//	deleted                            include or only, deleted flights are excluded by default
+//	scheduled_date, departure          exact RFC 3339 time or the whole YYYY-MM-DD day (UTC)
+//	departure_from, departure_to       inclusive departure range, RFC 3339 time or YYYY-MM-DD
+//	fare_min, fare_max                 inclusive fare range in minor units
+//	fare_currency                      currency of fare range and sort=fare, default USD
+//	duration_min, duration_max         inclusive duration range in minutes
+//	sort, limit, cursor                ordering and page
+//
+// Every malformed parameter is reported as a validation problem field.
+func ParseSearch(q url.Values) (Search, error) {
+	var (
+		s   Search
+		v   problem.Validation
+		err error
+	)
+
+	s.Names = listParam(q, "flight_name")
+	s.Numbers = listParam(q, "number")
+	s.Destinations = listParam(q, "destination")
+	s.NumberPrefix = strings.TrimSpace(q.Get("number_prefix"))
+	for _, status := range listParam(q, "status") {
+		st, err := ParseFlightStatus(status)
+		if err != nil {
+			v.Add("status", "invalid", err.Error())
+			break
+		}
+		s.Statuses = append(s.Statuses, st)
+	}
+
+	s.Schedules = idListParam(&v, q, "schedule_id")
+	s.OriginAirports = idListParam(&v, q, "origin_airport_id")
+	s.DestinationAirports = idListParam(&v, q, "destination_airport_id")
+
+	switch s.Deleted = q.Get("deleted"); s.Deleted {
+	case "", DeletedInclude, DeletedOnly:
+	default:
+		v.Add("deleted", "invalid", "deleted must be include or only")
+	}
+
+	s.ScheduledFrom, s.ScheduledTo = timeParam(&v, q, "scheduled_date")
+
+	exactFrom, exactTo := timeParam(&v, q, "departure")
+	s.DepartureFrom, _ = timeParam(&v, q, "departure_from")
+	_, s.DepartureTo = timeParam(&v, q, "departure_to")
+
+	if exactFrom != nil {
+		if s.DepartureFrom != nil || s.DepartureTo != nil {
+			v.Add("departure", "conflict", "departure can't be combined with departure_from or departure_to")
+		}
+		s.DepartureFrom, s.DepartureTo = exactFrom, exactTo
+	}
+
+	v.Check(s.DepartureFrom == nil || s.DepartureTo == nil || !s.DepartureFrom.After(*s.DepartureTo),
+		"departure_to", "range", "departure_to must not be before departure_from")
+
+	s.FareMin = int64Param(&v, q, "fare_min")
+	s.FareMax = int64Param(&v, q, "fare_max")
+
+	v.Check(s.FareMin == nil || s.FareMax == nil || *s.FareMin <= *s.FareMax,
+		"fare_max", "range", "fare_max must not be less than fare_min")
+
+	s.DurationMin = intParam(&v, q, "duration_min")
+	s.DurationMax = intParam(&v, q, "duration_max")
+
+	v.Check(s.DurationMin == nil || s.DurationMax == nil || *s.DurationMin <= *s.DurationMax,
+		"duration_max", "range", "duration_max must not be less than duration_min")
+
+	if limit := q.Get("limit"); limit != "" {
+		s.Limit, err = strconv.Atoi(limit)
+		v.Check(err == nil && s.Limit > 0 && s.Limit <= MaxSearchLimit, "limit", "invalid",
+			fmt.Sprintf("limit must be an integer from 1 to %d", MaxSearchLimit))
+	}
+
+	if s.Sort, s.Desc, err = ParseSort(q.Get("sort")); err != nil {
+		v.Add("sort", "invalid", err.Error())
+	}
+
+	// Fares of different currencies aren't comparable, fare filters and
+	// order match flights of a single currency
+	if currency := q.Get("fare_currency"); currency != "" || s.FareMin != nil || s.FareMax != nil || s.Sort == SortFare {
+		if s.FareCurrency = strings.ToUpper(strings.TrimSpace(currency)); s.FareCurrency == "" {
+			s.FareCurrency = DefaultCurrency
+		}
+
+		v.Check(ValidCurrency(s.FareCurrency), "fare_currency", "invalid", "fare_currency must be a supported ISO 4217 code")
+	}
+
+	if cursor := q.Get("cursor"); cursor != "" && err == nil {
+		if s.After, err = ParseCursor(cursor, s.Sort, s.Desc); err != nil {
+			v.Add("cursor", "invalid", err.Error())
+		}
+	}
+
+	return s, v.Err()
+}
+
+// listParam returns values of repeated and comma separated parameter
+func listParam(q url.Values, name string) []string {
+	var result []string
+
+	for _, value := range q[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				result = append(result, item)
+			}
+		}
+	}
+
+	return result
+}
+
+// idListParam parses list parameter of positive integer ids
+func idListParam(v *problem.Validation, q url.Values, name string) []uint {
+	var result []uint
+
+	for _, item := range listParam(q, name) {
+		id, err := strconv.ParseUint(item, 10, 32)
+		if err != nil || id == 0 {
+			v.Add(name, "invalid", fmt.Sprintf("%s must be a list of positive integers", name))
+			return nil
+		}
+		result = append(result, uint(id))
+	}
+
+	return result
+}
+
+// timeParam parses RFC 3339 time or YYYY-MM-DD date. Time is returned
+// as both bounds, date as its first and last instants in UTC.
+func timeParam(v *problem.Validation, q url.Values, name string) (*time.Time, *time.Time) {
+	value := q.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		t = t.UTC()
+		return &t, &t
+	}
+
+	day, err := time.Parse(dateLayout, value)
+	if err != nil {
+		v.Add(name, "invalid", fmt.Sprintf("%s must be RFC 3339 time or YYYY-MM-DD date", name))
+		return nil, nil
+	}
+
+	end := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+
+	return &day, &end
+}
+
+func int64Param(v *problem.Validation, q url.Values, name string) *int64 {
+	value := q.Get(name)
+	if value == "" {
+		return nil
+	}
+
+	i, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		v.Add(name, "invalid", fmt.Sprintf("%s must be an integer", name))
+		return nil
+	}
+
+	return &i
+}
+
+func intParam(v *problem.Validation, q url.Values, name string) *int {
+	value := q.Get(name)
+	if value == "" {
+		return nil
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		v.Add(name, "invalid", fmt.Sprintf("%s must be an integer", name))
+		return nil
+	}
+
+	return &i
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+// ErrNotFound is returned by stores when requested record doesn't exist
+var ErrNotFound = problem.NotFound("record not found")
+
+// Stores bundles storage backends used by API handlers
+type Stores struct {
+	Flights       FlightStore
+	Users         UserStore
+	Tokens        TokenStore
+	Airports      AirportStore
+	Bookings      BookingStore
+	Schedules     ScheduleStore
+	Organizations OrganizationStore
+	Audit         AuditStore
+}
+
+// Tenant returns stores, which see and change flights, users, schedules
+// and audit log of organization only. Other stores are shared.
+func (s *Stores) Tenant(org uint) *Stores {
+	tenant := *s
+
+	tenant.Flights = s.Flights.Tenant(org)
+	tenant.Users = s.Users.Tenant(org)
+	tenant.Schedules = s.Schedules.Tenant(org)
+	tenant.Audit = s.Audit.Tenant(org)
+
+	return &tenant
+}
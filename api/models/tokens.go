@@ -0,0 +1,224 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	"github.com/3d0c/sample-api/pkg/problem"
+)
+
+const (
+	AccessTokenTTL  = 60 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrTokenInvalid = problem.Unauthorized("refresh_token_invalid", "invalid or expired refresh token")
+	ErrTokenReused  = problem.Unauthorized("refresh_token_reused", "refresh token reuse detected, token family revoked")
+)
+
+// RefreshToken is a single use token exchanged for a new token pair.
+// All tokens issued starting from one login share the same Family.
+// Only the hash of the token is stored.
+type RefreshToken struct {
+	ID              uint   `gorm:"primary_key"`
+	TokenHash       string `gorm:"type:varchar(64);unique_index"`
+	Family          string `gorm:"type:varchar(64);index"`
+	UserID          uint
+	AccessJTI       string `gorm:"type:varchar(64)"`
+	AccessExpiresAt time.Time
+	ExpiresAt       time.Time
+	UsedAt          *time.Time
+	RevokedAt       *time.Time
+	CreatedAt       time.Time
+}
+
+// DeniedToken is a revoked access token, kept until it expires
+type DeniedToken struct {
+	JTI       string `gorm:"primary_key;type:varchar(64)"`
+	ExpiresAt time.Time
+}
+
+// TokenStore is implemented by refresh tokens and access tokens denylist storage backends
+type TokenStore interface {
+	CreateRefresh(t *RefreshToken) error
+	FindRefresh(hash string) (*RefreshToken, error)
+	// MarkUsed atomically marks refresh token used, it returns ErrTokenReused
+	// if token has been used already
+	MarkUsed(id uint, at time.Time) error
+	// RevokeFamily revokes all refresh tokens of the family and returns them
+	RevokeFamily(family string, at time.Time) ([]RefreshToken, error)
+	// RevokeUser revokes all refresh tokens of the user and returns them
+	RevokeUser(userID uint, at time.Time) ([]RefreshToken, error)
+	Deny(jti string, expiresAt time.Time) error
+	IsDenied(jti string) (bool, error)
+}
+
+// Signer signs access tokens claims
+type Signer interface {
+	Sign(claims jwt.MapClaims) (string, error)
+}
+
+type JWTToken struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+}
+
+func randomToken(size int) (string, error) {
+	b := make([]byte, size)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateJWT issues access and refresh tokens starting a new token family
+func (u *User) GenerateJWT(s TokenStore, k Signer) (JWTToken, error) {
+	family, err := randomToken(16)
+	if err != nil {
+		return JWTToken{}, err
+	}
+
+	return u.issueTokens(s, k, family)
+}
+
+func (u *User) issueTokens(s TokenStore, k Signer, family string) (JWTToken, error) {
+	var (
+		access  string
+		refresh string
+		jti     string
+		exp     time.Time
+		err     error
+	)
+
+	if access, jti, exp, err = u.accessToken(k, family); err != nil {
+		return JWTToken{}, err
+	}
+
+	if refresh, err = randomToken(32); err != nil {
+		return JWTToken{}, err
+	}
+
+	err = s.CreateRefresh(&RefreshToken{
+		TokenHash:       hashToken(refresh),
+		Family:          family,
+		UserID:          u.ID,
+		AccessJTI:       jti,
+		AccessExpiresAt: exp,
+		ExpiresAt:       time.Now().Add(RefreshTokenTTL).UTC(),
+	})
+	if err != nil {
+		return JWTToken{}, err
+	}
+
+	return JWTToken{
+		Token:        access,
+		RefreshToken: refresh,
+		ExpiresIn:    int64(AccessTokenTTL / time.Second),
+	}, nil
+}
+
+// RefreshJWT exchanges refresh token for a new token pair of the same family.
+// Presenting already used refresh token revokes the whole family.
+func RefreshJWT(ts TokenStore, us UserStore, k Signer, refresh string) (JWTToken, error) {
+	var (
+		rt  *RefreshToken
+		u   *User
+		err error
+		now time.Time = time.Now().UTC()
+	)
+
+	if rt, err = ts.FindRefresh(hashToken(refresh)); err != nil {
+		if err == ErrNotFound {
+			return JWTToken{}, ErrTokenInvalid
+		}
+		return JWTToken{}, err
+	}
+
+	if rt.RevokedAt != nil || now.After(rt.ExpiresAt) {
+		return JWTToken{}, ErrTokenInvalid
+	}
+
+	if rt.UsedAt == nil {
+		err = ts.MarkUsed(rt.ID, now)
+	} else {
+		err = ErrTokenReused
+	}
+
+	if err == ErrTokenReused {
+		log.Printf("Refresh token reuse detected, revoking family %s of user %d\n", rt.Family, rt.UserID)
+
+		if err = RevokeTokenFamily(ts, rt.Family); err != nil {
+			return JWTToken{}, err
+		}
+
+		return JWTToken{}, ErrTokenReused
+	}
+	if err != nil {
+		return JWTToken{}, err
+	}
+
+	if u, err = us.Find(rt.UserID); err != nil {
+		if err == ErrNotFound {
+			return JWTToken{}, ErrTokenInvalid
+		}
+		return JWTToken{}, err
+	}
+
+	return u.issueTokens(ts, k, rt.Family)
+}
+
+// RevokeTokenFamily revokes refresh tokens of the family and denies
+// access tokens issued along with them
+func RevokeTokenFamily(s TokenStore, family string) error {
+	now := time.Now().UTC()
+
+	tokens, err := s.RevokeFamily(family, now)
+	if err != nil {
+		return err
+	}
+
+	return denyAccess(s, tokens, now)
+}
+
+// RevokeUserTokens revokes refresh tokens of all families of the user
+// and denies access tokens issued along with them, e.g. when user is
+// deleted
+func RevokeUserTokens(s TokenStore, userID uint) error {
+	now := time.Now().UTC()
+
+	tokens, err := s.RevokeUser(userID, now)
+	if err != nil {
+		return err
+	}
+
+	return denyAccess(s, tokens, now)
+}
+
+// denyAccess denies access tokens of refresh tokens, which haven't expired
+func denyAccess(s TokenStore, tokens []RefreshToken, now time.Time) error {
+	for _, t := range tokens {
+		if t.AccessJTI == "" || t.AccessExpiresAt.Before(now) {
+			continue
+		}
+
+		if err := s.Deny(t.AccessJTI, t.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type dbTokenStore struct {
+	db *gorm.DB
+}
+
+func (s *dbTokenStore) CreateRefresh(t *RefreshToken) error {
+	return s.db.Create(t).Error
+}
+
+func (s *dbTokenStore) FindRefresh(hash string) (*RefreshToken, error) {
+	var t RefreshToken
+
+	if err := s.db.Where("token_hash = ?", hash).First(&t).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (s *dbTokenStore) MarkUsed(id uint, at time.Time) error {
+	result := s.db.Model(&RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrTokenReused
+	}
+
+	return nil
+}
+
+func (s *dbTokenStore) RevokeFamily(family string, at time.Time) ([]RefreshToken, error) {
+	var tokens []RefreshToken
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("family = ?", family).Find(&tokens).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&RefreshToken{}).
+			Where("family = ? AND revoked_at IS NULL", family).
+			Update("revoked_at", at).Error
+	})
+
+	return tokens, err
+}
+
+func (s *dbTokenStore) RevokeUser(userID uint, at time.Time) ([]RefreshToken, error) {
+	var tokens []RefreshToken
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Find(&tokens).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", at).Error
+	})
+
+	return tokens, err
+}
+
+func (s *dbTokenStore) Deny(jti string, expiresAt time.Time) error {
+	// Expired entries are useless, tokens are rejected by exp claim anyway
+	if err := s.db.Where("expires_at < ?", time.Now().UTC()).Delete(&DeniedToken{}).Error; err != nil {
+		return err
+	}
+
+	return s.db.Save(&DeniedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+func (s *dbTokenStore) IsDenied(jti string) (bool, error) {
+	var count int
+
+	if err := s.db.Model(&DeniedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
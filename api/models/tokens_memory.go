@@ -0,0 +1,156 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// memPurgeInterval is how often expired refresh tokens are dropped
+const memPurgeInterval = time.Hour
+
+type memTokenStore struct {
+	sync.RWMutex
+	seq     uint
+	refresh map[uint]RefreshToken
+	// byHash indexes refresh tokens by TokenHash
+	byHash   map[string]uint
+	purgedAt time.Time
+	denied   map[string]time.Time
+}
+
+func newMemTokenStore() *memTokenStore {
+	return &memTokenStore{
+		refresh:  make(map[uint]RefreshToken),
+		byHash:   make(map[string]uint),
+		purgedAt: time.Now(),
+		denied:   make(map[string]time.Time),
+	}
+}
+
+func (s *memTokenStore) CreateRefresh(t *RefreshToken) error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	// Expired tokens are rejected anyway, their access tokens expired
+	// long before
+	if now.Sub(s.purgedAt) >= memPurgeInterval {
+		for id, tmp := range s.refresh {
+			if tmp.ExpiresAt.Before(now) {
+				delete(s.byHash, tmp.TokenHash)
+				delete(s.refresh, id)
+			}
+		}
+		s.purgedAt = now
+	}
+
+	s.seq++
+	t.ID = s.seq
+	t.CreatedAt = now.UTC()
+	s.refresh[t.ID] = *t
+	s.byHash[t.TokenHash] = t.ID
+
+	return nil
+}
+
+func (s *memTokenStore) FindRefresh(hash string) (*RefreshToken, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	t, ok := s.refresh[s.byHash[hash]]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return &t, nil
+}
+
+func (s *memTokenStore) MarkUsed(id uint, at time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	t, ok := s.refresh[id]
+	if !ok {
+		return ErrNotFound
+	}
+
+	if t.UsedAt != nil {
+		return ErrTokenReused
+	}
+
+	t.UsedAt = &at
+	s.refresh[id] = t
+
+	return nil
+}
+
+func (s *memTokenStore) RevokeFamily(family string, at time.Time) ([]RefreshToken, error) {
+	var tokens []RefreshToken
+
+	s.Lock()
+	defer s.Unlock()
+
+	for id, t := range s.refresh {
+		if t.Family != family {
+			continue
+		}
+
+		tokens = append(tokens, t)
+
+		if t.RevokedAt == nil {
+			t.RevokedAt = &at
+			s.refresh[id] = t
+		}
+	}
+
+	return tokens, nil
+}
+
+func (s *memTokenStore) RevokeUser(userID uint, at time.Time) ([]RefreshToken, error) {
+	var tokens []RefreshToken
+
+	s.Lock()
+	defer s.Unlock()
+
+	for id, t := range s.refresh {
+		if t.UserID != userID {
+			continue
+		}
+
+		tokens = append(tokens, t)
+
+		if t.RevokedAt == nil {
+			t.RevokedAt = &at
+			s.refresh[id] = t
+		}
+	}
+
+	return tokens, nil
+}
+
+func (s *memTokenStore) Deny(jti string, expiresAt time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+
+	for k, exp := range s.denied {
+		if exp.Before(now) {
+			delete(s.denied, k)
+		}
+	}
+
+	s.denied[jti] = expiresAt
+
+	return nil
+}
+
+func (s *memTokenStore) IsDenied(jti string) (bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	_, ok := s.denied[jti]
+
+	return ok, nil
+}
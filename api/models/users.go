@@ -1,82 +1,135 @@
 package models
 
 import (
-	"fmt"
 	"log"
-	"os"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 
-	"golang.org/x/crypto/bcrypt"
+	"github.com/3d0c/sample-api/pkg/problem"
 )
 
+var (
+	ErrWrongCredentials = problem.Unauthorized("wrong_credentials", "wrong username or password")
+	ErrUserExists       = problem.Conflict("user_exists", "user with this name already exists")
+	ErrWrongPassword    = problem.Forbidden("wrong_password", "current password is wrong")
+)
+
+// User names are unique across organizations, so login doesn't need
+// organization
 type User struct {
-	ID       uint   `gorm:"primary_key"`
-	Name     string `json:"name" gorm:"type:varchar(255) unique"`
-	Password string `json:"password,omitempty" gorm:"type:varchar(255)"`
+	ID             uint   `gorm:"primary_key"`
+	OrganizationID uint   `json:"organization_id"`
+	Name           string `json:"name" gorm:"type:varchar(255) unique"`
+	Password       string `json:"password,omitempty" gorm:"type:varchar(255)"`
+	Role           Role   `json:"role" gorm:"type:varchar(32)"`
+}
+
+// UserStore is implemented by users storage backends
+type UserStore interface {
+	// Tenant returns store scoped to users of organization, store of
+	// organization 0 is not scoped
+	Tenant(org uint) UserStore
+	// Create adds user to organization of scoped store
+	Create(u *User) error
+	Find(id uint) (*User, error)
+	FindByName(name string) (*User, error)
+	// List returns users ordered by id
+	List() ([]User, error)
+	// Update saves name and password of user
+	Update(u *User) error
+	// Rehash replaces password hash of user if it is still old one,
+	// password changed meanwhile is kept
+	Rehash(id uint, old string, hash string) error
+	SetRole(name string, role Role) error
+	// Delete removes user and cancels its confirmed bookings, so their
+	// seats are released, all at once
+	Delete(id uint) error
 }
 
+// Validate checks all fields and reports every invalid one
 func (u *User) Validate() error {
-	if u.Name == "" {
-		return fmt.Errorf("Please provide username")
-	}
-	if u.Password == "" {
-		return fmt.Errorf("Please provide password")
-	}
+	var v problem.Validation
 
-	return nil
+	v.Check(u.Name != "", "name", "required", "Please provide username")
+	v.Check(u.Password != "", "password", "required", "Please provide password")
+
+	return v.Err()
 }
 
-func (u *User) Create() error {
-	enc, err := bcrypt.GenerateFromPassword([]byte(u.Password), 4)
+// HashPassword replaces plain text password with its hash made by Hasher
+func (u *User) HashPassword() error {
+	enc, err := Hasher.Hash(u.Password)
 	if err != nil {
 		return err
 	}
 
-	u.Password = string(enc)
+	u.Password = enc
+
+	return nil
+}
+
+// CheckPassword compares plain text password with user password hash
+func (u *User) CheckPassword(password string) error {
+	if !VerifyPassword(u.Password, password) {
+		return ErrWrongPassword
+	}
 
-	return db.Create(&u).Error
+	return nil
 }
 
-func (u *User) Find() (*User, error) {
+// Authenticate looks up user by name and checks its password
+func (u *User) Authenticate(s UserStore) (*User, error) {
 	var (
-		tmp User
+		tmp *User
 		err error
 	)
 
-	if err = db.Where("name = ?", u.Name).First(&tmp).Error; err != nil {
+	if tmp, err = s.FindByName(u.Name); err != nil {
 		log.Printf("User not found - %s\n", err)
-		return nil, fmt.Errorf("wrong username or password")
+		return nil, ErrWrongCredentials
 	}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(tmp.Password), []byte(u.Password)); err != nil {
-		log.Printf("bcrypt error - %s\n", err)
-		return nil, fmt.Errorf("wrong username or password")
+	if !VerifyPassword(tmp.Password, u.Password) {
+		log.Printf("Wrong password of user %d\n", tmp.ID)
+		return nil, ErrWrongCredentials
 	}
 
-	return &tmp, nil
-}
+	// Plain text password is known only now, so outdated hash is replaced
+	// on login. Login succeeds anyway.
+	if Hasher.NeedsRehash(tmp.Password) {
+		var hash string
 
-func (u *User) Delete() error {
-	return db.Delete(&User{}).Error
-}
+		if hash, err = Hasher.Hash(u.Password); err == nil {
+			err = s.Rehash(tmp.ID, tmp.Password, hash)
+		}
 
-type JWTToken struct {
-	Token string `json:"token"`
+		if err != nil {
+			log.Printf("Error rehashing password of user %d - %s\n", tmp.ID, err)
+		}
+	}
+
+	return tmp, nil
 }
 
-func (u *User) GenerateJWT() (JWTToken, error) {
-	// TODO, move secret to ENV
-	signingKey := []byte(os.Getenv("JWT_SECRET"))
+// accessToken returns signed access token, its id and expiration time
+func (u *User) accessToken(k Signer, family string) (string, string, time.Time, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", "", time.Time{}, err
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"exp":  time.Now().Add(time.Minute * 60).Unix(),
+	exp := time.Now().Add(AccessTokenTTL).UTC()
+
+	tokenString, err := k.Sign(jwt.MapClaims{
+		"exp":  exp.Unix(),
+		"jti":  jti,
+		"fam":  family,
 		"id":   u.ID,
 		"name": u.Name,
+		"role": u.Role,
+		"org":  u.OrganizationID,
 	})
 
-	tokenString, err := token.SignedString(signingKey)
-
-	return JWTToken{tokenString}, err
+	return tokenString, jti, exp, err
 }
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+type dbUserStore struct {
+	db *gorm.DB
+	// org scopes all queries to organization, 0 is all organizations
+	org uint
+}
+
+func (s *dbUserStore) Tenant(org uint) UserStore {
+	return &dbUserStore{db: s.db, org: org}
+}
+
+// scoped returns users query restricted to store organization
+func (s *dbUserStore) scoped() *gorm.DB {
+	q := s.db.Model(&User{})
+
+	if s.org != 0 {
+		q = q.Where("organization_id = ?", s.org)
+	}
+
+	return q
+}
+
+func (s *dbUserStore) Create(u *User) error {
+	var count int
+
+	// Names are unique across organizations
+	if err := s.db.Model(&User{}).Where("name = ?", u.Name).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return ErrUserExists
+	}
+
+	if s.org != 0 {
+		u.OrganizationID = s.org
+	} else if u.OrganizationID == 0 {
+		u.OrganizationID = DefaultOrganizationID
+	}
+
+	return s.db.Create(u).Error
+}
+
+func (s *dbUserStore) Find(id uint) (*User, error) {
+	var u User
+
+	if err := s.scoped().Where("id = ?", id).First(&u).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (s *dbUserStore) FindByName(name string) (*User, error) {
+	var u User
+
+	if err := s.scoped().Where("name = ?", name).First(&u).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &u, nil
+}
+
+func (s *dbUserStore) List() ([]User, error) {
+	result := []User{}
+
+	err := s.scoped().Order("id").Find(&result).Error
+
+	return result, err
+}
+
+func (s *dbUserStore) Update(u *User) error {
+	var count int
+
+	if err := s.db.Model(&User{}).Where("name = ? AND id <> ?", u.Name, u.ID).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count != 0 {
+		return ErrUserExists
+	}
+
+	result := s.scoped().Where("id = ?", u.ID).Updates(map[string]interface{}{"name": u.Name, "password": u.Password})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *dbUserStore) Rehash(id uint, old string, hash string) error {
+	return s.scoped().Where("id = ? AND password = ?", id, old).Update("password", hash).Error
+}
+
+func (s *dbUserStore) SetRole(name string, role Role) error {
+	result := s.scoped().Where("name = ?", name).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (s *dbUserStore) Delete(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var bookings []Booking
+
+		if err := tx.Where("user_id = ? AND status = ?", id, BookingConfirmed).Find(&bookings).Error; err != nil {
+			return err
+		}
+
+		now := time.Now().UTC()
+
+		for _, b := range bookings {
+			if _, err := cancelBooking(tx, b.ID, now); err != nil {
+				return err
+			}
+		}
+
+		result := (&dbUserStore{db: tx, org: s.org}).scoped().Where("id = ?", id).Delete(&User{})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return nil
+	})
+}
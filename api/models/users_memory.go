@@ -0,0 +1,181 @@
+package models
+
+import (
+	"sort"
+	"sync"
+)
+
+// memUsers are users of all organizations shared by scoped stores
+type memUsers struct {
+	sync.RWMutex
+	seq   uint
+	users map[uint]User
+	// bookings of deleted users are cancelled
+	bookings *memBookingStore
+}
+
+type memUserStore struct {
+	*memUsers
+	// org scopes store to organization, 0 is all organizations
+	org uint
+}
+
+func newMemUserStore(bookings *memBookingStore) *memUserStore {
+	return &memUserStore{memUsers: &memUsers{users: make(map[uint]User), bookings: bookings}}
+}
+
+func (s *memUserStore) Tenant(org uint) UserStore {
+	return &memUserStore{memUsers: s.memUsers, org: org}
+}
+
+// owns reports whether user is visible through the store
+func (s *memUserStore) owns(u User) bool {
+	return s.org == 0 || u.OrganizationID == s.org
+}
+
+func (s *memUserStore) Create(u *User) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// Names are unique across organizations
+	for _, tmp := range s.users {
+		if tmp.Name == u.Name {
+			return ErrUserExists
+		}
+	}
+
+	if s.org != 0 {
+		u.OrganizationID = s.org
+	} else if u.OrganizationID == 0 {
+		u.OrganizationID = DefaultOrganizationID
+	}
+
+	s.seq++
+	u.ID = s.seq
+	s.users[u.ID] = *u
+
+	return nil
+}
+
+func (s *memUserStore) Find(id uint) (*User, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok || !s.owns(u) {
+		return nil, ErrNotFound
+	}
+
+	return &u, nil
+}
+
+func (s *memUserStore) FindByName(name string) (*User, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, u := range s.users {
+		if u.Name == name && s.owns(u) {
+			return &u, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+func (s *memUserStore) List() ([]User, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := []User{}
+	for _, u := range s.users {
+		if s.owns(u) {
+			result = append(result, u)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+func (s *memUserStore) Update(u *User) error {
+	s.Lock()
+	defer s.Unlock()
+
+	cur, ok := s.users[u.ID]
+	if !ok || !s.owns(cur) {
+		return ErrNotFound
+	}
+
+	for id, tmp := range s.users {
+		if tmp.Name == u.Name && id != u.ID {
+			return ErrUserExists
+		}
+	}
+
+	cur.Name, cur.Password = u.Name, u.Password
+	s.users[u.ID] = cur
+
+	return nil
+}
+
+func (s *memUserStore) Rehash(id uint, old string, hash string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if cur, ok := s.users[id]; ok && s.owns(cur) && cur.Password == old {
+		cur.Password = hash
+		s.users[id] = cur
+	}
+
+	return nil
+}
+
+func (s *memUserStore) SetRole(name string, role Role) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for id, u := range s.users {
+		if u.Name == name && s.owns(u) {
+			u.Role = role
+			s.users[id] = u
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memUserStore) Delete(id uint) error {
+	s.Lock()
+	defer s.Unlock()
+
+	u, ok := s.users[id]
+	if !ok || !s.owns(u) {
+		return ErrNotFound
+	}
+
+	s.bookings.Lock()
+	defer s.bookings.Unlock()
+
+	for bid, b := range s.bookings.bookings {
+		if b.UserID != id {
+			continue
+		}
+
+		if b.Status == BookingConfirmed {
+			if _, err := s.bookings.cancel(bid); err != nil {
+				return err
+			}
+		}
+
+		// Same as ON DELETE CASCADE
+		delete(s.bookings.bookings, bid)
+	}
+
+	delete(s.users, id)
+
+	return nil
+}
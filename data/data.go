@@ -0,0 +1,19 @@
+// Package data holds reference data bundled into the binary.
+package data
+
+import (
+	_ "embed"
+)
+
+// Airports is a list of major airports in OpenFlights airports.dat format:
+// id, name, city, country, IATA, ICAO, latitude, longitude, altitude,
+// UTC offset, DST, tz database time zone, type, source.
+//
+//go:embed airports.csv
+var Airports []byte
+
+// CommonPasswords is a deny-list of passwords, one per line, lines
+// starting with # are comments.
+//
+//go:embed common-passwords.txt
+var CommonPasswords []byte
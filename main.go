@@ -1,29 +1,126 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	// Airports time zones are validated without system zoneinfo
+	_ "time/tzdata"
+
+	"github.com/jinzhu/gorm"
 
 	"github.com/3d0c/sample-api/api/handlers"
+	"github.com/3d0c/sample-api/api/migrations"
 	"github.com/3d0c/sample-api/api/models"
+	"github.com/3d0c/sample-api/data"
+	"github.com/3d0c/sample-api/pkg/helpers"
+	"github.com/3d0c/sample-api/pkg/jwks"
 )
 
 func main() {
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
 	var (
-		listenOn string
+		listenOn    string
+		dbDriver    string
+		autoMigrate bool
+		ratesFile   string
+		retention   time.Duration
+		hasher      string
+		denyList    string
+		devKeys     bool
 	)
 
 	flag.StringVar(&listenOn, "listen-on", ":5560", "listen on")
+	flag.StringVar(&dbDriver, "db-driver", helpers.Getenv("DB_DRIVER", models.DriverPostgres), "database driver, postgres or sqlite3")
+	flag.BoolVar(&autoMigrate, "auto-migrate", false, "apply pending migrations before start")
+	flag.StringVar(&ratesFile, "currency-rates", os.Getenv("CURRENCY_RATES"), "exchange rates JSON file, fares are not converted if not set")
+	flag.DurationVar(&retention, "flights-retention", defaultRetention(), "how long deleted flights are kept, 0 keeps them forever")
+	flag.StringVar(&hasher, "password-hash", helpers.Getenv("PASSWORD_HASH", models.AlgorithmBcrypt), "password hashing, e.g. bcrypt,cost=12 or argon2id,m=19456,t=2,p=1")
+	flag.IntVar(&models.Policy.MinLength, "password-min-length", envInt("PASSWORD_MIN_LENGTH", models.Policy.MinLength), "minimum length of new passwords")
+	flag.IntVar(&models.Policy.Classes, "password-classes", envInt("PASSWORD_CLASSES", models.Policy.Classes), "number of character classes new passwords must contain, up to 4")
+	flag.StringVar(&denyList, "password-deny-list", os.Getenv("PASSWORD_DENY_LIST"), "file of rejected passwords, bundled list of common passwords is used if not set")
+	flag.BoolVar(&devKeys, "dev-keys", false, "sign tokens with ephemeral key if JWT_SIGNING_KEY is not set, for development only")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate up|down|status | role <username> <viewer|operator|admin> | airports load [file.csv] | audit verify]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	if err := models.ConnectDatabase(); err != nil {
+	conn, err := models.ConnectDatabase(dbDriver)
+	if err != nil {
 		log.Fatalf("Error connecting to database - %s\n", err)
 	}
 
-	router := handlers.SetupRouter()
+	if flag.Arg(0) == "migrate" {
+		if err = migrate(conn, flag.Arg(1)); err != nil {
+			log.Fatalf("Error migrating database - %s\n", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "role" {
+		if err = setRole(conn, flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Fatalf("Error setting user role - %s\n", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "airports" {
+		if err = loadAirports(conn, flag.Arg(1), flag.Arg(2)); err != nil {
+			log.Fatalf("Error loading airports - %s\n", err)
+		}
+		return
+	}
+
+	if flag.Arg(0) == "audit" {
+		if err = verifyAudit(conn, flag.Arg(1)); err != nil {
+			log.Fatalf("Error verifying audit log - %s\n", err)
+		}
+		return
+	}
+
+	if err = configurePasswords(hasher, denyList); err != nil {
+		log.Fatalf("Error configuring passwords - %s\n", err)
+	}
+
+	if autoMigrate {
+		if err = migrate(conn, "up"); err != nil {
+			log.Fatalf("Error migrating database - %s\n", err)
+		}
+	}
+
+	if err = migrations.Check(conn); err != nil {
+		log.Fatalf("Refusing to start - %s. Run `%s migrate up`\n", err, os.Args[0])
+	}
+
+	keys, err := loadKeys(devKeys)
+	if err != nil {
+		log.Fatalf("Error loading JWT keys - %s\n", err)
+	}
+
+	var rates *models.Rates
+
+	if ratesFile != "" {
+		if rates, err = models.LoadRates(ratesFile); err != nil {
+			log.Fatalf("Error loading exchange rates - %s\n", err)
+		}
+	}
+
+	stores := models.NewDBStores(conn)
+	router := handlers.SetupRouter(stores, keys, rates)
+
+	go generateSchedules(stores, time.Hour)
+
+	if retention > 0 {
+		go purgeFlights(stores, retention, time.Hour)
+	}
 
 	log.Printf("API handler is listening on %s\n", listenOn)
 
@@ -31,3 +128,244 @@ func main() {
 		http.ListenAndServe(listenOn, router),
 	)
 }
+
+func migrate(conn *gorm.DB, cmd string) error {
+	switch cmd {
+	case "up":
+		done, err := migrations.Up(conn)
+		for _, m := range done {
+			log.Printf("Applied %d_%s\n", m.Version, m.Name)
+		}
+		if err == nil && len(done) == 0 {
+			log.Printf("Database schema is up to date\n")
+		}
+		return err
+
+	case "down":
+		m, err := migrations.Down(conn)
+		if err != nil {
+			return err
+		}
+		if m == nil {
+			log.Printf("Nothing to revert\n")
+		} else {
+			log.Printf("Reverted %d_%s\n", m.Version, m.Name)
+		}
+		return nil
+
+	case "status":
+		states, err := migrations.Status(conn)
+		if err != nil {
+			return err
+		}
+		for _, s := range states {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02T15:04:05Z07:00")
+			}
+			fmt.Printf("%04d %-40s %s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown migrate command '%s', expected up, down or status", cmd)
+}
+
+func setRole(conn *gorm.DB, name string, role string) error {
+	r, err := models.ParseRole(role)
+	if err != nil {
+		return err
+	}
+
+	if err = migrations.Check(conn); err != nil {
+		return err
+	}
+
+	if err = models.NewDBStores(conn).Users.SetRole(name, r); err != nil {
+		return err
+	}
+
+	log.Printf("User '%s' has role '%s' now\n", name, r)
+
+	return nil
+}
+
+// loadAirports creates or updates airports from OpenFlights CSV file,
+// bundled airports are loaded if file is not specified
+func loadAirports(conn *gorm.DB, cmd string, file string) error {
+	var (
+		content = data.Airports
+		err     error
+	)
+
+	if cmd != "load" {
+		return fmt.Errorf("unknown airports command '%s', expected load", cmd)
+	}
+
+	if err = migrations.Check(conn); err != nil {
+		return err
+	}
+
+	if file != "" {
+		if content, err = os.ReadFile(file); err != nil {
+			return err
+		}
+	}
+
+	airports, skipped, err := models.ParseAirportsCSV(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	if err = models.NewDBStores(conn).Airports.Upsert(airports); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d airports, skipped %d invalid rows\n", len(airports), skipped)
+
+	return nil
+}
+
+// verifyAudit checks hash chain of audit log entries
+func verifyAudit(conn *gorm.DB, cmd string) error {
+	if cmd != "verify" {
+		return fmt.Errorf("unknown audit command '%s', expected verify", cmd)
+	}
+
+	if err := migrations.Check(conn); err != nil {
+		return err
+	}
+
+	n, err := models.NewDBStores(conn).Audit.Verify()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Audit log is intact, %d entries verified\n", n)
+
+	return nil
+}
+
+// generateSchedules keeps rolling horizon of schedule flights materialized
+func generateSchedules(stores *models.Stores, interval time.Duration) {
+	for {
+		schedules, err := stores.Schedules.List()
+		if err != nil {
+			log.Printf("Error listing schedules - %s\n", err)
+		}
+
+		for i := range schedules {
+			result, err := models.GenerateFlights(&schedules[i], stores, time.Now().UTC(), models.DefaultScheduleHorizon)
+			if err != nil {
+				log.Printf("Error generating flights of schedule %d - %s\n", schedules[i].ID, err)
+				continue
+			}
+
+			if result.Created != 0 || result.Updated != 0 || result.Deleted != 0 {
+				log.Printf("Schedule %d flights: %d created, %d updated, %d deleted\n",
+					schedules[i].ID, result.Created, result.Updated, result.Deleted)
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// configurePasswords sets password hashing and loads deny-list of the
+// password policy, bundled one is loaded if file is not specified
+func configurePasswords(hasher string, file string) error {
+	var (
+		content = data.CommonPasswords
+		err     error
+	)
+
+	if models.Hasher, err = models.ParsePasswordHasher(hasher); err != nil {
+		return err
+	}
+
+	if models.Policy.Classes < 0 || models.Policy.Classes > 4 {
+		return fmt.Errorf("password classes must be from 0 to 4")
+	}
+
+	if file != "" {
+		if content, err = os.ReadFile(file); err != nil {
+			return err
+		}
+	}
+
+	models.Policy.DenyList, err = models.LoadDenyList(bytes.NewReader(content))
+
+	return err
+}
+
+// envInt returns integer environment variable, def if it isn't set
+func envInt(name string, def int) int {
+	i, err := strconv.Atoi(helpers.Getenv(name, strconv.Itoa(def)))
+	if err != nil {
+		log.Fatalf("Invalid %s - %s\n", name, err)
+	}
+
+	return i
+}
+
+// defaultRetention is FLIGHTS_RETENTION duration, 30 days if it isn't set
+func defaultRetention() time.Duration {
+	d, err := time.ParseDuration(helpers.Getenv("FLIGHTS_RETENTION", "720h"))
+	if err != nil {
+		log.Fatalf("Invalid FLIGHTS_RETENTION - %s\n", err)
+	}
+
+	return d
+}
+
+// purgeFlights permanently removes flights deleted longer than retention ago
+func purgeFlights(stores *models.Stores, retention time.Duration, interval time.Duration) {
+	for {
+		purged, err := stores.Flights.PurgeDeleted(time.Now().UTC().Add(-retention))
+		if err != nil {
+			log.Printf("Error purging deleted flights - %s\n", err)
+		}
+
+		// Flights purged before failure are recorded too
+		for i := range purged {
+			f := &purged[i]
+			if err = models.AppendAudit(stores.Audit, f.OrganizationID, nil, "", models.AuditPurge, models.AuditFlight, f.ID, f, nil); err != nil {
+				log.Printf("Error recording purge of flight %d to audit log - %s\n", f.ID, err)
+			}
+		}
+
+		if len(purged) != 0 {
+			log.Printf("Purged %d deleted flights\n", len(purged))
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// loadKeys loads signing key from JWT_SIGNING_KEY and keys being rotated out
+// from comma separated JWT_VERIFY_KEYS PEM files. Without signing key
+// ephemeral one is generated only if dev is set, tokens signed by it are
+// invalid after restart and on other instances.
+func loadKeys(dev bool) (*jwks.KeySet, error) {
+	var (
+		signing = os.Getenv("JWT_SIGNING_KEY")
+		verify  []string
+	)
+
+	if signing == "" {
+		if !dev {
+			return nil, fmt.Errorf("JWT_SIGNING_KEY is not set, use -dev-keys to start with ephemeral key")
+		}
+
+		log.Printf("JWT_SIGNING_KEY is not set, using ephemeral key. Tokens will be invalid after restart\n")
+		return jwks.Generate()
+	}
+
+	for _, f := range strings.Split(os.Getenv("JWT_VERIFY_KEYS"), ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			verify = append(verify, f)
+		}
+	}
+
+	return jwks.Load(signing, verify...)
+}
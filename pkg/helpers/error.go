@@ -1,5 +0,0 @@
-package helpers
-
-type Error struct {
-	Error string `json: "error"`
-}
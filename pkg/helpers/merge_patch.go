@@ -0,0 +1,54 @@
+package helpers
+
+import (
+	"encoding/json"
+)
+
+// MergePatch applies JSON Merge Patch (RFC 7396) to JSON encoding of v
+// and returns patched document. Null members of patch remove members of
+// the document, objects are merged recursively, other values replace
+// document members.
+func MergePatch(v interface{}, patch []byte) ([]byte, error) {
+	var (
+		b        []byte
+		doc, ptc interface{}
+		err      error
+	)
+
+	if b, err = json.Marshal(v); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(patch, &ptc); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(doc, ptc))
+}
+
+func mergePatch(doc, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	d, ok := doc.(map[string]interface{})
+	if !ok {
+		d = make(map[string]interface{})
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(d, k)
+			continue
+		}
+
+		d[k] = mergePatch(d[k], v)
+	}
+
+	return d
+}
@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Project encodes v, which must be a slice of structs or maps, and keeps
+// only given keys of every element. Keys are matched case insensitive.
+func Project(v interface{}, keys []string) ([]map[string]json.RawMessage, error) {
+	var (
+		b      []byte
+		result []map[string]json.RawMessage
+		err    error
+	)
+
+	if b, err = json.Marshal(v); err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &result); err != nil {
+		return nil, err
+	}
+
+	for i, item := range result {
+		projected := make(map[string]json.RawMessage, len(keys))
+
+		for k, val := range item {
+			for _, key := range keys {
+				if strings.EqualFold(k, key) {
+					projected[k] = val
+				}
+			}
+		}
+
+		result[i] = projected
+	}
+
+	return result, nil
+}
+
+// Keys returns JSON object keys of struct v, including keys of empty
+// omitempty fields. Fields of embedded structs are promoted.
+func Keys(v interface{}) ([]string, error) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%T is not encoded as JSON object", v)
+	}
+
+	return structKeys(t), nil
+}
+
+func structKeys(t reflect.Type) []string {
+	var result []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+
+			if ft.Kind() == reflect.Struct {
+				result = append(result, structKeys(ft)...)
+				continue
+			}
+		}
+
+		if f.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+
+		result = append(result, name)
+	}
+
+	return result
+}
@@ -0,0 +1,305 @@
+// Package jwks signs and verifies JWT with asymmetric keys and publishes
+// verification keys as JSON Web Key Set.
+//
+// Only RS256 (RSA keys) and ES256 (EC P-256 keys) are supported. Key id is
+// RFC 7638 thumbprint of the public key, it is put into "kid" header of
+// every signed token. Verification requires known "kid" and exactly the
+// algorithm of that key, whatever token header declares.
+package jwks
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"sort"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Key is a single signing or verification key
+type Key struct {
+	ID      string
+	Method  jwt.SigningMethod
+	private crypto.PrivateKey
+	public  crypto.PublicKey
+}
+
+// KeySet holds one signing key and any number of verification keys.
+// Signing key is always a verification key too.
+type KeySet struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set document
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// Load reads signing private key and additional verification keys from PEM files.
+// Verification keys are keys being rotated out, they may be public or private.
+func Load(signingFile string, verifyFiles ...string) (*KeySet, error) {
+	var (
+		b   []byte
+		k   *Key
+		err error
+	)
+
+	if b, err = ioutil.ReadFile(signingFile); err != nil {
+		return nil, err
+	}
+
+	if k, err = ParsePEM(b); err != nil {
+		return nil, fmt.Errorf("%s - %s", signingFile, err)
+	}
+
+	if k.private == nil {
+		return nil, fmt.Errorf("%s - signing key must be a private key", signingFile)
+	}
+
+	ks := New(k)
+
+	for _, f := range verifyFiles {
+		if b, err = ioutil.ReadFile(f); err != nil {
+			return nil, err
+		}
+
+		if k, err = ParsePEM(b); err != nil {
+			return nil, fmt.Errorf("%s - %s", f, err)
+		}
+
+		ks.AddVerificationKey(k)
+	}
+
+	return ks, nil
+}
+
+// Generate returns key set with a new random ES256 signing key
+func Generate() (*KeySet, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	k, err := newKey(priv, &priv.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(k), nil
+}
+
+// New returns key set signing with the key
+func New(signing *Key) *KeySet {
+	return &KeySet{
+		signing: signing,
+		keys:    map[string]*Key{signing.ID: signing},
+	}
+}
+
+// AddVerificationKey adds key accepted by Verify
+func (ks *KeySet) AddVerificationKey(k *Key) {
+	ks.keys[k.ID] = k
+}
+
+// ParsePEM parses PKCS1, PKCS8 or SEC1 private key or PKIX public key
+func ParsePEM(b []byte) (*Key, error) {
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(priv, &priv.PublicKey)
+
+	case "EC PRIVATE KEY":
+		priv, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(priv, &priv.PublicKey)
+
+	case "PRIVATE KEY":
+		priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		switch priv := priv.(type) {
+		case *rsa.PrivateKey:
+			return newKey(priv, &priv.PublicKey)
+		case *ecdsa.PrivateKey:
+			return newKey(priv, &priv.PublicKey)
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return newKey(nil, pub)
+	}
+
+	return nil, fmt.Errorf("unsupported PEM block '%s'", block.Type)
+}
+
+func newKey(priv crypto.PrivateKey, pub crypto.PublicKey) (*Key, error) {
+	k := &Key{private: priv, public: pub}
+
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		k.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 curve is supported for EC keys")
+		}
+		k.Method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+
+	k.ID = k.thumbprint()
+
+	return k, nil
+}
+
+// JWK returns public part of the key
+func (k *Key) JWK() JWK {
+	result := JWK{Use: "sig", Alg: k.Method.Alg(), Kid: k.ID}
+
+	switch pub := k.public.(type) {
+	case *rsa.PublicKey:
+		result.Kty = "RSA"
+		result.N = encode(pub.N.Bytes())
+		result.E = encode(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		result.Kty = "EC"
+		result.Crv = "P-256"
+		result.X = encode(pad(pub.X.Bytes(), 32))
+		result.Y = encode(pad(pub.Y.Bytes(), 32))
+	}
+
+	return result
+}
+
+// thumbprint is RFC 7638 JWK thumbprint
+func (k *Key) thumbprint() string {
+	var (
+		jwk = k.JWK()
+		b   []byte
+	)
+
+	// Required members only, in lexicographic order
+	if jwk.Kty == "RSA" {
+		b, _ = json.Marshal(struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N})
+	} else {
+		b, _ = json.Marshal(struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y})
+	}
+
+	sum := sha256.Sum256(b)
+
+	return encode(sum[:])
+}
+
+// Sign returns token signed with signing key
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	token := jwt.NewWithClaims(ks.signing.Method, claims)
+	token.Header["kid"] = ks.signing.ID
+
+	return token.SignedString(ks.signing.private)
+}
+
+// Verify checks token signature and standard claims and returns token claims
+func (ks *KeySet) Verify(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		k, ok := ks.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key id '%s'", kid)
+		}
+
+		if token.Method.Alg() != k.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method '%s'", token.Method.Alg())
+		}
+
+		return k.public, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// JWKS returns all verification keys, signing key first
+func (ks *KeySet) JWKS() JWKS {
+	result := JWKS{Keys: []JWK{ks.signing.JWK()}}
+
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		if id != ks.signing.ID {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		result.Keys = append(result.Keys, ks.keys[id].JWK())
+	}
+
+	return result
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func pad(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
@@ -0,0 +1,144 @@
+package jwks
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func writePEM(t *testing.T, dir, name, typ string, der []byte) string {
+	f := filepath.Join(dir, name)
+
+	if err := ioutil.WriteFile(f, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func TestLoadAndRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPubDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldFile := writePEM(t, dir, "old.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+	oldPubFile := writePEM(t, dir, "old.pub.pem", "PUBLIC KEY", rsaPubDER)
+	newFile := writePEM(t, dir, "new.pem", "EC PRIVATE KEY", ecDER)
+
+	old, err := Load(oldFile)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	claims := jwt.MapClaims{"id": 1, "exp": time.Now().Add(time.Minute).Unix()}
+
+	oldToken, err := old.Sign(claims)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	// New signing key, old one is still accepted during rotation
+	current, err := Load(newFile, oldPubFile)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if _, err = current.Verify(oldToken); err != nil {
+		t.Fatalf("Expected old token to be valid - %s\n", err)
+	}
+
+	newToken, err := current.Sign(claims)
+	if err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+
+	if _, err = old.Verify(newToken); err == nil {
+		t.Fatalf("Expected error for unknown key id\n")
+	}
+
+	set := current.JWKS()
+
+	if len(set.Keys) != 2 {
+		t.Fatalf("\nExpected keys: %d\nObtained: %d\n", 2, len(set.Keys))
+	}
+
+	if set.Keys[0].Alg != "ES256" || set.Keys[0].Kty != "EC" || set.Keys[1].Alg != "RS256" {
+		t.Fatalf("Unexpected keys - %v\n", set.Keys)
+	}
+
+	if _, err = Load(oldPubFile); err == nil {
+		t.Fatalf("Expected error for public signing key\n")
+	}
+}
+
+func TestAlgorithmPinning(t *testing.T) {
+	ks, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := jwt.MapClaims{"id": 1, "exp": time.Now().Add(time.Minute).Unix()}
+
+	// Token with known kid but different algorithm
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ks.signing.ID
+
+	forged, err := token.SignedString([]byte(ks.signing.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ks.Verify(forged); err == nil {
+		t.Fatalf("Expected error for HS256 token\n")
+	}
+
+	none, err := jwt.NewWithClaims(jwt.SigningMethodNone, claims).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ks.Verify(none); err == nil {
+		t.Fatalf("Expected error for unsigned token\n")
+	}
+
+	valid, err := ks.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ks.Verify(valid); err != nil {
+		t.Fatalf("Unexpected error - %s\n", err)
+	}
+}
@@ -0,0 +1,224 @@
+// Package problem implements typed API errors rendered as RFC 7807
+// "application/problem+json" documents.
+//
+// Handlers and models return *Error values, middleware.Chain maps them to
+// HTTP status. Every problem has a stable machine-readable Code, clients
+// should rely on it instead of Title or Detail text.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const ContentType = "application/problem+json"
+
+// Error codes
+const (
+	CodeBadRequest   = "bad_request"
+	CodeMalformed    = "malformed_request"
+	CodeValidation   = "validation_failed"
+	CodeUnauthorized = "unauthorized"
+	CodeForbidden    = "forbidden"
+	CodeNotFound     = "not_found"
+	CodeConflict     = "conflict"
+	CodeInternal     = "internal_error"
+)
+
+// FieldError describes a single invalid field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an API error with HTTP status
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	Fields []FieldError
+	Extra  map[string]interface{}
+}
+
+func (e *Error) Error() string {
+	if len(e.Fields) == 0 {
+		return e.Detail
+	}
+
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Message)
+	}
+
+	return strings.Join(msgs, "; ")
+}
+
+// With adds extension member to problem document
+func (e *Error) With(key string, value interface{}) *Error {
+	if e.Extra == nil {
+		e.Extra = make(map[string]interface{})
+	}
+
+	e.Extra[key] = value
+
+	return e
+}
+
+func New(status int, code string, detail string) *Error {
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+func BadRequest(code string, detail string) *Error {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+// Malformed is returned when request body or parameters can't be parsed
+func Malformed(err error) *Error {
+	return New(http.StatusBadRequest, CodeMalformed, err.Error())
+}
+
+func Unauthorized(code string, detail string) *Error {
+	return New(http.StatusUnauthorized, code, detail)
+}
+
+func Forbidden(code string, detail string) *Error {
+	return New(http.StatusForbidden, code, detail)
+}
+
+func NotFound(detail string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(code string, detail string) *Error {
+	return New(http.StatusConflict, code, detail)
+}
+
+// Validation collects invalid fields. Zero value is ready to use.
+type Validation struct {
+	fields []FieldError
+}
+
+// Add records invalid field
+func (v *Validation) Add(field, code, message string) {
+	v.fields = append(v.fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// Check records invalid field unless ok
+func (v *Validation) Check(ok bool, field, code, message string) {
+	if !ok {
+		v.Add(field, code, message)
+	}
+}
+
+// Merge adds fields of another validation problem. Other errors are returned as is.
+func (v *Validation) Merge(err error) error {
+	var p *Error
+
+	if err == nil {
+		return nil
+	}
+
+	if errors.As(err, &p) && p.Code == CodeValidation {
+		v.fields = append(v.fields, p.Fields...)
+		return nil
+	}
+
+	return err
+}
+
+// Err returns validation problem or nil if all fields are valid
+func (v *Validation) Err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+
+	return &Error{
+		Status: http.StatusBadRequest,
+		Code:   CodeValidation,
+		Detail: "One or more fields are invalid",
+		Fields: v.fields,
+	}
+}
+
+// From converts any error to problem. Errors which are not problems get
+// status, which defaults to 500 if it doesn't denote an error.
+func From(err error, status int) *Error {
+	var p *Error
+
+	if errors.As(err, &p) {
+		return p
+	}
+
+	if status < http.StatusBadRequest {
+		status = http.StatusInternalServerError
+	}
+
+	code := CodeBadRequest
+	switch {
+	case status == http.StatusUnauthorized:
+		code = CodeUnauthorized
+	case status == http.StatusForbidden:
+		code = CodeForbidden
+	case status == http.StatusNotFound:
+		code = CodeNotFound
+	case status == http.StatusConflict:
+		code = CodeConflict
+	case status >= http.StatusInternalServerError:
+		code = CodeInternal
+	}
+
+	return New(status, code, err.Error())
+}
+
+// Write writes problem document for err
+func Write(w http.ResponseWriter, err error, status int, requestID string, instance string) {
+	p := From(err, status)
+
+	doc := map[string]interface{}{}
+	for k, v := range p.Extra {
+		doc[k] = v
+	}
+
+	doc["type"] = "urn:sample-api:problem:" + p.Code
+	doc["title"] = http.StatusText(p.Status)
+	doc["status"] = p.Status
+	doc["code"] = p.Code
+	doc["detail"] = p.Detail
+	doc["instance"] = instance
+
+	if len(p.Fields) != 0 {
+		doc["fields"] = p.Fields
+	}
+	if requestID != "" {
+		doc["request_id"] = requestID
+	}
+
+	b, err := json.MarshalIndent(doc, "", "    ")
+	if err != nil {
+		http.Error(w, "", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+
+	if _, err = w.Write(b); err != nil {
+		log.Printf("Error writing response - %s\n", err)
+	}
+}
+
+// Document is problem document as received by clients
+type Document struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+}